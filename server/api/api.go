@@ -0,0 +1,282 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/mo-shahab/go-pong/auth"
+	"github.com/mo-shahab/go-pong/identity"
+	"github.com/mo-shahab/go-pong/rating"
+	"github.com/mo-shahab/go-pong/store"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// leaderboard size when no limit is given, and the most a request can ask for
+const (
+	defaultLimit = 50
+	maxLimit     = 100
+)
+
+// largest request body accepted by the auth endpoints
+const maxBodyBytes = 4096
+
+// http api over the persisted game data and the account endpoints
+type Handler struct {
+	Store   store.Store
+	Ratings *rating.Service
+	Auth    *auth.Service
+	mux     *http.ServeMux
+}
+
+type registerRequest struct {
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	DisplayName string `json:"display_name"`
+}
+
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// public view of a player, without the token hash
+type playerResponse struct {
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	CreatedAt time.Time     `json:"created_at"`
+	LastSeen  time.Time     `json:"last_seen"`
+	Rating    rating.Rating `json:"rating"`
+}
+
+func NewHandler(st store.Store, ratings *rating.Service, authService *auth.Service) *Handler {
+	h := &Handler{
+		Store:   st,
+		Ratings: ratings,
+		Auth:    authService,
+		mux:     http.NewServeMux(),
+	}
+
+	h.mux.HandleFunc("POST /api/auth/register", h.register)
+	h.mux.HandleFunc("POST /api/auth/login", h.login)
+
+	h.mux.HandleFunc("GET /api/ratings", h.listRatings)
+	h.mux.HandleFunc("GET /api/ratings/{id}", h.getRating)
+	h.mux.HandleFunc("GET /api/players/{id}", h.getPlayer)
+	h.mux.HandleFunc("GET /api/players/{id}/matches", h.listPlayerMatches)
+	h.mux.HandleFunc("GET /api/matches", h.listMatches)
+	h.mux.HandleFunc("GET /api/matches/{id}", h.getMatch)
+	h.mux.HandleFunc("GET /api/matches/{id}/highlight.gif", h.getHighlight)
+
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// helpers
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Println("Failed to encode the response: ", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, reason string) {
+	writeJSON(w, status, map[string]string{"error": reason})
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, value any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+
+	if err := json.NewDecoder(r.Body).Decode(value); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return false
+	}
+
+	return true
+}
+
+func limitParam(r *http.Request) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		return defaultLimit
+	}
+
+	return min(limit, maxLimit)
+}
+
+// ---------------------------------------------------
+// Rating endpoints
+
+func (h *Handler) listRatings(w http.ResponseWriter, r *http.Request) {
+	ratings, err := h.Ratings.Top(limitParam(r))
+	if err != nil {
+		log.Println("Failed to list the ratings: ", err)
+		writeError(w, http.StatusInternalServerError, "failed to list the ratings")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ratings)
+}
+
+func (h *Handler) getRating(w http.ResponseWriter, r *http.Request) {
+	rating, err := h.Ratings.Get(r.PathValue("id"))
+	if err != nil {
+		log.Println("Failed to load the rating: ", err)
+		writeError(w, http.StatusInternalServerError, "failed to load the rating")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rating)
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Player endpoints
+
+func (h *Handler) getPlayer(w http.ResponseWriter, r *http.Request) {
+	player, found, err := h.Store.GetPlayer(r.PathValue("id"))
+	if err != nil {
+		log.Println("Failed to load the player: ", err)
+		writeError(w, http.StatusInternalServerError, "failed to load the player")
+		return
+	}
+
+	if !found {
+		writeError(w, http.StatusNotFound, "player not found")
+		return
+	}
+
+	playerRating, err := h.Ratings.Get(player.ID)
+	if err != nil {
+		log.Println("Failed to load the rating: ", err)
+		writeError(w, http.StatusInternalServerError, "failed to load the rating")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, playerResponse{
+		ID:        player.ID,
+		Name:      player.Name,
+		CreatedAt: player.CreatedAt,
+		LastSeen:  player.LastSeen,
+		Rating:    playerRating,
+	})
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Match endpoints
+
+func (h *Handler) listMatches(w http.ResponseWriter, r *http.Request) {
+	matches, err := h.Store.ListMatches(limitParam(r))
+	if err != nil {
+		log.Println("Failed to list the matches: ", err)
+		writeError(w, http.StatusInternalServerError, "failed to list the matches")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, matches)
+}
+
+func (h *Handler) getMatch(w http.ResponseWriter, r *http.Request) {
+	match, found, err := h.Store.GetMatch(r.PathValue("id"))
+	if err != nil {
+		log.Println("Failed to load the match: ", err)
+		writeError(w, http.StatusInternalServerError, "failed to load the match")
+		return
+	}
+
+	if !found {
+		writeError(w, http.StatusNotFound, "match not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, match)
+}
+
+func (h *Handler) listPlayerMatches(w http.ResponseWriter, r *http.Request) {
+	playerId := r.PathValue("id")
+
+	_, found, err := h.Store.GetPlayer(playerId)
+	if err != nil {
+		log.Println("Failed to load the player: ", err)
+		writeError(w, http.StatusInternalServerError, "failed to load the player")
+		return
+	}
+
+	if !found {
+		writeError(w, http.StatusNotFound, "player not found")
+		return
+	}
+
+	matches, err := h.Store.ListPlayerMatches(playerId, limitParam(r))
+	if err != nil {
+		log.Println("Failed to list the matches: ", err)
+		writeError(w, http.StatusInternalServerError, "failed to list the matches")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, matches)
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Auth endpoints
+
+func (h *Handler) register(w http.ResponseWriter, r *http.Request) {
+	request := registerRequest{}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	session, err := h.Auth.Register(request.Username, request.Password, request.DisplayName)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusCreated, session)
+
+	case errors.Is(err, auth.ErrUsernameTaken):
+		writeError(w, http.StatusConflict, err.Error())
+
+	case errors.Is(err, auth.ErrInvalidUsername),
+		errors.Is(err, auth.ErrInvalidPassword),
+		errors.Is(err, identity.ErrNameTooShort),
+		errors.Is(err, identity.ErrNameTooLong),
+		errors.Is(err, identity.ErrNameCharacters),
+		errors.Is(err, identity.ErrNameNotAllowed):
+		writeError(w, http.StatusBadRequest, err.Error())
+
+	default:
+		log.Println("Failed to register the account: ", err)
+		writeError(w, http.StatusInternalServerError, "failed to register the account")
+	}
+}
+
+func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
+	request := loginRequest{}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	session, err := h.Auth.Login(request.Username, request.Password)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, session)
+
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		writeError(w, http.StatusUnauthorized, err.Error())
+
+	default:
+		log.Println("Failed to log in: ", err)
+		writeError(w, http.StatusInternalServerError, "failed to log in")
+	}
+}
+
+// ---------------------------------------------------
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"github.com/mo-shahab/go-pong/render"
+	"github.com/mo-shahab/go-pong/replay"
+	"github.com/mo-shahab/go-pong/store"
+	"log"
+	"net/http"
+	"time"
+)
+
+// highlight constants
+const (
+	highlightLength = 10 * time.Second // the end of longer rallies
+	highlightEvery  = 2                // ticks per gif frame
+)
+
+// GET /api/matches/{id}/highlight.gif, the longest rally of a recorded match
+func (h *Handler) getHighlight(w http.ResponseWriter, r *http.Request) {
+	match, found, err := h.Store.GetMatch(r.PathValue("id"))
+	if err != nil {
+		log.Println("Failed to load the match: ", err)
+		writeError(w, http.StatusInternalServerError, "failed to load the match")
+		return
+	}
+
+	if !found {
+		writeError(w, http.StatusNotFound, "match not found")
+		return
+	}
+
+	if match.ReplayId == "" {
+		writeError(w, http.StatusNotFound, "the match was not recorded")
+		return
+	}
+
+	replayFile, err := h.Store.OpenReplay(match.ReplayId)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "the replay of the match is gone")
+		return
+	}
+
+	if err != nil {
+		log.Println("Failed to open the replay: ", err)
+		writeError(w, http.StatusInternalServerError, "failed to open the replay")
+		return
+	}
+
+	player, err := replay.Load(replayFile)
+	replayFile.Close()
+	if err != nil {
+		log.Printf("Failed to load replay %s: %v", match.ReplayId, err)
+		writeError(w, http.StatusInternalServerError, "failed to load the replay")
+		return
+	}
+
+	rally, found := player.LongestRally()
+	if !found {
+		writeError(w, http.StatusNotFound, "the match has no play to show")
+		return
+	}
+
+	tickInterval := time.Duration(player.Header.TickIntervalMs) * time.Millisecond
+	from := rally.From
+	if tickInterval > 0 {
+		from = max(rally.From, rally.To-int64(highlightLength/tickInterval))
+	}
+
+	// encoded before anything is written so a failure can still be reported
+	var encoded bytes.Buffer
+	states := player.States(from, rally.To, highlightEvery)
+	if err := render.New(player.Arena).GIF(&encoded, states, tickInterval*highlightEvery); err != nil {
+		log.Println("Failed to render the highlight: ", err)
+		writeError(w, http.StatusInternalServerError, "failed to render the highlight")
+		return
+	}
+
+	// finished matches never change
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(encoded.Bytes())
+}
@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/mo-shahab/go-pong/clock"
+	"github.com/mo-shahab/go-pong/config"
+	"github.com/mo-shahab/go-pong/identity"
+	"github.com/mo-shahab/go-pong/store"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// signing algorithms
+const (
+	AlgorithmHMAC    = "HS256"
+	AlgorithmEd25519 = "EdDSA"
+)
+
+// account constants, bcrypt only looks at the first 72 bytes of a password
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+	hmacSecretBytes   = 32
+)
+
+// query parameter for clients that can not set headers on the upgrade, like
+// browser websockets
+const AccessTokenParam = "access_token"
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_]{3,32}$`)
+
+var (
+	ErrInvalidUsername    = errors.New("username must be 3 to 32 lower case letters, digits or '_'")
+	ErrInvalidPassword    = fmt.Errorf("password must be %d to %d bytes long", minPasswordLength, maxPasswordLength)
+	ErrUsernameTaken      = errors.New("username is already taken")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+)
+
+// claims carried in the session tokens, the subject is the player id
+type Claims struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	jwt.RegisteredClaims
+}
+
+// a freshly issued session
+type Session struct {
+	Token     string    `json:"token"`
+	PlayerId  string    `json:"player_id"`
+	Username  string    `json:"username"`
+	Name      string    `json:"name"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type Service struct {
+	Store  store.Store
+	Config config.Auth
+	Names  config.Names
+	Clock  clock.Clock // tokens are issued and checked on it
+
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+	dummyHash []byte
+	Mu        sync.Mutex
+}
+
+func NewService(cfg config.Auth, names config.Names, st store.Store) (*Service, error) {
+	s := &Service{
+		Store:  st,
+		Config: cfg,
+		Names:  names,
+		Clock:  clock.Real{},
+	}
+
+	// compared against on unknown usernames so they take as long as wrong
+	// passwords
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	s.dummyHash = dummyHash
+
+	switch cfg.Algorithm {
+	case AlgorithmHMAC, "":
+		secret := []byte(cfg.HMACSecret)
+		if len(secret) == 0 {
+			// tokens will not survive a restart without a configured secret
+			log.Println("No hmac_secret configured, using a random secret for this run")
+			secret = make([]byte, hmacSecretBytes)
+			if _, err := rand.Read(secret); err != nil {
+				return nil, err
+			}
+		}
+
+		s.method = jwt.SigningMethodHS256
+		s.signKey = secret
+		s.verifyKey = secret
+
+	case AlgorithmEd25519:
+		key, err := parseEd25519Key(cfg.Ed25519PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+
+		s.method = jwt.SigningMethodEdDSA
+		s.signKey = key
+		s.verifyKey = key.Public()
+
+	default:
+		return nil, fmt.Errorf("unsupported token algorithm %q", cfg.Algorithm)
+	}
+
+	return s, nil
+}
+
+// accepts either the 32 byte seed or the full 64 byte private key
+func parseEd25519Key(encoded string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("ed25519_private_key is not valid base64: %w", err)
+	}
+
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	}
+
+	return nil, fmt.Errorf("ed25519_private_key must be %d or %d bytes", ed25519.SeedSize, ed25519.PrivateKeySize)
+}
+
+// ---------------------------------------------------
+// Account functions
+
+// creates the account together with the player that owns its identity
+func (s *Service) Register(username string, password string, displayName string) (*Session, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if !usernamePattern.MatchString(username) {
+		return nil, ErrInvalidUsername
+	}
+
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return nil, ErrInvalidPassword
+	}
+
+	if displayName == "" {
+		displayName = username
+	}
+
+	name, err := identity.ValidateName(displayName, s.Names)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	// held across the check and the write so two registrations can not
+	// claim the same username
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	if _, taken, err := s.Store.GetAccount(username); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, ErrUsernameTaken
+	}
+
+	now := s.Clock.Now()
+	player := store.Player{
+		ID:        uuid.New().String(),
+		Name:      name,
+		CreatedAt: now,
+		LastSeen:  now,
+	}
+
+	if err := s.Store.PutPlayer(player); err != nil {
+		return nil, err
+	}
+
+	account := store.Account{
+		Username:     username,
+		PasswordHash: string(hash),
+		PlayerId:     player.ID,
+		CreatedAt:    now,
+	}
+
+	if err := s.Store.PutAccount(account); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Registered account %s for player %s", username, player.ID)
+
+	return s.issue(account, player)
+}
+
+func (s *Service) Login(username string, password string) (*Session, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+
+	account, found, err := s.Store.GetAccount(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	player, found, err := s.Store.GetPlayer(account.PlayerId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("player %s of account %s is missing", account.PlayerId, username)
+	}
+
+	return s.issue(account, player)
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Token functions
+
+func (s *Service) issue(account store.Account, player store.Player) (*Session, error) {
+	now := s.Clock.Now()
+	expiresAt := now.Add(s.Config.TokenTTL.Duration)
+
+	claims := Claims{
+		Username: account.Username,
+		Name:     player.Name,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.Config.Issuer,
+			Subject:   player.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(s.method, claims).SignedString(s.signKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		Token:     token,
+		PlayerId:  player.ID,
+		Username:  account.Username,
+		Name:      player.Name,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (s *Service) VerifyToken(token string) (*Claims, error) {
+	claims := &Claims{}
+
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		return s.verifyKey, nil
+	},
+		jwt.WithValidMethods([]string{s.method.Alg()}),
+		jwt.WithIssuer(s.Config.Issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(s.Clock.Now),
+	)
+	if err != nil || !parsed.Valid || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// session token from the Authorization header or the access_token query
+// parameter, empty when the request has neither
+func TokenFromRequest(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if token, found := strings.CutPrefix(header, "Bearer "); found {
+		return strings.TrimSpace(token)
+	}
+
+	return r.URL.Query().Get(AccessTokenParam)
+}
+
+// claims of the request, nil for guests, an error if a token was sent but is
+// not valid
+func (s *Service) Authenticate(r *http.Request) (*Claims, error) {
+	token := TokenFromRequest(r)
+	if token == "" {
+		return nil, nil
+	}
+
+	return s.VerifyToken(token)
+}
+
+// ---------------------------------------------------
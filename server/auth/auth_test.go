@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"github.com/mo-shahab/go-pong/clock"
+	"github.com/mo-shahab/go-pong/config"
+	"github.com/mo-shahab/go-pong/store"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+// the service logs every registration, which buries the test output
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestTokenExpiry(t *testing.T) {
+	cfg := config.Default()
+	st := store.NewMemoryStore()
+
+	s, err := NewService(cfg.Auth, cfg.Names, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registeredAt := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+	s.Clock = clock.NewFake(registeredAt)
+
+	session, err := s.Register("player_one", "long enough", "Player One")
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	if want := registeredAt.Add(cfg.Auth.TokenTTL.Duration); !session.ExpiresAt.Equal(want) {
+		t.Fatalf("the token expires at %v, want %v", session.ExpiresAt, want)
+	}
+
+	account, _, _ := st.GetAccount("player_one")
+	if !account.CreatedAt.Equal(registeredAt) {
+		t.Fatalf("the account was created at %v, want %v", account.CreatedAt, registeredAt)
+	}
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		valid   bool
+	}{
+		{name: "fresh", advance: 0, valid: true},
+		{name: "just before the end", advance: cfg.Auth.TokenTTL.Duration - time.Second, valid: true},
+		{name: "expired", advance: cfg.Auth.TokenTTL.Duration + time.Second, valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s.Clock = clock.NewFake(registeredAt.Add(test.advance))
+
+			_, err := s.VerifyToken(session.Token)
+			if valid := err == nil; valid != test.valid {
+				t.Fatalf("got valid %v, want %v (%v)", valid, test.valid, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package bot
+
+import (
+	"github.com/mo-shahab/go-pong/ball"
+	"github.com/mo-shahab/go-pong/simulation"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// how well a bot plays
+type Difficulty struct {
+	Name          string
+	ReactionDelay time.Duration // age of the ball position the bot reacts to
+	Bounces       int           // wall bounces it can see coming, it guesses the wall beyond that
+	AimError      float64       // largest distance its aim misses the ball by
+	MoveInterval  time.Duration // shortest time between two moves, caps the paddle speed
+}
+
+// difficulty levels
+var (
+	Easy = Difficulty{
+		Name:          "easy",
+		ReactionDelay: 300 * time.Millisecond,
+		Bounces:       0,
+		AimError:      60,
+		MoveInterval:  160 * time.Millisecond,
+	}
+
+	Medium = Difficulty{
+		Name:          "medium",
+		ReactionDelay: 150 * time.Millisecond,
+		Bounces:       1,
+		AimError:      35,
+		MoveInterval:  96 * time.Millisecond,
+	}
+
+	Hard = Difficulty{
+		Name:          "hard",
+		ReactionDelay: 64 * time.Millisecond,
+		Bounces:       4,
+		AimError:      12,
+		MoveInterval:  32 * time.Millisecond,
+	}
+)
+
+var Levels = []Difficulty{Easy, Medium, Hard}
+
+// the level with the name, empty gives the medium level
+func ByName(name string) (Difficulty, bool) {
+	if name == "" {
+		return Medium, true
+	}
+
+	for _, level := range Levels {
+		if level.Name == name {
+			return level, true
+		}
+	}
+
+	return Difficulty{}, false
+}
+
+// decides a paddle's moves from the game state, one call per tick. it only
+// produces directions, the caller moves the paddle the way it would for a
+// human. it is not safe for concurrent use
+type Bot struct {
+	Difficulty Difficulty
+	PaddleStep float64 // how far one move goes, for games with other physics
+
+	reactionTicks int
+	moveTicks     int64
+	rng           *rand.Rand
+	seen          []ball.Ball // newest last, as long as the reaction delay
+	approaching   bool
+	aim           float64 // aim error for the ball coming in
+	lastMove      int64
+}
+
+func New(difficulty Difficulty, tickInterval time.Duration, seed uint64) *Bot {
+	return &Bot{
+		Difficulty:    difficulty,
+		PaddleStep:    simulation.PaddleStep,
+		reactionTicks: int(difficulty.ReactionDelay / tickInterval),
+		moveTicks:     max(1, int64(math.Ceil(float64(difficulty.MoveInterval)/float64(tickInterval)))),
+		rng:           rand.New(rand.NewPCG(seed, seed>>1|1)),
+		lastMove:      math.MinInt64 / 2,
+	}
+}
+
+// ---------------------------------------------------
+// Decision functions
+
+// "up", "down" or "" for the team's paddle. the bot sees the ball as it was
+// a reaction delay ago but always knows where its own paddle is
+func (b *Bot) Decide(team string, arena simulation.Arena, state simulation.State) string {
+	b.seen = append(b.seen, state.Ball)
+	if len(b.seen) > b.reactionTicks+1 {
+		b.seen = b.seen[len(b.seen)-b.reactionTicks-1:]
+	}
+
+	if state.Tick-b.lastMove < b.moveTicks {
+		return ""
+	}
+
+	target := b.target(team, arena, b.seen[0])
+	center := state.PaddlePosition(team) + arena.Paddle.Height/2
+
+	// a step past the target would overshoot it
+	if math.Abs(target-center) <= b.PaddleStep/2 {
+		return ""
+	}
+
+	b.lastMove = state.Tick
+
+	if target < center {
+		return "up"
+	}
+
+	return "down"
+}
+
+// where the paddle's center should go, the predicted meeting point while
+// the ball comes in and the middle of the arena while it goes away
+func (b *Bot) target(team string, arena simulation.Arena, seen ball.Ball) float64 {
+	towards := (team == "left" && seen.Dx < 0) || (team == "right" && seen.Dx > 0)
+
+	if !towards {
+		b.approaching = false
+		return arena.Canvas.Height / 2
+	}
+
+	// a new error for every ball that comes in, so the aim does not jitter
+	if !b.approaching {
+		b.approaching = true
+		b.aim = (b.rng.Float64()*2 - 1) * b.Difficulty.AimError
+	}
+
+	x := arena.Paddle.Width + seen.Radius
+	if team == "right" {
+		x = arena.Canvas.Width - arena.Paddle.Width - seen.Radius
+	}
+
+	return PredictY(arena, seen, x, b.Difficulty.Bounces) + b.aim
+}
+
+// height at which the ball will cross x, following it off the top and
+// bottom walls at most the given number of times. past that the ball is
+// assumed to stop at the wall it is heading for
+func PredictY(arena simulation.Arena, ball ball.Ball, x float64, bounces int) float64 {
+	top := ball.Radius
+	span := arena.Canvas.Height - 2*ball.Radius
+
+	if ball.Dx == 0 || span <= 0 {
+		return ball.Y
+	}
+
+	ticks := (x - ball.X) / ball.Dx
+	if ticks < 0 {
+		return ball.Y
+	}
+
+	// the path unfolded across mirrored copies of the arena
+	unfolded := ball.Y + ball.Dy*ticks - top
+	walls := int(math.Abs(math.Floor(unfolded / span)))
+
+	if walls > bounces {
+		return top + math.Max(0, math.Min(span, unfolded))
+	}
+
+	folded := math.Mod(unfolded, 2*span)
+	if folded < 0 {
+		folded += 2 * span
+	}
+
+	if folded > span {
+		folded = 2*span - folded
+	}
+
+	return top + folded
+}
+
+// ---------------------------------------------------
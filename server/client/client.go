@@ -10,4 +10,8 @@ type Client struct {
 	Team      string
 	ID        string
 	RoomId    string
+	PlayerId  string
+	Name      string
+	Spectator bool
+	Bot       bool // played by the server, there is no connection
 }
@@ -0,0 +1,219 @@
+package clock
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// a clock that only moves when Advance is called. timers and tickers fire in
+// order of their time while it advances, a ticker that falls behind drops
+// ticks like the real one does
+type Fake struct {
+	Mu      sync.Mutex
+	now     time.Time
+	waiting []*fakeTimer // pending timers, tickers and sleepers
+	changed *sync.Cond
+}
+
+// a timer or ticker of the fake clock
+type fakeTimer struct {
+	clock  *Fake
+	when   time.Time
+	period time.Duration // ticks again after this long, 0 for timers
+	c      chan time.Time
+	f      func()
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+// ---------------------------------------------------
+// Fake clock functions
+
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.changed = sync.NewCond(&f.Mu)
+
+	return f
+}
+
+func (f *Fake) Now() time.Time {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// blocks until the clock has been advanced by d
+func (f *Fake) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	<-f.NewTimer(d).C()
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+
+	t := &fakeTimer{clock: f, period: d, c: make(chan time.Time, 1)}
+	f.start(t, d)
+
+	return fakeTicker{t}
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: f, c: make(chan time.Time, 1)}
+	f.start(t, d)
+
+	return t
+}
+
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	t := &fakeTimer{clock: f, f: fn}
+	f.start(t, d)
+
+	return t
+}
+
+// moves the clock forward, firing what is due on the way
+func (f *Fake) Advance(d time.Duration) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+
+	end := f.now.Add(d)
+
+	for {
+		next := f.next(end)
+		if next == nil {
+			break
+		}
+
+		f.now = next.when
+		next.fire()
+
+		if next.period > 0 {
+			next.when = next.when.Add(next.period)
+		} else {
+			f.remove(next)
+		}
+	}
+
+	f.now = end
+	f.changed.Broadcast()
+}
+
+// blocks until exactly n timers, tickers and sleepers are waiting on the
+// clock, so a test knows the goroutine it is about to wake has gone to sleep
+func (f *Fake) BlockUntil(n int) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+
+	for len(f.waiting) != n {
+		f.changed.Wait()
+	}
+}
+
+// the number of timers, tickers and sleepers waiting on the clock
+func (f *Fake) Waiting() int {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+
+	return len(f.waiting)
+}
+
+// timers due right away fire before they are returned, like the real ones
+func (f *Fake) start(t *fakeTimer, d time.Duration) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+
+	t.when = f.now.Add(d)
+
+	if d <= 0 && t.period == 0 {
+		t.fire()
+		return
+	}
+
+	f.waiting = append(f.waiting, t)
+	f.changed.Broadcast()
+}
+
+// the earliest of the waiting that is due by end, expects f.Mu to be held
+func (f *Fake) next(end time.Time) *fakeTimer {
+	var next *fakeTimer
+	for _, t := range f.waiting {
+		if !t.when.After(end) && (next == nil || t.when.Before(next.when)) {
+			next = t
+		}
+	}
+
+	return next
+}
+
+// expects f.Mu to be held
+func (f *Fake) remove(t *fakeTimer) bool {
+	i := slices.Index(f.waiting, t)
+	if i < 0 {
+		return false
+	}
+
+	f.waiting = slices.Delete(f.waiting, i, i+1)
+	f.changed.Broadcast()
+
+	return true
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Fake timer functions
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.Mu.Lock()
+	defer t.clock.Mu.Unlock()
+
+	return t.clock.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	f := t.clock
+
+	f.Mu.Lock()
+	active := f.remove(t)
+	f.Mu.Unlock()
+
+	f.start(t, d)
+
+	return active
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
+
+// a full channel drops the tick, expects the clock's Mu to be held
+func (t *fakeTimer) fire() {
+	if t.f != nil {
+		go t.f()
+		return
+	}
+
+	select {
+	case t.c <- t.clock.now:
+	default:
+	}
+}
+
+// ---------------------------------------------------
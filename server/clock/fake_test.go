@@ -0,0 +1,179 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+func TestFakeTimer(t *testing.T) {
+	tests := []struct {
+		name    string
+		timer   time.Duration
+		advance []time.Duration
+
+		wantFired bool
+	}{
+		{name: "not due yet", timer: time.Second, advance: []time.Duration{999 * time.Millisecond}},
+		{name: "due", timer: time.Second, advance: []time.Duration{time.Second}, wantFired: true},
+		{name: "due after a few advances", timer: time.Second, advance: []time.Duration{400 * time.Millisecond, 600 * time.Millisecond}, wantFired: true},
+		{name: "due right away", timer: 0, wantFired: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := NewFake(start)
+			timer := f.NewTimer(test.timer)
+
+			for _, d := range test.advance {
+				f.Advance(d)
+			}
+
+			select {
+			case fired := <-timer.C():
+				if !test.wantFired {
+					t.Fatalf("fired at %s", fired)
+				}
+				if want := start.Add(test.timer); !fired.Equal(want) {
+					t.Fatalf("fired at %s, want %s", fired, want)
+				}
+			default:
+				if test.wantFired {
+					t.Fatal("did not fire")
+				}
+			}
+		})
+	}
+}
+
+func TestFakeTimerStop(t *testing.T) {
+	f := NewFake(start)
+	timer := f.NewTimer(time.Second)
+
+	if !timer.Stop() {
+		t.Fatal("stopping a pending timer returned false")
+	}
+	if timer.Stop() {
+		t.Fatal("stopping a stopped timer returned true")
+	}
+
+	f.Advance(time.Minute)
+	select {
+	case <-timer.C():
+		t.Fatal("a stopped timer fired")
+	default:
+	}
+
+	// a reset timer counts from now
+	timer.Reset(time.Second)
+	f.Advance(time.Second)
+	if fired := <-timer.C(); !fired.Equal(start.Add(time.Minute + time.Second)) {
+		t.Fatalf("reset timer fired at %s", fired)
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(start)
+	ticker := f.NewTicker(time.Second)
+
+	f.Advance(time.Second)
+	if tick := <-ticker.C(); !tick.Equal(start.Add(time.Second)) {
+		t.Fatalf("first tick at %s", tick)
+	}
+
+	// nobody reads while the clock jumps, the first tick is kept and the rest dropped
+	f.Advance(5 * time.Second)
+	if tick := <-ticker.C(); !tick.Equal(start.Add(2 * time.Second)) {
+		t.Fatalf("kept the tick at %s", tick)
+	}
+	select {
+	case tick := <-ticker.C():
+		t.Fatalf("got another tick at %s", tick)
+	default:
+	}
+
+	ticker.Stop()
+	if f.Waiting() != 0 {
+		t.Fatalf("%d waiting after the ticker stopped", f.Waiting())
+	}
+}
+
+func TestFakeOrder(t *testing.T) {
+	f := NewFake(start)
+
+	fired := make(chan int, 3)
+	for i, d := range []time.Duration{3 * time.Second, time.Second, 2 * time.Second} {
+		timer := f.NewTimer(d)
+		go func() {
+			<-timer.C()
+			fired <- i
+		}()
+	}
+
+	// one second at a time, so the goroutines report in order
+	for _, want := range []int{1, 2, 0} {
+		f.Advance(time.Second)
+		if got := <-fired; got != want {
+			t.Fatalf("timer %d fired, want %d", got, want)
+		}
+	}
+
+	// the clock is at each timer's time as it fires
+	timer := f.NewTimer(time.Second)
+	f.AfterFunc(500*time.Millisecond, func() { fired <- 0 })
+	f.Advance(time.Minute)
+
+	<-fired
+	if got, want := <-timer.C(), start.Add(4*time.Second); !got.Equal(want) {
+		t.Fatalf("fired at %s, want %s", got, want)
+	}
+	if now, want := f.Now(), start.Add(time.Minute+3*time.Second); !now.Equal(want) {
+		t.Fatalf("clock at %s, want %s", now, want)
+	}
+}
+
+func TestFakeSleep(t *testing.T) {
+	f := NewFake(start)
+
+	woke := make(chan time.Time)
+	go func() {
+		f.Sleep(time.Minute)
+		woke <- f.Now()
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(59 * time.Second)
+
+	select {
+	case <-woke:
+		t.Fatal("woke up early")
+	default:
+	}
+
+	f.Advance(time.Second)
+	if now := <-woke; !now.Equal(start.Add(time.Minute)) {
+		t.Fatalf("woke up at %s", now)
+	}
+}
+
+func TestFakeAfterFunc(t *testing.T) {
+	f := NewFake(start)
+
+	ran := make(chan bool, 2)
+	f.AfterFunc(time.Second, func() { ran <- true })
+	stopped := f.AfterFunc(time.Second, func() { ran <- false })
+
+	stopped.Stop()
+	f.Advance(time.Second)
+
+	if !<-ran {
+		t.Fatal("the stopped func ran")
+	}
+
+	select {
+	case <-ran:
+		t.Fatal("the stopped func ran")
+	default:
+	}
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// duration written as a string like "24h" or "10s" in the config file
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+
+	d.Duration = parsed
+	return nil
+}
+
+// display name rules
+type Names struct {
+	MinLength int      `json:"min_length"`
+	MaxLength int      `json:"max_length"`
+	Blocklist []string `json:"blocklist"`
+}
+
+// account and session settings, the signing key is either a shared HMAC
+// secret or a base64 encoded ed25519 private key (or its 32 byte seed)
+type Auth struct {
+	AllowGuests       bool     `json:"allow_guests"`
+	Algorithm         string   `json:"algorithm"` // "HS256" or "EdDSA"
+	HMACSecret        string   `json:"hmac_secret"`
+	Ed25519PrivateKey string   `json:"ed25519_private_key"`
+	Issuer            string   `json:"issuer"`
+	TokenTTL          Duration `json:"token_ttl"`
+}
+
+// spectator settings, a delay like "10s" holds back everything spectators
+// see so they can not feed live information to the players
+type Spectators struct {
+	Delay Duration `json:"delay"`
+}
+
+// bot settings, with backfill a bot takes over the side of a team whose last
+// player disconnects mid-match, and the player gets the paddle back if they
+// rejoin the room within the grace period
+type Bots struct {
+	Backfill           bool     `json:"backfill"`
+	BackfillDifficulty string   `json:"backfill_difficulty"`
+	ReconnectGrace     Duration `json:"reconnect_grace"`
+}
+
+// server configuration, loaded from a JSON file, anything missing from the
+// file keeps its default value
+type Config struct {
+	Names      Names      `json:"names"`
+	Auth       Auth       `json:"auth"`
+	Spectators Spectators `json:"spectators"`
+	Bots       Bots       `json:"bots"`
+}
+
+func Default() *Config {
+	return &Config{
+		Names: Names{
+			MinLength: 3,
+			MaxLength: 16,
+			Blocklist: []string{},
+		},
+		Auth: Auth{
+			AllowGuests: true,
+			Algorithm:   "HS256",
+			Issuer:      "go-pong",
+			TokenTTL:    Duration{24 * time.Hour},
+		},
+		Bots: Bots{
+			BackfillDifficulty: "medium",
+			ReconnectGrace:     Duration{30 * time.Second},
+		},
+	}
+}
+
+// loads the config file, an empty path gives the defaults
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
@@ -3,7 +3,9 @@ module github.com/mo-shahab/go-pong
 go 1.23.5
 
 require (
+	github.com/golang-jwt/jwt/v5 v5.2.2
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/websocket v1.5.3
+	golang.org/x/crypto v0.36.0
 	google.golang.org/protobuf v1.36.6
 )
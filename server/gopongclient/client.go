@@ -0,0 +1,401 @@
+// go client for the game server, it wraps the pb.Message envelope in
+// methods and events so bots, load tests and tools do not hand roll it
+package gopongclient
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/websocket"
+	pb "github.com/mo-shahab/go-pong/proto"
+	"google.golang.org/protobuf/proto"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// reconnect and buffer defaults
+const (
+	defaultReconnectDelay    = 500 * time.Millisecond
+	defaultMaxReconnectDelay = 10 * time.Second
+	defaultEventBuffer       = 256
+	defaultClockSamples      = 5
+)
+
+var (
+	ErrClosed       = errors.New("gopongclient: client is closed")
+	ErrNotConnected = errors.New("gopongclient: not connected")
+)
+
+type Options struct {
+	URL         string // the server's websocket endpoint, like ws://localhost:8080/ws
+	Name        string // display name asked for when connecting as a guest
+	Token       string // guest token from an earlier identity, resumes that player
+	AccessToken string // account session token, sent as a bearer token
+	Replay      string // id of a recorded match to play back instead of playing
+
+	// reconnects with the guest token after the connection drops, and goes
+	// back to the room and game it was in
+	Reconnect            bool
+	ReconnectDelay       time.Duration // first wait before reconnecting, doubles on every failure
+	MaxReconnectDelay    time.Duration
+	MaxReconnectAttempts int // 0 tries forever
+
+	ClockSync   bool // syncs the clock with the server after every connect
+	EventBuffer int  // size of the subscription channels
+
+	Dialer *websocket.Dialer // websocket.DefaultDialer if nil
+}
+
+// a connection to the server. the fields below Mu follow the messages the
+// server sends and are safe to read with Mu held
+type Client struct {
+	Options  Options
+	Handlers Handlers
+
+	Mu        sync.Mutex
+	PlayerId  string
+	Name      string
+	Token     string // guest token used to resume, empty for accounts
+	Username  string // account username, empty for guests
+	RoomId    string
+	Team      string // "left", "right" or "spectator"
+	Spectator bool
+
+	// messages that could not be delivered because a subscription channel
+	// was full
+	Dropped atomic.Int64
+
+	conn        *websocket.Conn
+	writeMu     sync.Mutex
+	arena       *pb.InitMessage // sent by Ready, sent again after a reconnect
+	joining     string          // room of the join request waiting for its response
+	waiters     []*waiter
+	subscribers []*subscriber
+	clock       clock
+	closed      bool
+	stop        chan struct{} // closed by Close
+	done        chan struct{}
+}
+
+// ---------------------------------------------------
+// Connection functions
+
+func New(options Options) *Client {
+	if options.ReconnectDelay <= 0 {
+		options.ReconnectDelay = defaultReconnectDelay
+	}
+	if options.MaxReconnectDelay <= 0 {
+		options.MaxReconnectDelay = defaultMaxReconnectDelay
+	}
+	if options.EventBuffer <= 0 {
+		options.EventBuffer = defaultEventBuffer
+	}
+	if options.Dialer == nil {
+		options.Dialer = websocket.DefaultDialer
+	}
+
+	return &Client{
+		Options: options,
+		Token:   options.Token,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// connects with a new client, see Connect
+func Dial(ctx context.Context, options Options) (*Client, error) {
+	c := New(options)
+	if err := c.Connect(ctx); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// connects and waits for the server to identify the player. handlers have
+// to be set before connecting
+func (c *Client) Connect(ctx context.Context) error {
+	// playback connections are not identified
+	if c.Options.Replay != "" {
+		if err := c.dial(ctx); err != nil {
+			return err
+		}
+
+		go c.readLoop()
+		c.connected(false)
+
+		return nil
+	}
+
+	identity := c.expect(pb.MsgType_identity)
+
+	if err := c.dial(ctx); err != nil {
+		c.forget(identity)
+		return err
+	}
+
+	go c.readLoop()
+
+	if _, err := c.wait(ctx, identity); err != nil {
+		c.Close()
+		return err
+	}
+
+	c.connected(false)
+
+	return nil
+}
+
+// closes the connection for good, subscriptions are closed and pending
+// requests fail with ErrClosed
+func (c *Client) Close() error {
+	c.Mu.Lock()
+	if c.closed {
+		c.Mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	conn := c.conn
+	c.Mu.Unlock()
+
+	close(c.stop)
+
+	if conn == nil {
+		c.shutdown(ErrClosed)
+		return nil
+	}
+
+	c.writeMu.Lock()
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.writeMu.Unlock()
+
+	err := conn.Close()
+	<-c.done
+
+	return err
+}
+
+// closed once the client has stopped for good, after Close or when the
+// connection dropped and could not be resumed
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Client) dial(ctx context.Context) error {
+	endpoint, err := url.Parse(c.Options.URL)
+	if err != nil {
+		return err
+	}
+
+	c.Mu.Lock()
+	query := endpoint.Query()
+	if c.Options.Name != "" {
+		query.Set("name", c.Options.Name)
+	}
+	if c.Token != "" {
+		query.Set("token", c.Token)
+	}
+	if c.Options.Replay != "" {
+		query.Set("replay", c.Options.Replay)
+	}
+	endpoint.RawQuery = query.Encode()
+	c.Mu.Unlock()
+
+	header := http.Header{}
+	if c.Options.AccessToken != "" {
+		header.Set("Authorization", "Bearer "+c.Options.AccessToken)
+	}
+
+	conn, _, err := c.Options.Dialer.DialContext(ctx, endpoint.String(), header)
+	if err != nil {
+		return err
+	}
+
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	if c.closed {
+		conn.Close()
+		return ErrClosed
+	}
+
+	c.conn = conn
+
+	return nil
+}
+
+// reads until the connection is closed for good, reconnecting in between
+// if the options ask for it
+func (c *Client) readLoop() {
+	for {
+		c.Mu.Lock()
+		conn := c.conn
+		c.Mu.Unlock()
+
+		err := c.read(conn)
+
+		c.Mu.Lock()
+		closed := c.closed
+		c.Mu.Unlock()
+
+		if closed {
+			c.shutdown(ErrClosed)
+			return
+		}
+
+		if c.Handlers.Disconnected != nil {
+			c.Handlers.Disconnected(err)
+		}
+
+		if !c.Options.Reconnect || !c.reconnect() {
+			c.shutdown(err)
+			return
+		}
+	}
+}
+
+func (c *Client) read(conn *websocket.Conn) error {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		message := &pb.Message{}
+		if err := proto.Unmarshal(data, message); err != nil {
+			continue
+		}
+
+		c.dispatch(message)
+	}
+}
+
+// dials again with backoff and resumes the room and game the client was in,
+// the server restores the player from the guest token and gives back the
+// paddle if a bot is still holding it
+func (c *Client) reconnect() bool {
+	delay := c.Options.ReconnectDelay
+
+	for attempt := 1; c.Options.MaxReconnectAttempts == 0 || attempt <= c.Options.MaxReconnectAttempts; attempt++ {
+		select {
+		case <-time.After(delay):
+		case <-c.stop:
+			return false
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.Options.MaxReconnectDelay)
+		err := c.dial(ctx)
+		cancel()
+
+		if err == nil {
+			c.resume()
+			c.connected(true)
+			return true
+		}
+
+		if errors.Is(err, ErrClosed) {
+			return false
+		}
+
+		delay = min(delay*2, c.Options.MaxReconnectDelay)
+	}
+
+	return false
+}
+
+// the server handles messages in order after identifying the player, so
+// the requests can go out before the identity arrives
+func (c *Client) resume() {
+	c.Mu.Lock()
+	roomId := c.RoomId
+	spectator := c.Spectator
+	arena := c.arena
+	c.joining = roomId
+	c.Mu.Unlock()
+
+	if roomId == "" {
+		return
+	}
+
+	c.Send(&pb.Message{
+		Type: pb.MsgType_room_join_request,
+		MessageType: &pb.Message_RoomJoinRequest{
+			RoomJoinRequest: &pb.RoomJoinRequest{RoomId: roomId, Spectate: spectator},
+		},
+	})
+
+	if arena != nil {
+		c.Send(&pb.Message{
+			Type:        pb.MsgType_init,
+			MessageType: &pb.Message_Init{Init: arena},
+		})
+	}
+}
+
+func (c *Client) connected(resumed bool) {
+	if c.Options.ClockSync {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), c.Options.MaxReconnectDelay)
+			defer cancel()
+			c.SyncClock(ctx, defaultClockSamples)
+		}()
+	}
+
+	if c.Handlers.Connected != nil {
+		c.Handlers.Connected(resumed)
+	}
+}
+
+func (c *Client) shutdown(err error) {
+	c.Mu.Lock()
+	c.closed = true
+	waiters := c.waiters
+	subscribers := c.subscribers
+	c.waiters = nil
+	c.subscribers = nil
+	c.Mu.Unlock()
+
+	if err == nil {
+		err = ErrClosed
+	}
+
+	for _, w := range waiters {
+		w.fail(err)
+	}
+
+	for _, s := range subscribers {
+		close(s.C)
+	}
+
+	close(c.done)
+}
+
+// sends any message, the typed methods cover the ones the server handles
+func (c *Client) Send(message *pb.Message) error {
+	encoded, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	c.Mu.Lock()
+	conn := c.conn
+	closed := c.closed
+	c.Mu.Unlock()
+
+	if closed {
+		return ErrClosed
+	}
+
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return conn.WriteMessage(websocket.BinaryMessage, encoded)
+}
+
+// ---------------------------------------------------
@@ -0,0 +1,78 @@
+package gopongclient
+
+import (
+	"context"
+	pb "github.com/mo-shahab/go-pong/proto"
+	"time"
+)
+
+// the best clock sync sample so far
+type clock struct {
+	Offset time.Duration // server clock minus local clock
+	RTT    time.Duration
+	Synced bool
+}
+
+// ---------------------------------------------------
+// Clock functions
+
+// estimates the offset of the server's clock with a few pings, the sample
+// with the shortest round trip wins since its one-way delays are the most
+// likely to be even. returns the offset and that round trip
+func (c *Client) SyncClock(ctx context.Context, samples int) (time.Duration, time.Duration, error) {
+	best := clock{}
+
+	for range max(samples, 1) {
+		sentAt := time.Now()
+		clientTime := sentAt.UnixMicro()
+
+		response, err := c.request(ctx, &pb.Message{
+			Type: pb.MsgType_ping,
+			MessageType: &pb.Message_Ping{
+				Ping: &pb.PingMessage{ClientTime: clientTime},
+			},
+		}, c.expectMatch(func(message *pb.Message) bool {
+			return message.Type == pb.MsgType_pong && message.GetPong().ClientTime == clientTime
+		}))
+		if err != nil {
+			return 0, 0, err
+		}
+
+		receivedAt := time.Now()
+		rtt := receivedAt.Sub(sentAt)
+		serverTime := time.UnixMicro(response.GetPong().ServerTime)
+
+		if !best.Synced || rtt < best.RTT {
+			best = clock{
+				Offset: serverTime.Sub(sentAt.Add(rtt / 2)),
+				RTT:    rtt,
+				Synced: true,
+			}
+		}
+	}
+
+	c.Mu.Lock()
+	c.clock = best
+	c.Mu.Unlock()
+
+	return best.Offset, best.RTT, nil
+}
+
+// the server's current time as far as the last sync could tell, the local
+// time until the clock was synced
+func (c *Client) ServerTime() time.Time {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	return time.Now().Add(c.clock.Offset)
+}
+
+// the round trip to the server measured by the last sync, zero until then
+func (c *Client) RTT() time.Duration {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	return c.clock.RTT
+}
+
+// ---------------------------------------------------
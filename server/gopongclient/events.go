@@ -0,0 +1,293 @@
+package gopongclient
+
+import (
+	"context"
+	pb "github.com/mo-shahab/go-pong/proto"
+	"slices"
+)
+
+// typed callbacks for the messages the server sends, nil ones are skipped.
+// they run in order on the goroutine reading the connection, so they must
+// not block or wait for a response from the server
+type Handlers struct {
+	Connected    func(resumed bool) // after connecting and after every reconnect
+	Disconnected func(err error)
+
+	Identity          func(*pb.IdentityMessage)
+	RoomCreated       func(*pb.RoomCreateResponse)
+	RoomJoined        func(*pb.RoomJoinResponse)
+	RoomPlayers       func(*pb.RoomPlayersMessage)
+	WaitingRoom       func(*pb.WaitingRoomStateMessage)
+	GameStart         func(*pb.GameStartMessage)
+	RoomClosed        func(*pb.RoomClosedMessage)
+	InitialGameState  func(*pb.InitialGameStateMessage)
+	GameState         func(*pb.GameStateMessage)
+	BallPosition      func(*pb.BallPositionMessage)
+	PaddlePositions   func(*pb.PaddlePositionsMessage)
+	Score             func(*pb.ScoreMessage)
+	GoalReplay        func(*pb.GoalReplayMessage)
+	MatchEnd          func(*pb.MatchEndMessage)
+	MatchmakingStatus func(*pb.MatchmakingStatusMessage)
+	MatchFound        func(*pb.MatchFoundMessage)
+	Rating            func(*pb.RatingMessage)
+	MatchHistory      func(*pb.MatchHistoryMessage)
+	Chat              func(*pb.ChatMessage)
+	ReplayState       func(*pb.ReplayStateMessage)
+	Error             func(*pb.ErrorMessage)
+
+	Message func(*pb.Message) // every message, after the typed callback
+}
+
+// a channel of messages of some types
+type subscriber struct {
+	C     chan *pb.Message
+	Types []pb.MsgType // every type if empty
+}
+
+// waits for the first message that matches
+type waiter struct {
+	Match  func(*pb.Message) bool
+	Result chan *pb.Message
+	Err    error
+}
+
+// ---------------------------------------------------
+// Event functions
+
+// delivers the server's messages of the types, or all of them if no type is
+// given, until the client closes. messages that do not fit in the channel's
+// buffer are dropped and counted in Dropped
+func (c *Client) Subscribe(types ...pb.MsgType) <-chan *pb.Message {
+	s := &subscriber{
+		C:     make(chan *pb.Message, c.Options.EventBuffer),
+		Types: types,
+	}
+
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	if c.closed {
+		close(s.C)
+		return s.C
+	}
+
+	c.subscribers = append(c.subscribers, s)
+
+	return s.C
+}
+
+func (c *Client) dispatch(message *pb.Message) {
+	c.track(message)
+
+	c.Mu.Lock()
+	waiters := c.waiters[:0:0]
+	for _, w := range c.waiters {
+		if w.Match(message) {
+			w.Result <- message
+		} else {
+			waiters = append(waiters, w)
+		}
+	}
+	c.waiters = waiters
+	subscribers := c.subscribers
+	c.Mu.Unlock()
+
+	for _, s := range subscribers {
+		if len(s.Types) > 0 && !slices.Contains(s.Types, message.Type) {
+			continue
+		}
+
+		select {
+		case s.C <- message:
+		default:
+			c.Dropped.Add(1)
+		}
+	}
+
+	c.handle(message)
+}
+
+// keeps the client's view of who it is and where it plays up to date
+func (c *Client) track(message *pb.Message) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	switch m := message.MessageType.(type) {
+	case *pb.Message_Identity:
+		c.PlayerId = m.Identity.PlayerId
+		c.Name = m.Identity.Name
+		c.Username = m.Identity.Username
+		if m.Identity.Token != "" {
+			c.Token = m.Identity.Token
+		}
+
+	case *pb.Message_RoomCreateResponse:
+		c.RoomId = m.RoomCreateResponse.RoomId
+		c.Team = ""
+		c.Spectator = false
+		c.arena = nil
+
+	case *pb.Message_RoomJoinResponse:
+		if m.RoomJoinResponse.Success {
+			if c.joining != c.RoomId {
+				c.arena = nil
+			}
+			c.RoomId = c.joining
+			c.Team = m.RoomJoinResponse.YourTeam
+			c.Spectator = m.RoomJoinResponse.Spectator
+		}
+		c.joining = ""
+
+	case *pb.Message_MatchFound:
+		c.RoomId = m.MatchFound.RoomId
+		c.Team = ""
+		c.Spectator = false
+		c.arena = nil
+
+	case *pb.Message_InitialGameState:
+		if m.InitialGameState.YourTeam != "" {
+			c.Team = m.InitialGameState.YourTeam
+		}
+
+	case *pb.Message_GameState:
+		if m.GameState.YourTeam != nil {
+			c.Team = *m.GameState.YourTeam
+		}
+
+	case *pb.Message_MatchEnd:
+		// there is no game to go back to after a reconnect
+		c.arena = nil
+
+	case *pb.Message_RoomClosed:
+		if m.RoomClosed.RoomId == c.RoomId {
+			c.RoomId = ""
+			c.Team = ""
+			c.Spectator = false
+			c.arena = nil
+		}
+	}
+}
+
+func (c *Client) handle(message *pb.Message) {
+	h := c.Handlers
+
+	switch m := message.MessageType.(type) {
+	case *pb.Message_Identity:
+		call(h.Identity, m.Identity)
+	case *pb.Message_RoomCreateResponse:
+		call(h.RoomCreated, m.RoomCreateResponse)
+	case *pb.Message_RoomJoinResponse:
+		call(h.RoomJoined, m.RoomJoinResponse)
+	case *pb.Message_RoomPlayers:
+		call(h.RoomPlayers, m.RoomPlayers)
+	case *pb.Message_WaitingRoomState:
+		call(h.WaitingRoom, m.WaitingRoomState)
+	case *pb.Message_GameStart:
+		call(h.GameStart, m.GameStart)
+	case *pb.Message_RoomClosed:
+		call(h.RoomClosed, m.RoomClosed)
+	case *pb.Message_InitialGameState:
+		call(h.InitialGameState, m.InitialGameState)
+	case *pb.Message_GameState:
+		call(h.GameState, m.GameState)
+	case *pb.Message_BallPosition:
+		call(h.BallPosition, m.BallPosition)
+	case *pb.Message_PaddlePositions:
+		call(h.PaddlePositions, m.PaddlePositions)
+	case *pb.Message_Score:
+		call(h.Score, m.Score)
+	case *pb.Message_GoalReplay:
+		call(h.GoalReplay, m.GoalReplay)
+	case *pb.Message_MatchEnd:
+		call(h.MatchEnd, m.MatchEnd)
+	case *pb.Message_MatchmakingStatus:
+		call(h.MatchmakingStatus, m.MatchmakingStatus)
+	case *pb.Message_MatchFound:
+		call(h.MatchFound, m.MatchFound)
+	case *pb.Message_Rating:
+		call(h.Rating, m.Rating)
+	case *pb.Message_MatchHistory:
+		call(h.MatchHistory, m.MatchHistory)
+	case *pb.Message_Chat:
+		call(h.Chat, m.Chat)
+	case *pb.Message_ReplayState:
+		call(h.ReplayState, m.ReplayState)
+	case *pb.Message_Error:
+		call(h.Error, m.Error)
+	}
+
+	call(h.Message, message)
+}
+
+func call[T any](handler func(T), message T) {
+	if handler != nil {
+		handler(message)
+	}
+}
+
+// registers a waiter for the next message of one of the types, before the
+// request that causes it is sent so the response can not be missed
+func (c *Client) expect(types ...pb.MsgType) *waiter {
+	return c.expectMatch(func(message *pb.Message) bool {
+		return slices.Contains(types, message.Type)
+	})
+}
+
+func (c *Client) expectMatch(match func(*pb.Message) bool) *waiter {
+	w := &waiter{
+		Match:  match,
+		Result: make(chan *pb.Message, 1),
+	}
+
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	if c.closed {
+		w.fail(ErrClosed)
+		return w
+	}
+
+	c.waiters = append(c.waiters, w)
+
+	return w
+}
+
+func (c *Client) forget(w *waiter) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	c.waiters = slices.DeleteFunc(c.waiters, func(other *waiter) bool {
+		return other == w
+	})
+}
+
+func (c *Client) wait(ctx context.Context, w *waiter) (*pb.Message, error) {
+	select {
+	case message, ok := <-w.Result:
+		if !ok {
+			return nil, w.Err
+		}
+		return message, nil
+
+	case <-ctx.Done():
+		c.forget(w)
+		return nil, ctx.Err()
+	}
+}
+
+// sends the message and waits for the response
+func (c *Client) request(ctx context.Context, message *pb.Message, w *waiter) (*pb.Message, error) {
+	if err := c.Send(message); err != nil {
+		c.forget(w)
+		return nil, err
+	}
+
+	return c.wait(ctx, w)
+}
+
+func (w *waiter) fail(err error) {
+	w.Err = err
+	close(w.Result)
+}
+
+// ---------------------------------------------------
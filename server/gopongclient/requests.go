@@ -0,0 +1,213 @@
+package gopongclient
+
+import (
+	"context"
+	"errors"
+	pb "github.com/mo-shahab/go-pong/proto"
+)
+
+// size of the play field sent when getting ready to play
+type Arena struct {
+	Width        float64
+	Height       float64
+	PaddleWidth  float64
+	PaddleHeight float64
+}
+
+// the arena of the browser client
+var DefaultArena = Arena{Width: 800, Height: 600, PaddleWidth: 10, PaddleHeight: 100}
+
+// paddle moves
+const (
+	Up   = "up"
+	Down = "down"
+)
+
+// ---------------------------------------------------
+// Room functions
+
+// creates a room with this client as its host and returns the room's id
+func (c *Client) CreateRoom(ctx context.Context, maxPlayers int) (string, error) {
+	response, err := c.request(ctx, &pb.Message{
+		Type: pb.MsgType_room_create_request,
+		MessageType: &pb.Message_RoomCreateRequest{
+			RoomCreateRequest: &pb.RoomCreateRequest{MaxPlayers: int32(maxPlayers)},
+		},
+	}, c.expect(pb.MsgType_room_create_response))
+	if err != nil {
+		return "", err
+	}
+
+	return response.GetRoomCreateResponse().RoomId, nil
+}
+
+// joins a room to play, or to watch if spectate is set or the room is full
+// or already playing. a refused join is returned as an error
+func (c *Client) JoinRoom(ctx context.Context, roomId string, spectate bool) (*pb.RoomJoinResponse, error) {
+	c.Mu.Lock()
+	c.joining = roomId
+	c.Mu.Unlock()
+
+	response, err := c.request(ctx, &pb.Message{
+		Type: pb.MsgType_room_join_request,
+		MessageType: &pb.Message_RoomJoinRequest{
+			RoomJoinRequest: &pb.RoomJoinRequest{RoomId: roomId, Spectate: spectate},
+		},
+	}, c.expect(pb.MsgType_room_join_response))
+	if err != nil {
+		return nil, err
+	}
+
+	joinResponse := response.GetRoomJoinResponse()
+	if !joinResponse.Success {
+		return joinResponse, errors.New(joinResponse.Error)
+	}
+
+	return joinResponse, nil
+}
+
+// asks for a bot player in the room, only the host can while in the lobby.
+// refusals arrive as an error message
+func (c *Client) AddBot(difficulty string) error {
+	return c.Send(&pb.Message{
+		Type: pb.MsgType_add_bot_request,
+		MessageType: &pb.Message_AddBotRequest{
+			AddBotRequest: &pb.AddBotRequest{Difficulty: difficulty},
+		},
+	})
+}
+
+func (c *Client) Chat(text string) error {
+	return c.Send(&pb.Message{
+		Type: pb.MsgType_chat,
+		MessageType: &pb.Message_Chat{
+			Chat: &pb.ChatMessage{Text: text},
+		},
+	})
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Game functions
+
+// joins the game of the room once it started and returns the starting
+// state, the first player to get ready sets the arena. the arena is sent
+// again after a reconnect, one out of the server's bounds is refused
+func (c *Client) Ready(ctx context.Context, arena Arena) (*pb.InitialGameStateMessage, error) {
+	init := &pb.InitMessage{
+		Width:        arena.Width,
+		Height:       arena.Height,
+		PaddleWidth:  arena.PaddleWidth,
+		PaddleHeight: arena.PaddleHeight,
+	}
+
+	c.Mu.Lock()
+	c.arena = init
+	c.Mu.Unlock()
+
+	response, err := c.request(ctx, &pb.Message{
+		Type:        pb.MsgType_init,
+		MessageType: &pb.Message_Init{Init: init},
+	}, c.expect(pb.MsgType_initial_game_state, pb.MsgType_error))
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Type == pb.MsgType_error {
+		return nil, errors.New(response.GetError().Error)
+	}
+
+	return response.GetInitialGameState(), nil
+}
+
+// moves the paddle one step, Up or Down
+func (c *Client) Move(direction string) error {
+	return c.Send(&pb.Message{
+		Type: pb.MsgType_movement,
+		MessageType: &pb.Message_Movement{
+			Movement: &pb.MovementMessage{Direction: direction},
+		},
+	})
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Matchmaking functions
+
+// queues for a match, status updates and the match arrive as events
+func (c *Client) Enqueue(ctx context.Context, mode string, teamSize int) (*pb.MatchmakingStatusMessage, error) {
+	response, err := c.request(ctx, &pb.Message{
+		Type: pb.MsgType_matchmaking_enqueue,
+		MessageType: &pb.Message_MatchmakingEnqueue{
+			MatchmakingEnqueue: &pb.MatchmakingEnqueueRequest{Mode: mode, TeamSize: int32(teamSize)},
+		},
+	}, c.expect(pb.MsgType_matchmaking_status, pb.MsgType_error))
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Type == pb.MsgType_error {
+		return nil, errors.New(response.GetError().Error)
+	}
+
+	return response.GetMatchmakingStatus(), nil
+}
+
+func (c *Client) CancelMatchmaking() error {
+	return c.Send(&pb.Message{
+		Type: pb.MsgType_matchmaking_cancel,
+		MessageType: &pb.Message_MatchmakingCancel{
+			MatchmakingCancel: &pb.MatchmakingCancelRequest{},
+		},
+	})
+}
+
+// the player's rating, an empty id for this client's own
+func (c *Client) Rating(ctx context.Context, playerId string) (*pb.RatingMessage, error) {
+	response, err := c.request(ctx, &pb.Message{
+		Type: pb.MsgType_rating_request,
+		MessageType: &pb.Message_RatingRequest{
+			RatingRequest: &pb.RatingRequest{PlayerId: playerId},
+		},
+	}, c.expect(pb.MsgType_rating))
+	if err != nil {
+		return nil, err
+	}
+
+	return response.GetRating(), nil
+}
+
+// the player's latest matches, an empty id for this client's own
+func (c *Client) MatchHistory(ctx context.Context, playerId string, limit int) (*pb.MatchHistoryMessage, error) {
+	response, err := c.request(ctx, &pb.Message{
+		Type: pb.MsgType_match_history_request,
+		MessageType: &pb.Message_MatchHistoryRequest{
+			MatchHistoryRequest: &pb.MatchHistoryRequest{PlayerId: playerId, Limit: int32(limit)},
+		},
+	}, c.expect(pb.MsgType_match_history))
+	if err != nil {
+		return nil, err
+	}
+
+	return response.GetMatchHistory(), nil
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Replay functions
+
+// controls the replay of a client connected with the Replay option, action
+// is "pause", "resume", "seek" or "speed"
+func (c *Client) ReplayControl(action string, tick int64, speed float64) error {
+	return c.Send(&pb.Message{
+		Type: pb.MsgType_replay_control,
+		MessageType: &pb.Message_ReplayControl{
+			ReplayControl: &pb.ReplayControlMessage{Action: action, Tick: tick, Speed: speed},
+		},
+	})
+}
+
+// ---------------------------------------------------
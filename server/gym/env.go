@@ -0,0 +1,330 @@
+package gym
+
+import (
+	"errors"
+	"github.com/mo-shahab/go-pong/bot"
+	"github.com/mo-shahab/go-pong/canvas"
+	"github.com/mo-shahab/go-pong/paddle"
+	"github.com/mo-shahab/go-pong/simulation"
+	"math"
+	"time"
+)
+
+// discrete actions, like a gym Discrete(3) space
+const (
+	ActionStay = 0
+	ActionUp   = 1
+	ActionDown = 2
+)
+
+// opponent that makes the agent play both sides
+const SelfPlay = "self"
+
+// length of the observation vector
+const ObservationSize = 6
+
+// only used to turn ticks into time for the bots, the environment has no
+// wall clock and steps as fast as it is asked to
+const tickInterval = 32 * time.Millisecond
+
+var (
+	ErrUnknownOpponent = errors.New("unknown opponent, use easy, medium, hard or self")
+	ErrUnknownTeam     = errors.New("unknown team, use left or right")
+	ErrInvalidAction   = errors.New("action must be 0 (stay), 1 (up) or 2 (down)")
+	ErrInvalidConfig   = errors.New("sizes, speeds, winning score, max ticks and frame skip can not be negative")
+	ErrNotReset        = errors.New("the environment has to be reset first")
+	ErrDone            = errors.New("the episode is done, reset the environment")
+)
+
+// settings of an episode, zero values fall back to DefaultConfig
+type Config struct {
+	Width          float64 `json:"width"`
+	Height         float64 `json:"height"`
+	PaddleWidth    float64 `json:"paddle_width"`
+	PaddleHeight   float64 `json:"paddle_height"`
+	BallRadius     float64 `json:"ball_radius"`
+	BallSpeed      float64 `json:"ball_speed"`
+	MaxBounceAngle float64 `json:"max_bounce_angle"` // degrees
+	PaddleStep     float64 `json:"paddle_step"`
+
+	Team         string `json:"team"`          // side the agent plays
+	Opponent     string `json:"opponent"`      // bot difficulty or "self"
+	WinningScore int32  `json:"winning_score"` // goals that end the episode
+	MaxTicks     int64  `json:"max_ticks"`     // episodes still going after this many ticks are truncated
+	FrameSkip    int    `json:"frame_skip"`    // ticks an action is repeated for
+}
+
+// the live game against a medium bot
+var DefaultConfig = Config{
+	Width:          800,
+	Height:         600,
+	PaddleWidth:    10,
+	PaddleHeight:   100,
+	BallRadius:     simulation.BallRadius,
+	BallSpeed:      simulation.BallSpeed,
+	MaxBounceAngle: simulation.MaxBounceAngle * 180 / math.Pi,
+	PaddleStep:     simulation.PaddleStep,
+	Team:           "left",
+	Opponent:       bot.Medium.Name,
+	WinningScore:   5,
+	MaxTicks:       int64(10 * time.Minute / tickInterval),
+	FrameSkip:      1,
+}
+
+type Info struct {
+	Tick       int64  `json:"tick"`
+	LeftScore  int32  `json:"left_score"`
+	RightScore int32  `json:"right_score"`
+	Hit        string `json:"hit,omitempty"`  // team that last hit the ball during the step
+	Goal       string `json:"goal,omitempty"` // team that last scored during the step
+	Winner     string `json:"winner,omitempty"`
+	Truncated  bool   `json:"truncated"` // done because MaxTicks ran out
+}
+
+// what a step returns, the opponent fields are only set in self-play
+type Step struct {
+	Observation         []float64 `json:"observation"`
+	Reward              float64   `json:"reward"`
+	Done                bool      `json:"done"`
+	Info                Info      `json:"info"`
+	OpponentObservation []float64 `json:"opponent_observation,omitempty"`
+	OpponentReward      float64   `json:"opponent_reward"`
+}
+
+// one episode of pong around the deterministic simulation, the agent gets
+// +1 for a goal and -1 for a goal against. it is not safe for concurrent use
+type Env struct {
+	Config Config
+	Sim    *simulation.Simulation
+	Bot    *bot.Bot // nil in self-play
+	Done   bool
+}
+
+// ---------------------------------------------------
+// Env functions
+
+// fills in the defaults and checks the config
+func (c Config) withDefaults() (Config, error) {
+	fields := []struct {
+		value    *float64
+		fallback float64
+	}{
+		{&c.Width, DefaultConfig.Width},
+		{&c.Height, DefaultConfig.Height},
+		{&c.PaddleWidth, DefaultConfig.PaddleWidth},
+		{&c.PaddleHeight, DefaultConfig.PaddleHeight},
+		{&c.BallRadius, DefaultConfig.BallRadius},
+		{&c.BallSpeed, DefaultConfig.BallSpeed},
+		{&c.MaxBounceAngle, DefaultConfig.MaxBounceAngle},
+		{&c.PaddleStep, DefaultConfig.PaddleStep},
+	}
+
+	for _, field := range fields {
+		if *field.value == 0 {
+			*field.value = field.fallback
+		}
+
+		if *field.value < 0 {
+			return c, ErrInvalidConfig
+		}
+	}
+
+	if c.Team == "" {
+		c.Team = DefaultConfig.Team
+	}
+	if c.Opponent == "" {
+		c.Opponent = DefaultConfig.Opponent
+	}
+	if c.WinningScore == 0 {
+		c.WinningScore = DefaultConfig.WinningScore
+	}
+	if c.MaxTicks == 0 {
+		c.MaxTicks = DefaultConfig.MaxTicks
+	}
+	if c.FrameSkip == 0 {
+		c.FrameSkip = DefaultConfig.FrameSkip
+	}
+
+	if c.Team != "left" && c.Team != "right" {
+		return c, ErrUnknownTeam
+	}
+
+	if c.WinningScore < 0 || c.MaxTicks < 0 || c.FrameSkip < 0 {
+		return c, ErrInvalidConfig
+	}
+
+	if c.Opponent != SelfPlay {
+		if _, ok := bot.ByName(c.Opponent); !ok {
+			return c, ErrUnknownOpponent
+		}
+	}
+
+	return c, nil
+}
+
+// starts a new episode and returns the first observation, the same seed,
+// config and actions always play out the same way
+func (e *Env) Reset(seed int64, config Config) ([]float64, error) {
+	config, err := config.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	arena := simulation.Arena{
+		Canvas:     canvas.Canvas{Width: config.Width, Height: config.Height},
+		Paddle:     paddle.Paddle{Width: config.PaddleWidth, Height: config.PaddleHeight},
+		BallRadius: config.BallRadius,
+	}
+
+	physics := simulation.Physics{
+		BallSpeed:      config.BallSpeed,
+		MaxBounceAngle: config.MaxBounceAngle * math.Pi / 180,
+		PaddleStep:     config.PaddleStep,
+	}
+
+	e.Config = config
+	e.Sim = simulation.NewWithPhysics(arena, physics, seed)
+	e.Bot = nil
+	e.Done = false
+
+	if config.Opponent != SelfPlay {
+		difficulty, _ := bot.ByName(config.Opponent)
+		e.Bot = bot.New(difficulty, tickInterval, uint64(seed)*2+1)
+		e.Bot.PaddleStep = physics.PaddleStep
+	}
+
+	return e.observe(config.Team), nil
+}
+
+// plays the action for FrameSkip ticks, the opponent action is only used in
+// self-play
+func (e *Env) Step(action int, opponentAction int) (Step, error) {
+	if e.Sim == nil {
+		return Step{}, ErrNotReset
+	}
+
+	if e.Done {
+		return Step{}, ErrDone
+	}
+
+	direction, err := actionDirection(action)
+	if err != nil {
+		return Step{}, err
+	}
+
+	opponentDirection, err := actionDirection(opponentAction)
+	if err != nil {
+		return Step{}, err
+	}
+
+	team := e.Config.Team
+	opponent := otherTeam(team)
+	step := Step{}
+
+	for range e.Config.FrameSkip {
+		if e.Bot != nil {
+			opponentDirection = e.Bot.Decide(opponent, e.Sim.Arena, e.Sim.State)
+		}
+
+		e.Sim.MovePaddle(team, direction)
+		e.Sim.MovePaddle(opponent, opponentDirection)
+
+		result := e.Sim.Step()
+
+		if result.Hit != "" {
+			step.Info.Hit = result.Hit
+		}
+
+		if result.Goal != "" {
+			step.Info.Goal = result.Goal
+
+			if result.Goal == team {
+				step.Reward++
+			} else {
+				step.Reward--
+			}
+
+			if e.Sim.Scores.LeftScores >= e.Config.WinningScore || e.Sim.Scores.RightScores >= e.Config.WinningScore {
+				step.Info.Winner = result.Goal
+				e.Done = true
+				break
+			}
+		}
+
+		if e.Sim.Tick >= e.Config.MaxTicks {
+			step.Info.Truncated = true
+			e.Done = true
+			break
+		}
+	}
+
+	step.Observation = e.observe(team)
+	step.Done = e.Done
+	step.Info.Tick = e.Sim.Tick
+	step.Info.LeftScore = e.Sim.Scores.LeftScores
+	step.Info.RightScore = e.Sim.Scores.RightScores
+
+	if e.Bot == nil {
+		step.OpponentObservation = e.observe(opponent)
+		step.OpponentReward = -step.Reward
+	}
+
+	return step, nil
+}
+
+// the state as seen from the team's side: ball x and y, ball dx and dy, own
+// paddle center and the opponent's paddle center. positions are scaled to
+// 0..1 and velocities to the serve speed, the right side is mirrored so one
+// policy can play either side
+func (e *Env) observe(team string) []float64 {
+	arena := e.Sim.Arena
+	state := e.Sim.State
+	speed := e.Sim.Physics.BallSpeed
+
+	x := state.Ball.X / arena.Canvas.Width
+	dx := state.Ball.Dx / speed
+	own := state.LeftPaddle
+	other := state.RightPaddle
+
+	if team == "right" {
+		x = 1 - x
+		dx = -dx
+		own, other = other, own
+	}
+
+	center := func(top float64) float64 {
+		return (top + arena.Paddle.Height/2) / arena.Canvas.Height
+	}
+
+	return []float64{
+		x,
+		state.Ball.Y / arena.Canvas.Height,
+		dx,
+		state.Ball.Dy / speed,
+		center(own),
+		center(other),
+	}
+}
+
+func actionDirection(action int) (string, error) {
+	switch action {
+	case ActionStay:
+		return "", nil
+	case ActionUp:
+		return "up", nil
+	case ActionDown:
+		return "down", nil
+	}
+
+	return "", ErrInvalidAction
+}
+
+func otherTeam(team string) string {
+	if team == "left" {
+		return "right"
+	}
+
+	return "left"
+}
+
+// ---------------------------------------------------
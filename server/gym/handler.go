@@ -0,0 +1,275 @@
+package gym
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// largest request body accepted, batches of steps can get long
+const maxBodyBytes = 1 << 20
+
+// http/json api over many environments at once, every environment steps
+// on its own so clients can drive them in parallel
+type Handler struct {
+	Mu      sync.Mutex
+	Envs    map[string]*environment
+	MaxEnvs int
+	mux     *http.ServeMux
+}
+
+// an env and the lock that serializes its requests
+type environment struct {
+	Mu  sync.Mutex
+	Env Env
+}
+
+type resetRequest struct {
+	Seed   int64   `json:"seed"`
+	Config *Config `json:"config"` // keeps the previous config on a reset if left out
+}
+
+type resetResponse struct {
+	ID          string    `json:"id"`
+	Config      Config    `json:"config"`
+	Observation []float64 `json:"observation"`
+}
+
+type stepRequest struct {
+	ID             string `json:"id"` // only used in batches
+	Action         int    `json:"action"`
+	OpponentAction int    `json:"opponent_action"`
+}
+
+type stepResponse struct {
+	ID string `json:"id"`
+	*Step
+	Error string `json:"error,omitempty"`
+}
+
+type specResponse struct {
+	ObservationSize int      `json:"observation_size"`
+	Observation     []string `json:"observation"`
+	Actions         []string `json:"actions"`
+	DefaultConfig   Config   `json:"default_config"`
+	MaxEnvs         int      `json:"max_envs"`
+}
+
+func NewHandler(maxEnvs int) *Handler {
+	h := &Handler{
+		Envs:    make(map[string]*environment),
+		MaxEnvs: maxEnvs,
+		mux:     http.NewServeMux(),
+	}
+
+	h.mux.HandleFunc("GET /spec", h.spec)
+	h.mux.HandleFunc("POST /envs", h.createEnv)
+	h.mux.HandleFunc("POST /envs/step", h.stepBatch)
+	h.mux.HandleFunc("POST /envs/{id}/reset", h.resetEnv)
+	h.mux.HandleFunc("POST /envs/{id}/step", h.stepEnv)
+	h.mux.HandleFunc("DELETE /envs/{id}", h.closeEnv)
+
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// helpers
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Println("Failed to encode the response: ", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, reason string) {
+	writeJSON(w, status, map[string]string{"error": reason})
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, value any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+
+	if err := json.NewDecoder(r.Body).Decode(value); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return false
+	}
+
+	return true
+}
+
+func (h *Handler) environment(id string) *environment {
+	h.Mu.Lock()
+	defer h.Mu.Unlock()
+
+	return h.Envs[id]
+}
+
+// ---------------------------------------------------
+// Env endpoints
+
+func (h *Handler) spec(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, specResponse{
+		ObservationSize: ObservationSize,
+		Observation:     []string{"ball_x", "ball_y", "ball_dx", "ball_dy", "paddle_y", "opponent_paddle_y"},
+		Actions:         []string{"stay", "up", "down"},
+		DefaultConfig:   DefaultConfig,
+		MaxEnvs:         h.MaxEnvs,
+	})
+}
+
+func (h *Handler) createEnv(w http.ResponseWriter, r *http.Request) {
+	request := resetRequest{}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	config := Config{}
+	if request.Config != nil {
+		config = *request.Config
+	}
+
+	env := &environment{}
+	observation, err := env.Env.Reset(request.Seed, config)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id := uuid.New().String()
+
+	h.Mu.Lock()
+	if len(h.Envs) >= h.MaxEnvs {
+		h.Mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, "too many environments, close some first")
+		return
+	}
+	h.Envs[id] = env
+	h.Mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, resetResponse{
+		ID:          id,
+		Config:      env.Env.Config,
+		Observation: observation,
+	})
+}
+
+func (h *Handler) resetEnv(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	env := h.environment(id)
+	if env == nil {
+		writeError(w, http.StatusNotFound, "environment not found")
+		return
+	}
+
+	request := resetRequest{}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	env.Mu.Lock()
+	defer env.Mu.Unlock()
+
+	config := env.Env.Config
+	if request.Config != nil {
+		config = *request.Config
+	}
+
+	observation, err := env.Env.Reset(request.Seed, config)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resetResponse{
+		ID:          id,
+		Config:      env.Env.Config,
+		Observation: observation,
+	})
+}
+
+func (h *Handler) stepEnv(w http.ResponseWriter, r *http.Request) {
+	request := stepRequest{}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	request.ID = r.PathValue("id")
+
+	response, status := h.step(request)
+	if response.Error != "" {
+		writeError(w, status, response.Error)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// steps several environments in one request to save round trips, errors
+// are reported per environment
+func (h *Handler) stepBatch(w http.ResponseWriter, r *http.Request) {
+	requests := []stepRequest{}
+	if !readJSON(w, r, &requests) {
+		return
+	}
+
+	responses := make([]stepResponse, len(requests))
+
+	var wg sync.WaitGroup
+	for i, request := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i], _ = h.step(request)
+		}()
+	}
+	wg.Wait()
+
+	writeJSON(w, http.StatusOK, responses)
+}
+
+func (h *Handler) step(request stepRequest) (stepResponse, int) {
+	response := stepResponse{ID: request.ID}
+
+	env := h.environment(request.ID)
+	if env == nil {
+		response.Error = "environment not found"
+		return response, http.StatusNotFound
+	}
+
+	env.Mu.Lock()
+	defer env.Mu.Unlock()
+
+	step, err := env.Env.Step(request.Action, request.OpponentAction)
+	if err != nil {
+		response.Error = err.Error()
+		return response, http.StatusBadRequest
+	}
+
+	response.Step = &step
+	return response, http.StatusOK
+}
+
+func (h *Handler) closeEnv(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	h.Mu.Lock()
+	_, found := h.Envs[id]
+	delete(h.Envs, id)
+	h.Mu.Unlock()
+
+	if !found {
+		writeError(w, http.StatusNotFound, "environment not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ---------------------------------------------------
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mo-shahab/go-pong/gym"
+	"log"
+	"net/http"
+	"os"
+)
+
+// gopong gym [flags]
+// serves the reinforcement learning environments over local http/json
+func gymCommand(args []string) int {
+	flags := flag.NewFlagSet("gym", flag.ContinueOnError)
+	addr := flags.String("addr", "localhost:8090", "address to listen on")
+	maxEnvs := flags.Int("max-envs", 4096, "environments that can be open at the same time")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gopong gym [flags]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() > 0 || *maxEnvs < 1 {
+		flags.Usage()
+		return 2
+	}
+
+	log.Printf("Gym environments at http://%s", *addr)
+	if err := http.ListenAndServe(*addr, gym.NewHandler(*maxEnvs)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,97 @@
+package identity
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/mo-shahab/go-pong/config"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bytes of randomness in an identity token
+const tokenBytes = 32
+
+var (
+	ErrNameTooShort   = errors.New("display name is too short")
+	ErrNameTooLong    = errors.New("display name is too long")
+	ErrNameCharacters = errors.New("display name may only contain letters, digits, spaces, '-', '_' and '.'")
+	ErrNameNotAllowed = errors.New("display name is not allowed")
+)
+
+func allowedRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == ' ' || r == '-' || r == '_' || r == '.'
+}
+
+// lower case letters and digits only, so blocklisted words can not be
+// dodged with separators or casing
+func foldName(name string) string {
+	var folded strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			folded.WriteRune(r)
+		}
+	}
+
+	return folded.String()
+}
+
+// validates a display name and returns it with surrounding and repeated
+// spaces removed
+func ValidateName(name string, rules config.Names) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+
+	length := utf8.RuneCountInString(name)
+	if length < rules.MinLength {
+		return "", ErrNameTooShort
+	}
+
+	if length > rules.MaxLength {
+		return "", ErrNameTooLong
+	}
+
+	for _, r := range name {
+		if !allowedRune(r) {
+			return "", ErrNameCharacters
+		}
+	}
+
+	folded := foldName(name)
+	for _, blocked := range rules.Blocklist {
+		blocked = foldName(blocked)
+		if blocked != "" && strings.Contains(folded, blocked) {
+			return "", ErrNameNotAllowed
+		}
+	}
+
+	return name, nil
+}
+
+// name given to players that did not pick one
+func GuestName(playerId string) string {
+	suffix := strings.ReplaceAll(playerId, "-", "")
+	if len(suffix) > 4 {
+		suffix = suffix[:4]
+	}
+
+	return fmt.Sprintf("Guest-%s", suffix)
+}
+
+// secret that lets a player restore their identity on a later connection
+func GenerateToken() (string, error) {
+	buf := make([]byte, tokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// only the hash of a token is persisted
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
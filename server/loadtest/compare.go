@@ -0,0 +1,82 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+)
+
+// a number compared between two runs
+type comparison struct {
+	Name   string
+	Before float64
+	After  float64
+}
+
+// ---------------------------------------------------
+// Compare functions
+
+// writes a table of how the run did against an earlier one, the server's
+// numbers are left out if either run could not get them
+func Compare(w io.Writer, baseline *Report, report *Report) error {
+	rows := []comparison{
+		{"clients", float64(baseline.Settings.Clients), float64(report.Settings.Clients)},
+		{"connected", float64(baseline.Connected), float64(report.Connected)},
+		{"connect failures", float64(baseline.ConnectFailures), float64(report.ConnectFailures)},
+		{"disconnects", float64(baseline.Disconnects), float64(report.Disconnects)},
+		{"matches", float64(baseline.Matches), float64(report.Matches)},
+		{"inputs", float64(baseline.Inputs), float64(report.Inputs)},
+		{"snapshots", float64(baseline.Snapshots), float64(report.Snapshots)},
+		{"client dropped", float64(baseline.ClientDropped), float64(report.ClientDropped)},
+		{"connect p50 ms", baseline.ConnectLatency.P50, report.ConnectLatency.P50},
+		{"connect p99 ms", baseline.ConnectLatency.P99, report.ConnectLatency.P99},
+		{"snapshot interval p50 ms", baseline.SnapshotInterval.P50, report.SnapshotInterval.P50},
+		{"snapshot interval p99 ms", baseline.SnapshotInterval.P99, report.SnapshotInterval.P99},
+		{"snapshot jitter mean ms", baseline.SnapshotJitter.Mean, report.SnapshotJitter.Mean},
+		{"snapshot jitter p99 ms", baseline.SnapshotJitter.P99, report.SnapshotJitter.P99},
+		{"snapshot jitter max ms", baseline.SnapshotJitter.Max, report.SnapshotJitter.Max},
+	}
+
+	if before, after := baseline.Server, report.Server; before != nil && after != nil {
+		rows = append(rows,
+			comparison{"server dropped messages", float64(before.DroppedMessages), float64(after.DroppedMessages)},
+			comparison{"server ticks", float64(before.Ticks), float64(after.Ticks)},
+			comparison{"server tick overruns", float64(before.TickOverruns), float64(after.TickOverruns)},
+			comparison{"server tick overrun %", before.TickOverrunRate * 100, after.TickOverrunRate * 100},
+			comparison{"server mean tick ms", before.MeanTickMs, after.MeanTickMs},
+			comparison{"server peak connections", float64(before.PeakConnections), float64(after.PeakConnections)},
+		)
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	fmt.Fprintf(table, "\tbaseline\tthis run\tchange\t\n")
+	for _, row := range rows {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t\n", row.Name, number(row.Before), number(row.After), change(row.Before, row.After))
+	}
+
+	return table.Flush()
+}
+
+func number(value float64) string {
+	if value == math.Trunc(value) {
+		return fmt.Sprintf("%.0f", value)
+	}
+
+	return fmt.Sprintf("%.2f", value)
+}
+
+// the relative change, or the absolute one when there was nothing before
+func change(before float64, after float64) string {
+	switch {
+	case before == after:
+		return "="
+	case before == 0:
+		return "+" + number(after)
+	}
+
+	return fmt.Sprintf("%+.1f%%", (after-before)/before*100)
+}
+
+// ---------------------------------------------------
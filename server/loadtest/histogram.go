@@ -0,0 +1,87 @@
+package loadtest
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// histogram constants
+const (
+	histogramResolution = 100 * time.Microsecond
+	histogramBuckets    = 20000 // up to two seconds, longer goes in the last bucket
+)
+
+// percentiles of a set of durations, in milliseconds
+type Latency struct {
+	Count int64   `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+// counts durations in fixed buckets so thousands of clients can add to it
+// at the same time without keeping every sample
+type histogram struct {
+	Buckets [histogramBuckets + 1]atomic.Int64
+	Count   atomic.Int64
+	Sum     atomic.Int64 // nanoseconds
+	Max     atomic.Int64
+}
+
+// ---------------------------------------------------
+// Histogram functions
+
+func (h *histogram) add(d time.Duration) {
+	d = max(d, 0)
+
+	h.Buckets[min(int(d/histogramResolution), histogramBuckets)].Add(1)
+	h.Count.Add(1)
+	h.Sum.Add(int64(d))
+
+	for {
+		longest := h.Max.Load()
+		if int64(d) <= longest || h.Max.CompareAndSwap(longest, int64(d)) {
+			return
+		}
+	}
+}
+
+// the percentiles are the upper edge of their bucket, so they are at most
+// histogramResolution off
+func (h *histogram) latency() Latency {
+	count := h.Count.Load()
+	if count == 0 {
+		return Latency{}
+	}
+
+	longest := time.Duration(h.Max.Load())
+
+	percentile := func(q float64) float64 {
+		rank := int64(q * float64(count))
+		seen := int64(0)
+		for i := range h.Buckets {
+			seen += h.Buckets[i].Load()
+			if seen > rank {
+				return milliseconds(min(time.Duration(i+1)*histogramResolution, longest))
+			}
+		}
+		return milliseconds(longest)
+	}
+
+	return Latency{
+		Count: count,
+		Mean:  milliseconds(time.Duration(h.Sum.Load() / count)),
+		P50:   percentile(0.5),
+		P90:   percentile(0.9),
+		P99:   percentile(0.99),
+		Max:   milliseconds(longest),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// ---------------------------------------------------
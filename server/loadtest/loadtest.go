@@ -0,0 +1,522 @@
+// load tests for the game server, simulated players connect through the go
+// client, play matches against each other and measure what they see
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mo-shahab/go-pong/gopongclient"
+	pb "github.com/mo-shahab/go-pong/proto"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// run constants
+const (
+	maxErrorKinds    = 20 // distinct errors kept in the report, the rest are "other"
+	progressInterval = 5 * time.Second
+	retryDelay       = time.Second // before a room that failed to start tries again
+	turnChance       = 0.3         // of a player changing direction on an input
+)
+
+type Config struct {
+	URL        string // websocket endpoint, like ws://localhost:8080/ws
+	MetricsURL string // the server's metrics, next to URL if empty
+
+	Rooms    int
+	RoomSize int // players per room, the game starts once it is full
+
+	Ramp      time.Duration // the rooms start spread over it
+	Duration  time.Duration // of the whole run, ramp included
+	InputRate float64       // moves a player sends per second
+
+	TickInterval time.Duration // the server's, snapshots are expected this often
+	Seed         uint64        // for the players' inputs
+}
+
+// what the run was made with, kept in the report so runs can be compared
+type Settings struct {
+	URL             string  `json:"url"`
+	Rooms           int     `json:"rooms"`
+	RoomSize        int     `json:"room_size"`
+	Clients         int     `json:"clients"`
+	RampSeconds     float64 `json:"ramp_seconds"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	InputRate       float64 `json:"input_rate"`
+	TickMs          float64 `json:"tick_ms"`
+	Seed            uint64  `json:"seed"`
+}
+
+// what the server counted during the run
+type ServerMetrics struct {
+	DroppedMessages int64   `json:"dropped_messages"`
+	Ticks           int64   `json:"ticks"`
+	TickOverruns    int64   `json:"tick_overruns"`
+	TickOverrunRate float64 `json:"tick_overrun_rate"`
+	MeanTickMs      float64 `json:"mean_tick_ms"`
+	MaxTickMs       float64 `json:"max_tick_ms"` // since the server started
+	PeakConnections int     `json:"peak_connections"`
+	PeakGames       int     `json:"peak_games"`
+}
+
+type Report struct {
+	Settings  Settings  `json:"settings"`
+	StartedAt time.Time `json:"started_at"`
+	Seconds   float64   `json:"seconds"`
+
+	Connected       int64 `json:"connected"` // connections made, every match has new players
+	ConnectFailures int64 `json:"connect_failures"`
+	Disconnects     int64 `json:"disconnects"` // connections the server dropped
+	Matches         int64 `json:"matches"`     // played to the end
+	Inputs          int64 `json:"inputs"`
+	Snapshots       int64 `json:"snapshots"`
+	ClientDropped   int64 `json:"client_dropped"` // events the clients could not keep up with
+
+	ConnectLatency   Latency `json:"connect_latency_ms"`
+	SnapshotInterval Latency `json:"snapshot_interval_ms"`
+	SnapshotJitter   Latency `json:"snapshot_jitter_ms"` // distance of the interval from a tick
+
+	Server *ServerMetrics `json:"server,omitempty"`
+	Errors map[string]int `json:"errors,omitempty"`
+}
+
+// the state shared by every room of a run
+type run struct {
+	Config Config
+
+	ConnectLatency   histogram
+	SnapshotInterval histogram
+	SnapshotJitter   histogram
+
+	Connected       atomic.Int64
+	ConnectFailures atomic.Int64
+	Disconnects     atomic.Int64
+	Matches         atomic.Int64
+	Inputs          atomic.Int64
+	Snapshots       atomic.Int64
+	ClientDropped   atomic.Int64
+	Playing         atomic.Int64 // rooms in a match right now
+
+	Mu              sync.Mutex
+	Errors          map[string]int
+	PeakConnections int
+	PeakGames       int
+}
+
+// one simulated player
+type player struct {
+	Client  *gopongclient.Client
+	Started chan struct{} // the room's game started
+	Ended   chan struct{} // the match is over
+
+	// only used on the client's read goroutine
+	lastBall time.Time
+	skip     int // snapshots that are not timed
+}
+
+// ---------------------------------------------------
+// Run functions
+
+// plays matches in the rooms until the duration is over or ctx is done
+func Run(ctx context.Context, config Config) (*Report, error) {
+	if config.Rooms < 1 || config.RoomSize < 2 {
+		return nil, errors.New("loadtest: needs a room and two players per room")
+	}
+
+	if config.MetricsURL == "" {
+		metricsURL, err := metricsNextTo(config.URL)
+		if err != nil {
+			return nil, err
+		}
+		config.MetricsURL = metricsURL
+	}
+
+	r := &run{
+		Config: config,
+		Errors: make(map[string]int),
+	}
+
+	before, err := fetchMetrics(ctx, config.MetricsURL)
+	if err != nil {
+		log.Printf("No server metrics from %s, only the clients are measured: %v", config.MetricsURL, err)
+	}
+
+	startedAt := time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, config.Duration)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := range config.Rooms {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// spread over the ramp so the server is not hit all at once
+			delay := time.Duration(float64(config.Ramp) * float64(i) / float64(config.Rooms))
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+
+			r.room(ctx, i)
+		}()
+	}
+
+	done := make(chan struct{})
+	go r.progress(ctx, done, before != nil)
+
+	wg.Wait()
+	close(done)
+
+	report := r.report(startedAt)
+
+	if before != nil {
+		// the counters only go up, so a restarted server shows up as an error
+		after, err := fetchMetrics(context.Background(), config.MetricsURL)
+		if err != nil || after.Ticks < before.Ticks {
+			log.Printf("Failed to get the server metrics after the run: %v", err)
+		} else {
+			report.Server = r.serverMetrics(before, after)
+		}
+	}
+
+	return report, nil
+}
+
+// logs how far the run is every few seconds and keeps the server's peaks
+func (r *run) progress(ctx context.Context, done chan struct{}, server bool) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		line := ""
+		if server {
+			if snapshot, err := fetchMetrics(ctx, r.Config.MetricsURL); err == nil {
+				r.Mu.Lock()
+				r.PeakConnections = max(r.PeakConnections, snapshot.Connections)
+				r.PeakGames = max(r.PeakGames, snapshot.Games)
+				r.Mu.Unlock()
+
+				line = fmt.Sprintf(", server has %d connections and %d games", snapshot.Connections, snapshot.Games)
+			}
+		}
+
+		log.Printf("%d rooms playing, %d matches played, %d connect failures%s",
+			r.Playing.Load(), r.Matches.Load(), r.ConnectFailures.Load(), line)
+	}
+}
+
+func (r *run) report(startedAt time.Time) *Report {
+	config := r.Config
+
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+
+	return &Report{
+		Settings: Settings{
+			URL:             config.URL,
+			Rooms:           config.Rooms,
+			RoomSize:        config.RoomSize,
+			Clients:         config.Rooms * config.RoomSize,
+			RampSeconds:     config.Ramp.Seconds(),
+			DurationSeconds: config.Duration.Seconds(),
+			InputRate:       config.InputRate,
+			TickMs:          milliseconds(config.TickInterval),
+			Seed:            config.Seed,
+		},
+		StartedAt: startedAt.UTC(),
+		Seconds:   time.Since(startedAt).Seconds(),
+
+		Connected:       r.Connected.Load(),
+		ConnectFailures: r.ConnectFailures.Load(),
+		Disconnects:     r.Disconnects.Load(),
+		Matches:         r.Matches.Load(),
+		Inputs:          r.Inputs.Load(),
+		Snapshots:       r.Snapshots.Load(),
+		ClientDropped:   r.ClientDropped.Load(),
+
+		ConnectLatency:   r.ConnectLatency.latency(),
+		SnapshotInterval: r.SnapshotInterval.latency(),
+		SnapshotJitter:   r.SnapshotJitter.latency(),
+
+		Errors: r.Errors,
+	}
+}
+
+func (r *run) serverMetrics(before *metricsSnapshot, after *metricsSnapshot) *ServerMetrics {
+	ticks := after.Ticks - before.Ticks
+
+	metrics := &ServerMetrics{
+		DroppedMessages: after.DroppedMessages - before.DroppedMessages,
+		Ticks:           ticks,
+		TickOverruns:    after.TickOverruns - before.TickOverruns,
+		MaxTickMs:       after.MaxTickMs,
+	}
+
+	if ticks > 0 {
+		metrics.TickOverrunRate = float64(metrics.TickOverruns) / float64(ticks)
+		metrics.MeanTickMs = (after.TickSeconds - before.TickSeconds) * 1000 / float64(ticks)
+	}
+
+	r.Mu.Lock()
+	metrics.PeakConnections = max(r.PeakConnections, before.Connections, after.Connections)
+	metrics.PeakGames = max(r.PeakGames, before.Games, after.Games)
+	r.Mu.Unlock()
+
+	return metrics
+}
+
+// counts an error by its message, so a flood of the same failure is one line
+// of the report
+func (r *run) fail(stage string, err error) {
+	kind := stage + ": " + err.Error()
+
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+
+	if _, seen := r.Errors[kind]; !seen && len(r.Errors) >= maxErrorKinds {
+		kind = "other"
+	}
+	r.Errors[kind]++
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Room functions
+
+// plays one match after another with new players, like a room of a busy
+// server would see
+func (r *run) room(ctx context.Context, index int) {
+	rng := rand.New(rand.NewPCG(r.Config.Seed, uint64(index)))
+
+	for ctx.Err() == nil {
+		if r.match(ctx, rng) {
+			continue
+		}
+
+		select {
+		case <-time.After(retryDelay):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// connects the players, puts them in a room and plays until the match is
+// over. returns false if the match could not start
+func (r *run) match(ctx context.Context, rng *rand.Rand) bool {
+	players := []*player{}
+	defer func() {
+		for _, p := range players {
+			r.ClientDropped.Add(p.Client.Dropped.Load())
+			p.Client.Close()
+		}
+	}()
+
+	for range r.Config.RoomSize {
+		p, err := r.connect(ctx)
+		if err != nil {
+			return false
+		}
+		players = append(players, p)
+	}
+
+	host := players[0].Client
+
+	roomId, err := host.CreateRoom(ctx, r.Config.RoomSize)
+	if err != nil {
+		r.stageFailed(ctx, "create room", err)
+		return false
+	}
+
+	for _, p := range players[1:] {
+		if _, err := p.Client.JoinRoom(ctx, roomId, false); err != nil {
+			r.stageFailed(ctx, "join room", err)
+			return false
+		}
+	}
+
+	for _, p := range players {
+		if err := p.wait(ctx, p.Started); err != nil {
+			r.stageFailed(ctx, "game start", err)
+			return false
+		}
+
+		if _, err := p.Client.Ready(ctx, gopongclient.DefaultArena); err != nil {
+			r.stageFailed(ctx, "ready", err)
+			return false
+		}
+	}
+
+	r.Playing.Add(1)
+	defer r.Playing.Add(-1)
+
+	var wg sync.WaitGroup
+	for _, p := range players {
+		seed := rng.Uint64()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.play(ctx, p, rand.New(rand.NewPCG(seed, 0)))
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case <-players[0].Ended:
+		r.Matches.Add(1)
+	default:
+	}
+
+	return true
+}
+
+// connects a guest player and times it from dialing to being identified
+func (r *run) connect(ctx context.Context) (*player, error) {
+	p := &player{
+		Started: make(chan struct{}, 1),
+		Ended:   make(chan struct{}, 1),
+	}
+
+	p.Client = gopongclient.New(gopongclient.Options{URL: r.Config.URL})
+	p.Client.Handlers = gopongclient.Handlers{
+		Disconnected: func(err error) {
+			r.Disconnects.Add(1)
+		},
+		GameStart: func(*pb.GameStartMessage) {
+			signal(p.Started)
+		},
+		BallPosition: func(*pb.BallPositionMessage) {
+			r.snapshot(p, time.Now())
+		},
+		Score: func(*pb.ScoreMessage) {
+			// the ball waits after a goal and the tick that queued up while
+			// it did comes right after, neither gap is jitter
+			p.skip = 2
+		},
+		MatchEnd: func(*pb.MatchEndMessage) {
+			signal(p.Ended)
+		},
+		Error: func(message *pb.ErrorMessage) {
+			r.fail("server", errors.New(message.Error))
+		},
+	}
+
+	start := time.Now()
+	if err := p.Client.Connect(ctx); err != nil {
+		if ctx.Err() == nil {
+			r.ConnectFailures.Add(1)
+			r.fail("connect", err)
+		}
+		return nil, err
+	}
+
+	r.ConnectLatency.add(time.Since(start))
+	r.Connected.Add(1)
+
+	return p, nil
+}
+
+// failures caused by the end of the run are not counted
+func (r *run) stageFailed(ctx context.Context, stage string, err error) {
+	if ctx.Err() == nil {
+		r.fail(stage, err)
+	}
+}
+
+// sends moves at about the input rate until the match is over, a player
+// keeps going one way for a while like someone holding a key. the end of
+// the match is signalled again for whoever checks it next
+func (r *run) play(ctx context.Context, p *player, rng *rand.Rand) {
+	var next <-chan time.Time
+	interval := 0.0
+
+	if r.Config.InputRate > 0 {
+		interval = float64(time.Second) / r.Config.InputRate
+		next = time.After(time.Duration(interval * rng.Float64()))
+	}
+
+	direction := gopongclient.Up
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.Ended:
+			signal(p.Ended)
+			return
+		case <-p.Client.Done():
+			return
+		case <-next:
+		}
+
+		if rng.Float64() < turnChance {
+			if direction == gopongclient.Up {
+				direction = gopongclient.Down
+			} else {
+				direction = gopongclient.Up
+			}
+		}
+
+		if err := p.Client.Move(direction); err != nil {
+			return
+		}
+		r.Inputs.Add(1)
+
+		// half to one and a half intervals apart, people are not metronomes
+		next = time.After(time.Duration(interval * (0.5 + rng.Float64())))
+	}
+}
+
+// times a ball position against the one before it
+func (r *run) snapshot(p *player, now time.Time) {
+	r.Snapshots.Add(1)
+
+	if p.skip > 0 {
+		p.skip--
+	} else if !p.lastBall.IsZero() {
+		interval := now.Sub(p.lastBall)
+		jitter := interval - r.Config.TickInterval
+		if jitter < 0 {
+			jitter = -jitter
+		}
+
+		r.SnapshotInterval.add(interval)
+		r.SnapshotJitter.add(jitter)
+	}
+
+	p.lastBall = now
+}
+
+func (p *player) wait(ctx context.Context, event chan struct{}) error {
+	select {
+	case <-event:
+		return nil
+	case <-p.Client.Done():
+		return gopongclient.ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func signal(event chan struct{}) {
+	select {
+	case event <- struct{}{}:
+	default:
+	}
+}
+
+// ---------------------------------------------------
@@ -0,0 +1,83 @@
+package loadtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// metrics constants
+const (
+	metricsPath    = "/debug/metrics"
+	metricsTimeout = 5 * time.Second
+)
+
+// the server's answer on /debug/metrics
+type metricsSnapshot struct {
+	Time            time.Time `json:"time"`
+	Connections     int       `json:"connections"`
+	Rooms           int       `json:"rooms"`
+	Games           int       `json:"games"`
+	DroppedMessages int64     `json:"dropped_messages"`
+	Ticks           int64     `json:"ticks"`
+	TickOverruns    int64     `json:"tick_overruns"`
+	TickSeconds     float64   `json:"tick_seconds"`
+	MaxTickMs       float64   `json:"max_tick_ms"`
+}
+
+// ---------------------------------------------------
+// Metrics functions
+
+// the metrics endpoint of the server behind a websocket url
+func metricsNextTo(websocketURL string) (string, error) {
+	endpoint, err := url.Parse(websocketURL)
+	if err != nil {
+		return "", err
+	}
+
+	switch endpoint.Scheme {
+	case "ws":
+		endpoint.Scheme = "http"
+	case "wss":
+		endpoint.Scheme = "https"
+	default:
+		return "", fmt.Errorf("loadtest: %q is not a websocket url", websocketURL)
+	}
+
+	endpoint.Path = metricsPath
+	endpoint.RawQuery = ""
+
+	return endpoint.String(), nil
+}
+
+func fetchMetrics(ctx context.Context, metricsURL string) (*metricsSnapshot, error) {
+	ctx, cancel := context.WithTimeout(ctx, metricsTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, metricsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("loadtest: metrics answered %s", response.Status)
+	}
+
+	snapshot := &metricsSnapshot{}
+	if err := json.NewDecoder(response.Body).Decode(snapshot); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// ---------------------------------------------------
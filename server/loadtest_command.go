@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/mo-shahab/go-pong/loadtest"
+	"github.com/mo-shahab/go-pong/wsserver"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// gopong loadtest [flags]
+// plays matches against a running server with simulated players and reports
+// what they measured, compared to an earlier report if one is given
+func loadtestCommand(args []string) int {
+	flags := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	url := flags.String("url", "ws://localhost:8080/ws", "websocket endpoint of the server")
+	metricsURL := flags.String("metrics-url", "", "the server's metrics endpoint, /debug/metrics next to -url if empty")
+	rooms := flags.Int("rooms", 100, "rooms playing at the same time")
+	roomSize := flags.Int("room-size", 2, "players per room")
+	ramp := flags.Duration("ramp", 10*time.Second, "time over which the rooms start")
+	duration := flags.Duration("duration", time.Minute, "length of the run, ramp included")
+	inputRate := flags.Float64("input-rate", 8, "moves a player sends per second")
+	seed := flags.Uint64("seed", 1, "seed of the players' inputs")
+	out := flags.String("out", "", "file to write the report to instead of stdout")
+	compare := flags.String("compare", "", "earlier report to compare the run to, the table goes to stderr")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gopong loadtest [flags]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if *rooms < 1 || *roomSize < 2 || *duration <= 0 || *ramp < 0 || *inputRate < 0 {
+		fmt.Fprintln(os.Stderr, "-rooms and -duration must be positive, -room-size at least 2")
+		return 2
+	}
+
+	// read before the run so a typo does not waste it
+	var baseline *loadtest.Report
+	if *compare != "" {
+		data, err := os.ReadFile(*compare)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		baseline = &loadtest.Report{}
+		if err := json.Unmarshal(data, baseline); err != nil {
+			fmt.Fprintf(os.Stderr, "%s is not a loadtest report: %v\n", *compare, err)
+			return 1
+		}
+	}
+
+	// ctrl-c ends the run early, the report covers what was played
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := loadtest.Run(ctx, loadtest.Config{
+		URL:          *url,
+		MetricsURL:   *metricsURL,
+		Rooms:        *rooms,
+		RoomSize:     *roomSize,
+		Ramp:         *ramp,
+		Duration:     *duration,
+		InputRate:    *inputRate,
+		TickInterval: wsserver.BallTickInterval,
+		Seed:         *seed,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if baseline != nil {
+		if err := loadtest.Compare(os.Stderr, baseline, report); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	return 0
+}
@@ -1,19 +1,104 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/mo-shahab/go-pong/api"
+	"github.com/mo-shahab/go-pong/auth"
+	"github.com/mo-shahab/go-pong/config"
+	"github.com/mo-shahab/go-pong/store"
 	"github.com/mo-shahab/go-pong/wsserver"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// how long requests in flight get to finish when the server is stopped
+const shutdownTimeout = 5 * time.Second
+
 func main() {
-	wsh := wsserver.NewWebSocketHandler()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(replayCommand(os.Args[2:]))
+		case "simulate":
+			os.Exit(simulateCommand(os.Args[2:]))
+		case "gym":
+			os.Exit(gymCommand(os.Args[2:]))
+		case "tui":
+			os.Exit(tuiCommand(os.Args[2:]))
+		case "loadtest":
+			os.Exit(loadtestCommand(os.Args[2:]))
+		case "netem-proxy":
+			os.Exit(netemProxyCommand(os.Args[2:]))
+		}
+	}
+
+	dataDir := flag.String("data", "data", "directory for the persistent store")
+	configPath := flag.String("config", "", "path to the JSON config file")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalln("Failed to load the config: ", err)
+	}
+
+	st, err := store.OpenFileStore(*dataDir)
+	if err != nil {
+		log.Fatalln("Failed to open the store: ", err)
+	}
+
+	authService, err := auth.NewService(cfg.Auth, cfg.Names, st)
+	if err != nil {
+		st.Close()
+		log.Fatalln("Failed to set up authentication: ", err)
+	}
+
+	wsh := wsserver.NewWebSocketHandler(cfg, st, authService)
 
 	// no need to server files on http now
 	// fs := http.FileServer(http.Dir("../client/"))
 	// http.Handle("/", fs)
 
 	http.Handle("/ws", wsh)
+	http.HandleFunc("GET /rooms/{id}/events", wsh.ServeRoomEvents)
+	http.HandleFunc("GET /rooms/{id}/thumbnail.png", wsh.ServeRoomThumbnail)
+	http.HandleFunc("GET /debug/metrics", wsh.ServeMetrics)
+	http.Handle("/api/", api.NewHandler(st, wsh.Ratings, authService))
+
+	// the store is closed once the server has stopped, log.Fatal would skip it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: ":8080"}
+	served := make(chan error, 1)
+
 	log.Println("Server starting at http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	go func() {
+		served <- server.ListenAndServe()
+	}()
+
+	select {
+	case err = <-served:
+		log.Println("Server stopped: ", err)
+
+	case <-ctx.Done():
+		log.Println("Shutting down the server")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		err = server.Shutdown(shutdownCtx)
+		cancel()
+	}
+
+	if closeErr := st.Close(); closeErr != nil {
+		log.Println("Failed to close the store: ", closeErr)
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,116 @@
+package match
+
+import (
+	"github.com/mo-shahab/go-pong/bot"
+	"github.com/mo-shahab/go-pong/scores"
+	"github.com/mo-shahab/go-pong/simulation"
+	"math"
+	"time"
+)
+
+// width of the ball speed histogram buckets in pixels per second
+const SpeedBucket = 50
+
+// settings of a headless match between two bots
+type Config struct {
+	Arena        simulation.Arena
+	Physics      simulation.Physics
+	Left         bot.Difficulty
+	Right        bot.Difficulty
+	WinningScore int32
+	TickInterval time.Duration // only used to turn ticks into time
+	MaxTicks     int64         // a match still going after this many ticks is a draw
+}
+
+// play from a serve to the goal that ended it
+type Rally struct {
+	Hits  int
+	Ticks int64
+}
+
+// what happened in a headless match, there is no pause after goals so all
+// the ticks are play
+type Result struct {
+	Seed    int64
+	Winner  string // "left", "right" or empty if MaxTicks ran out
+	Scores  scores.Scores
+	Ticks   int64
+	Rallies []Rally
+
+	// ball speed in pixels per second, sampled every tick
+	SpeedSum   float64
+	SpeedMax   float64
+	SpeedCount int64
+	Speeds     []int64 // histogram, bucket i counts speeds from i*SpeedBucket
+}
+
+// ---------------------------------------------------
+// Match functions
+
+// plays a whole match as fast as it can, the same config and seed always
+// give the same result
+func Play(config Config, seed int64) Result {
+	sim := simulation.NewWithPhysics(config.Arena, config.Physics, seed)
+
+	left := bot.New(config.Left, config.TickInterval, uint64(seed)*2)
+	right := bot.New(config.Right, config.TickInterval, uint64(seed)*2+1)
+	left.PaddleStep = config.Physics.PaddleStep
+	right.PaddleStep = config.Physics.PaddleStep
+
+	ticksPerSecond := float64(time.Second) / float64(config.TickInterval)
+
+	result := Result{Seed: seed}
+	rally := Rally{}
+
+	for sim.Tick < config.MaxTicks {
+		if direction := left.Decide("left", sim.Arena, sim.State); direction != "" {
+			sim.MovePaddle("left", direction)
+		}
+
+		if direction := right.Decide("right", sim.Arena, sim.State); direction != "" {
+			sim.MovePaddle("right", direction)
+		}
+
+		step := sim.Step()
+		rally.Ticks++
+
+		if step.Hit != "" {
+			rally.Hits++
+		}
+
+		if step.Goal != "" {
+			result.Rallies = append(result.Rallies, rally)
+			rally = Rally{}
+
+			if sim.Scores.LeftScores >= config.WinningScore || sim.Scores.RightScores >= config.WinningScore {
+				result.Winner = step.Goal
+				break
+			}
+
+			continue
+		}
+
+		speed := math.Hypot(sim.Ball.Dx, sim.Ball.Dy) * ticksPerSecond
+		result.sampleSpeed(speed)
+	}
+
+	result.Scores = sim.Scores
+	result.Ticks = sim.Tick
+
+	return result
+}
+
+func (r *Result) sampleSpeed(speed float64) {
+	r.SpeedSum += speed
+	r.SpeedCount++
+	r.SpeedMax = max(r.SpeedMax, speed)
+
+	bucket := int(speed / SpeedBucket)
+	for len(r.Speeds) <= bucket {
+		r.Speeds = append(r.Speeds, 0)
+	}
+
+	r.Speeds[bucket]++
+}
+
+// ---------------------------------------------------
@@ -0,0 +1,150 @@
+package match
+
+import (
+	"math"
+	"time"
+)
+
+// share of the simulated matches one side won
+type Side struct {
+	Bot     string  `json:"bot"`
+	Wins    int     `json:"wins"`
+	WinRate float64 `json:"win_rate"`
+}
+
+type SpeedBucketCount struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Ticks int64   `json:"ticks"`
+}
+
+// ball speeds in pixels per second, the percentiles are as precise as the
+// histogram buckets
+type SpeedStats struct {
+	Mean      float64            `json:"mean"`
+	P50       float64            `json:"p50"`
+	P90       float64            `json:"p90"`
+	Max       float64            `json:"max"`
+	Histogram []SpeedBucketCount `json:"histogram"`
+}
+
+// aggregate statistics of many headless matches
+type Summary struct {
+	Matches             int        `json:"matches"`
+	Draws               int        `json:"draws"`
+	Left                Side       `json:"left"`
+	Right               Side       `json:"right"`
+	Rallies             int        `json:"rallies"`
+	AverageRallyHits    float64    `json:"average_rally_hits"`
+	AverageRallySeconds float64    `json:"average_rally_seconds"`
+	LongestRallyHits    int        `json:"longest_rally_hits"`
+	GoalsPerMinute      float64    `json:"goals_per_minute"`
+	AverageMatchSeconds float64    `json:"average_match_seconds"`
+	BallSpeed           SpeedStats `json:"ball_speed"`
+}
+
+// ---------------------------------------------------
+// Summary functions
+
+func Summarize(config Config, results []Result) Summary {
+	summary := Summary{
+		Matches: len(results),
+		Left:    Side{Bot: config.Left.Name},
+		Right:   Side{Bot: config.Right.Name},
+	}
+
+	var ticks, rallyTicks int64
+	var rallyHits, goals int
+	var speedSum float64
+	var speedCount int64
+	speeds := []int64{}
+
+	for _, result := range results {
+		switch result.Winner {
+		case "left":
+			summary.Left.Wins++
+		case "right":
+			summary.Right.Wins++
+		default:
+			summary.Draws++
+		}
+
+		ticks += result.Ticks
+		goals += int(result.Scores.LeftScores + result.Scores.RightScores)
+
+		for _, rally := range result.Rallies {
+			summary.Rallies++
+			rallyHits += rally.Hits
+			rallyTicks += rally.Ticks
+			summary.LongestRallyHits = max(summary.LongestRallyHits, rally.Hits)
+		}
+
+		speedSum += result.SpeedSum
+		speedCount += result.SpeedCount
+		summary.BallSpeed.Max = max(summary.BallSpeed.Max, result.SpeedMax)
+
+		for i, count := range result.Speeds {
+			for len(speeds) <= i {
+				speeds = append(speeds, 0)
+			}
+			speeds[i] += count
+		}
+	}
+
+	seconds := func(ticks int64) float64 {
+		return (time.Duration(ticks) * config.TickInterval).Seconds()
+	}
+
+	if summary.Matches > 0 {
+		summary.Left.WinRate = float64(summary.Left.Wins) / float64(summary.Matches)
+		summary.Right.WinRate = float64(summary.Right.Wins) / float64(summary.Matches)
+		summary.AverageMatchSeconds = seconds(ticks) / float64(summary.Matches)
+	}
+
+	if summary.Rallies > 0 {
+		summary.AverageRallyHits = float64(rallyHits) / float64(summary.Rallies)
+		summary.AverageRallySeconds = seconds(rallyTicks) / float64(summary.Rallies)
+	}
+
+	if ticks > 0 {
+		summary.GoalsPerMinute = float64(goals) / (seconds(ticks) / 60)
+	}
+
+	if speedCount > 0 {
+		summary.BallSpeed.Mean = speedSum / float64(speedCount)
+		summary.BallSpeed.P50 = percentile(speeds, speedCount, 0.5)
+		summary.BallSpeed.P90 = percentile(speeds, speedCount, 0.9)
+	}
+
+	summary.BallSpeed.Histogram = []SpeedBucketCount{}
+	for i, count := range speeds {
+		if count == 0 {
+			continue
+		}
+
+		summary.BallSpeed.Histogram = append(summary.BallSpeed.Histogram, SpeedBucketCount{
+			From:  float64(i * SpeedBucket),
+			To:    float64((i + 1) * SpeedBucket),
+			Ticks: count,
+		})
+	}
+
+	return summary
+}
+
+// upper edge of the bucket the percentile falls in
+func percentile(histogram []int64, total int64, p float64) float64 {
+	wanted := int64(math.Ceil(p * float64(total)))
+	seen := int64(0)
+
+	for i, count := range histogram {
+		seen += count
+		if seen >= wanted {
+			return float64((i + 1) * SpeedBucket)
+		}
+	}
+
+	return float64(len(histogram) * SpeedBucket)
+}
+
+// ---------------------------------------------------
@@ -0,0 +1,381 @@
+package matchmaking
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/mo-shahab/go-pong/client"
+	"github.com/mo-shahab/go-pong/clock"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// queue modes
+const (
+	ModeCasual = "casual"
+	ModeRanked = "ranked"
+)
+
+// queue constants
+const (
+	MaxTeamSize   = 5
+	matchInterval = 1 * time.Second
+
+	// used for the estimate until we have seen a few matches for a bucket
+	defaultWaitEstimate = 30 * time.Second
+	// weight given to the latest wait time in the moving average
+	waitSmoothing = 0.2
+)
+
+// skill window constants, the window is in rating points and grows with
+// the time a ticket has spent in the queue
+const (
+	initialSkillWindow = 100.0
+	skillWindowGrowth  = 10.0
+	maxSkillWindow     = 800.0
+)
+
+var (
+	ErrInvalidMode     = errors.New("invalid matchmaking mode")
+	ErrInvalidTeamSize = errors.New("invalid team size")
+	ErrAlreadyQueued   = errors.New("already in the matchmaking queue")
+	ErrAlreadyInRoom   = errors.New("already in a room")
+)
+
+// a player waiting in the queue
+type Ticket struct {
+	ID         string
+	Client     *client.Client
+	Mode       string
+	TeamSize   int
+	Rating     float64
+	HasRating  bool
+	EnqueuedAt time.Time
+}
+
+// state of the matchmaking queue
+type Queue struct {
+	Tickets map[string]*Ticket // keyed by client id
+
+	// optional, returns the rating of a client once ratings exist
+	RatingOf func(c *client.Client) (float64, bool)
+
+	// called with every group of compatible tickets, the tickets are already
+	// removed from the queue at that point
+	OnMatch func(tickets []*Ticket)
+
+	// called every matchmaking pass for each ticket that is still waiting
+	OnUpdate func(ticket *Ticket, queued int, estimate time.Duration)
+
+	// wait times and skill windows are measured on it, changing it only
+	// moves the passes over after a Stop and Start
+	Clock clock.Clock
+
+	averageWaits map[string]time.Duration
+	ticker       clock.Ticker
+	stop         chan struct{}
+	Mu           sync.Mutex
+}
+
+func NewQueue() *Queue {
+	return &Queue{
+		Tickets:      make(map[string]*Ticket),
+		Clock:        clock.Real{},
+		averageWaits: make(map[string]time.Duration),
+	}
+}
+
+// helpers
+func generateTicketId() string {
+	return uuid.New().String()[:8]
+}
+
+func bucketKey(mode string, teamSize int) string {
+	return fmt.Sprintf("%s/%d", mode, teamSize)
+}
+
+func validMode(mode string) bool {
+	return mode == ModeCasual || mode == ModeRanked
+}
+
+func (t *Ticket) playersNeeded() int {
+	return t.TeamSize * 2
+}
+
+func (t *Ticket) skillWindow(now time.Time) float64 {
+	waited := now.Sub(t.EnqueuedAt).Seconds()
+	return math.Min(initialSkillWindow+skillWindowGrowth*waited, maxSkillWindow)
+}
+
+// checks if the candidate fits the skill window of the anchor, tickets
+// without a rating are compatible with everyone
+func (t *Ticket) compatible(candidate *Ticket, now time.Time) bool {
+	if t.Mode != candidate.Mode || t.TeamSize != candidate.TeamSize {
+		return false
+	}
+
+	if !t.HasRating || !candidate.HasRating {
+		return true
+	}
+
+	return math.Abs(t.Rating-candidate.Rating) <= t.skillWindow(now)
+}
+
+func (q *Queue) Enqueue(c *client.Client, mode string, teamSize int) (*Ticket, error) {
+	if mode == "" {
+		mode = ModeCasual
+	}
+
+	if !validMode(mode) {
+		return nil, ErrInvalidMode
+	}
+
+	if teamSize < 1 || teamSize > MaxTeamSize {
+		return nil, ErrInvalidTeamSize
+	}
+
+	if c.RoomId != "" {
+		return nil, ErrAlreadyInRoom
+	}
+
+	q.Mu.Lock()
+	defer q.Mu.Unlock()
+
+	if _, exists := q.Tickets[c.ID]; exists {
+		return nil, ErrAlreadyQueued
+	}
+
+	ticket := &Ticket{
+		ID:         generateTicketId(),
+		Client:     c,
+		Mode:       mode,
+		TeamSize:   teamSize,
+		EnqueuedAt: q.Clock.Now(),
+	}
+
+	if q.RatingOf != nil {
+		ticket.Rating, ticket.HasRating = q.RatingOf(c)
+	}
+
+	q.Tickets[c.ID] = ticket
+	log.Printf("Client %s queued for %s %dv%d", c.ID, mode, teamSize, teamSize)
+
+	return ticket, nil
+}
+
+// removes the client from the queue, returns the cancelled ticket if there
+// was one
+func (q *Queue) Cancel(clientId string) (*Ticket, bool) {
+	q.Mu.Lock()
+	defer q.Mu.Unlock()
+
+	ticket, exists := q.Tickets[clientId]
+	if !exists {
+		return nil, false
+	}
+
+	delete(q.Tickets, clientId)
+	log.Printf("Client %s left the matchmaking queue", clientId)
+
+	return ticket, true
+}
+
+// puts the tickets of a match that fell through back in the queue, they
+// keep their place. a client that has queued again since keeps the new ticket
+func (q *Queue) Requeue(tickets []*Ticket) {
+	q.Mu.Lock()
+	defer q.Mu.Unlock()
+
+	for _, ticket := range tickets {
+		if _, exists := q.Tickets[ticket.Client.ID]; exists {
+			continue
+		}
+
+		q.Tickets[ticket.Client.ID] = ticket
+	}
+}
+
+// number of tickets waiting for the same mode and team size
+func (q *Queue) Queued(mode string, teamSize int) int {
+	q.Mu.Lock()
+	defer q.Mu.Unlock()
+
+	return q.queued(mode, teamSize)
+}
+
+func (q *Queue) queued(mode string, teamSize int) int {
+	count := 0
+	for _, ticket := range q.Tickets {
+		if ticket.Mode == mode && ticket.TeamSize == teamSize {
+			count++
+		}
+	}
+
+	return count
+}
+
+// estimated time until the ticket gets a match, based on the recent wait
+// times for the same mode and team size
+func (q *Queue) EstimatedWait(ticket *Ticket) time.Duration {
+	q.Mu.Lock()
+	defer q.Mu.Unlock()
+
+	return q.estimatedWait(ticket, q.Clock.Now())
+}
+
+func (q *Queue) estimatedWait(ticket *Ticket, now time.Time) time.Duration {
+	average, exists := q.averageWaits[bucketKey(ticket.Mode, ticket.TeamSize)]
+	if !exists {
+		average = defaultWaitEstimate
+	}
+
+	remaining := average - now.Sub(ticket.EnqueuedAt)
+	if remaining < 0 {
+		return 0
+	}
+
+	return remaining
+}
+
+func (q *Queue) recordWait(ticket *Ticket, now time.Time) {
+	key := bucketKey(ticket.Mode, ticket.TeamSize)
+	waited := now.Sub(ticket.EnqueuedAt)
+
+	average, exists := q.averageWaits[key]
+	if !exists {
+		q.averageWaits[key] = waited
+		return
+	}
+
+	q.averageWaits[key] = time.Duration(
+		float64(average)*(1-waitSmoothing) + float64(waited)*waitSmoothing,
+	)
+}
+
+// groups the oldest tickets first, each group is anchored on its oldest
+// ticket and filled with the next compatible ones
+func (q *Queue) findMatches(now time.Time) [][]*Ticket {
+	waiting := make([]*Ticket, 0, len(q.Tickets))
+	for _, ticket := range q.Tickets {
+		waiting = append(waiting, ticket)
+	}
+
+	sort.Slice(waiting, func(i, j int) bool {
+		return waiting[i].EnqueuedAt.Before(waiting[j].EnqueuedAt)
+	})
+
+	matched := make(map[string]bool)
+	groups := [][]*Ticket{}
+
+	for i, anchor := range waiting {
+		if matched[anchor.ID] {
+			continue
+		}
+
+		group := []*Ticket{anchor}
+		for _, candidate := range waiting[i+1:] {
+			if matched[candidate.ID] || !anchor.compatible(candidate, now) {
+				continue
+			}
+
+			group = append(group, candidate)
+			if len(group) == anchor.playersNeeded() {
+				break
+			}
+		}
+
+		if len(group) < anchor.playersNeeded() {
+			continue
+		}
+
+		for _, ticket := range group {
+			matched[ticket.ID] = true
+			q.recordWait(ticket, now)
+			delete(q.Tickets, ticket.Client.ID)
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups
+}
+
+func (q *Queue) matchPass() {
+	now := q.Clock.Now()
+
+	q.Mu.Lock()
+	groups := q.findMatches(now)
+
+	type update struct {
+		ticket   *Ticket
+		queued   int
+		estimate time.Duration
+	}
+
+	updates := make([]update, 0, len(q.Tickets))
+	for _, ticket := range q.Tickets {
+		updates = append(updates, update{
+			ticket:   ticket,
+			queued:   q.queued(ticket.Mode, ticket.TeamSize),
+			estimate: q.estimatedWait(ticket, now),
+		})
+	}
+	q.Mu.Unlock()
+
+	// callbacks run outside of the lock, they usually end up broadcasting
+	for _, group := range groups {
+		log.Printf("Matched %d players for %s %dv%d", len(group), group[0].Mode, group[0].TeamSize, group[0].TeamSize)
+		if q.OnMatch != nil {
+			q.OnMatch(group)
+		}
+	}
+
+	if q.OnUpdate != nil {
+		for _, u := range updates {
+			q.OnUpdate(u.ticket, u.queued, u.estimate)
+		}
+	}
+}
+
+// runs the matchmaking passes in their own goroutine until Stop, the
+// ticker is on the clock before Start returns
+func (q *Queue) Start() {
+	q.Mu.Lock()
+	defer q.Mu.Unlock()
+
+	if q.stop != nil {
+		return
+	}
+
+	q.ticker = q.Clock.NewTicker(matchInterval)
+	q.stop = make(chan struct{})
+
+	go q.run(q.ticker, q.stop)
+}
+
+func (q *Queue) Stop() {
+	q.Mu.Lock()
+	defer q.Mu.Unlock()
+
+	if q.stop == nil {
+		return
+	}
+
+	q.ticker.Stop()
+	close(q.stop)
+	q.stop = nil
+}
+
+func (q *Queue) run(ticker clock.Ticker, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C():
+			q.matchPass()
+		}
+	}
+}
@@ -0,0 +1,372 @@
+// a websocket proxy that makes the network between the clients and the
+// server worse on purpose, for testing prediction, interpolation and
+// reconnects
+package netem
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// proxy constants
+const (
+	frameBacklog = 1024 // frames in flight per direction before reading waits
+	closeTimeout = time.Second
+)
+
+// relays every websocket connection it accepts to the target, impaired the
+// way the scenario says
+type Proxy struct {
+	Target   string // websocket endpoint of the server, like ws://localhost:8080/ws
+	Scenario *Scenario
+	Upgrader websocket.Upgrader
+	Dialer   *websocket.Dialer
+
+	Mu          sync.Mutex
+	Connections int // accepted so far, the next one gets this index
+}
+
+// a frame on its way, it is written once At has passed
+type frame struct {
+	Type int
+	Data []byte
+	At   time.Time
+}
+
+// one direction of a connection
+type link struct {
+	Mu         sync.Mutex
+	Impairment Impairment
+	Frames     int
+	Lost       int
+	Delayed    int // lost with LossDelay
+
+	rng      *rand.Rand
+	free     time.Time // when the bandwidth cap lets the next frame start
+	last     time.Time // when the frame before arrives, frames do not overtake
+	queue    chan frame
+	finished chan struct{} // closed once the frames are written
+}
+
+type connection struct {
+	Index  int
+	Client *websocket.Conn
+	Server *websocket.Conn
+	Up     *link // client to server
+	Down   *link // server to client
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// ---------------------------------------------------
+// Proxy functions
+
+func NewProxy(target string, scenario *Scenario) *Proxy {
+	if scenario == nil {
+		scenario = &Scenario{}
+	}
+
+	return &Proxy{
+		Target:   target,
+		Scenario: scenario,
+		Upgrader: websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }},
+		Dialer:   websocket.DefaultDialer,
+	}
+}
+
+// connects to the server first so a refused connection is refused to the
+// client too, with the server's status
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target, err := url.Parse(p.Target)
+	if err != nil {
+		log.Println("Failed to parse the proxy target: ", err)
+		http.Error(w, "bad proxy target", http.StatusInternalServerError)
+		return
+	}
+
+	// the client's query carries its name, token and replay
+	query := target.Query()
+	for key, values := range r.URL.Query() {
+		query[key] = values
+	}
+	target.RawQuery = query.Encode()
+
+	header := http.Header{}
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		header.Set("Authorization", authorization)
+	}
+
+	server, response, err := p.Dialer.DialContext(r.Context(), target.String(), header)
+	if err != nil {
+		if response != nil {
+			http.Error(w, response.Status, response.StatusCode)
+			return
+		}
+
+		log.Printf("Failed to connect to %s: %v", p.Target, err)
+		http.Error(w, "server unreachable", http.StatusBadGateway)
+		return
+	}
+
+	client, err := p.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Error %s when connecting to the socket", err)
+		server.Close()
+		return
+	}
+
+	p.Mu.Lock()
+	index := p.Connections
+	p.Connections++
+	p.Mu.Unlock()
+
+	c := &connection{
+		Index:  index,
+		Client: client,
+		Server: server,
+		Up:     newLink(p.Scenario.Seed, uint64(index)*2),
+		Down:   newLink(p.Scenario.Seed, uint64(index)*2+1),
+		closed: make(chan struct{}),
+	}
+
+	log.Printf("Connection %d from %s to %s", index, r.RemoteAddr, p.Target)
+
+	c.run(p.Scenario.stepsFor(index))
+}
+
+func newLink(seed uint64, stream uint64) *link {
+	return &link{
+		rng:      rand.New(rand.NewPCG(seed, stream)),
+		queue:    make(chan frame, frameBacklog),
+		finished: make(chan struct{}),
+	}
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Connection functions
+
+// relays both ways until either side goes away or the scenario cuts the
+// connection
+func (c *connection) run(steps []Step) {
+	start := time.Now()
+
+	// what holds from the start applies to the first frame
+	for len(steps) > 0 && steps[0].At.Duration == 0 {
+		if !c.apply(steps[0]) {
+			return
+		}
+		steps = steps[1:]
+	}
+
+	go c.relay(c.Client, c.Up)
+	go c.deliver(c.Server, c.Up)
+	go c.relay(c.Server, c.Down)
+	go c.deliver(c.Client, c.Down)
+	go c.play(start, steps)
+
+	<-c.closed
+	<-c.Up.finished
+	<-c.Down.finished
+
+	log.Printf("Connection %d closed, up %s, down %s", c.Index, c.Up.summary(), c.Down.summary())
+}
+
+// applies the rest of the steps when their time comes
+func (c *connection) play(start time.Time, steps []Step) {
+	for _, step := range steps {
+		timer := time.NewTimer(time.Until(start.Add(step.At.Duration)))
+
+		select {
+		case <-timer.C:
+		case <-c.closed:
+			timer.Stop()
+			return
+		}
+
+		if !c.apply(step) {
+			return
+		}
+	}
+}
+
+// returns false once the step has cut the connection
+func (c *connection) apply(step Step) bool {
+	if step.Up != nil {
+		c.Up.set(*step.Up)
+	}
+	if step.Down != nil {
+		c.Down.set(*step.Down)
+	}
+
+	if step.Disconnect {
+		log.Printf("Connection %d cut by the scenario at %s", c.Index, step.At.Duration)
+		c.close()
+		return false
+	}
+
+	return true
+}
+
+// reads the frames of one side and queues them for the other
+func (c *connection) relay(from *websocket.Conn, l *link) {
+	defer close(l.queue)
+
+	for {
+		messageType, data, err := from.ReadMessage()
+		if err != nil {
+			// a clean close goes to the other side after the frames before it
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				c.close()
+				return
+			}
+
+			select {
+			case l.queue <- l.closing(websocket.FormatCloseMessage(closeErr.Code, closeErr.Text)):
+			case <-c.closed:
+			}
+			return
+		}
+
+		next, arrives := l.schedule(messageType, data)
+		if !arrives {
+			continue
+		}
+
+		select {
+		case l.queue <- next:
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// writes the frames of a link once their time has come
+func (c *connection) deliver(to *websocket.Conn, l *link) {
+	defer close(l.finished)
+
+	for next := range l.queue {
+		timer := time.NewTimer(time.Until(next.At))
+
+		select {
+		case <-timer.C:
+		case <-c.closed:
+			timer.Stop()
+			return
+		}
+
+		if next.Type == websocket.CloseMessage {
+			to.WriteControl(websocket.CloseMessage, next.Data, time.Now().Add(closeTimeout))
+			c.close()
+			return
+		}
+
+		if err := to.WriteMessage(next.Type, next.Data); err != nil {
+			c.close()
+			return
+		}
+	}
+}
+
+// drops both sides without a close frame, like a network that went away
+func (c *connection) close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.Client.Close()
+		c.Server.Close()
+	})
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Link functions
+
+func (l *link) set(impairment Impairment) {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+
+	l.Impairment = impairment
+}
+
+// picks when the frame arrives, or that it does not. the random numbers
+// are drawn in frame order so a seed always loses the same frames
+func (l *link) schedule(messageType int, data []byte) (frame, bool) {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+
+	impairment := l.Impairment
+	now := time.Now()
+	l.Frames++
+
+	delay := impairment.Latency.Duration
+	if jitter := impairment.Jitter.Duration; jitter > 0 {
+		delay += time.Duration((l.rng.Float64()*2 - 1) * float64(jitter))
+		delay = max(delay, 0)
+	}
+
+	if impairment.Loss > 0 && l.rng.Float64() < impairment.Loss {
+		if impairment.LossMode != LossDelay {
+			l.Lost++
+			return frame{}, false
+		}
+
+		lossDelay := impairment.LossDelay.Duration
+		if lossDelay == 0 {
+			lossDelay = defaultLossDelay
+		}
+
+		delay += lossDelay
+		l.Delayed++
+	}
+
+	// the frame goes out once the ones before it are through the cap
+	sent := now
+	if impairment.Bandwidth > 0 {
+		if l.free.After(sent) {
+			sent = l.free
+		}
+		sent = sent.Add(time.Duration(len(data)) * time.Second / time.Duration(impairment.Bandwidth))
+		l.free = sent
+	}
+
+	at := sent.Add(delay)
+	if at.Before(l.last) {
+		at = l.last
+	}
+	l.last = at
+
+	return frame{Type: messageType, Data: data, At: at}, true
+}
+
+// a close frame waits for the frames before it but is not impaired itself
+func (l *link) closing(data []byte) frame {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+
+	at := time.Now()
+	if at.Before(l.last) {
+		at = l.last
+	}
+
+	return frame{Type: websocket.CloseMessage, Data: data, At: at}
+}
+
+func (l *link) summary() string {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+
+	return fmt.Sprintf("%d frames, %d lost, %d delayed", l.Frames, l.Lost, l.Delayed)
+}
+
+// ---------------------------------------------------
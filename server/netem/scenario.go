@@ -0,0 +1,142 @@
+package netem
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mo-shahab/go-pong/config"
+	"os"
+	"slices"
+	"time"
+)
+
+// what happens to a lost frame
+const (
+	LossDrop  = "drop"  // it never arrives
+	LossDelay = "delay" // it arrives late, like a resent tcp segment
+)
+
+// default extra wait of frames lost with LossDelay
+const defaultLossDelay = 200 * time.Millisecond
+
+// how one direction of a connection is impaired, the zero value passes
+// frames through untouched
+type Impairment struct {
+	Latency   config.Duration `json:"latency"`
+	Jitter    config.Duration `json:"jitter"`     // latency varies by up to this much either way
+	Loss      float64         `json:"loss"`       // chance of a frame being lost, 0 to 1
+	LossMode  string          `json:"loss_mode"`  // LossDrop or LossDelay, LossDrop if empty
+	LossDelay config.Duration `json:"loss_delay"` // extra wait of a frame lost with LossDelay
+	Bandwidth int             `json:"bandwidth"`  // bytes per second, 0 for no cap
+}
+
+// a change to the connections at some time after they connected. a
+// direction the step leaves out keeps its impairment, an empty one clears it
+type Step struct {
+	At          config.Duration `json:"at"`
+	Connections []int           `json:"connections"` // indexes in connect order, every connection if empty
+	Up          *Impairment     `json:"up"`          // client to server
+	Down        *Impairment     `json:"down"`        // server to client
+	Disconnect  bool            `json:"disconnect"`  // cuts the connection without a close frame
+}
+
+// a script of impairments played on every connection from the moment it
+// connects. the same seed picks the same frames to lose and the same
+// jitter for the same connection, so runs can be reproduced. in JSON
+//
+//	{
+//	  "seed": 7,
+//	  "steps": [
+//	    {"at": "0s", "down": {"latency": "80ms", "jitter": "20ms"}, "up": {"latency": "80ms"}},
+//	    {"at": "20s", "down": {"latency": "80ms", "loss": 0.05, "loss_mode": "delay"}},
+//	    {"at": "40s", "connections": [1], "disconnect": true}
+//	  ]
+//	}
+type Scenario struct {
+	Seed  uint64 `json:"seed"`
+	Steps []Step `json:"steps"`
+}
+
+// ---------------------------------------------------
+// Scenario functions
+
+// one step at the start that impairs both directions the same way
+func Constant(seed uint64, impairment Impairment) *Scenario {
+	return &Scenario{
+		Seed:  seed,
+		Steps: []Step{{Up: &impairment, Down: &impairment}},
+	}
+}
+
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	scenario := &Scenario{}
+	if err := json.Unmarshal(data, scenario); err != nil {
+		return nil, fmt.Errorf("netem: %s: %w", path, err)
+	}
+
+	if err := scenario.Validate(); err != nil {
+		return nil, fmt.Errorf("netem: %s: %w", path, err)
+	}
+
+	return scenario, nil
+}
+
+// sorts the steps by time and checks the impairments make sense
+func (s *Scenario) Validate() error {
+	slices.SortStableFunc(s.Steps, func(a, b Step) int {
+		return cmp.Compare(a.At.Duration, b.At.Duration)
+	})
+
+	for i, step := range s.Steps {
+		if step.At.Duration < 0 {
+			return fmt.Errorf("step %d starts before the connection", i)
+		}
+
+		for _, impairment := range []*Impairment{step.Up, step.Down} {
+			if impairment == nil {
+				continue
+			}
+
+			if err := impairment.validate(); err != nil {
+				return fmt.Errorf("step %d: %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// the steps that apply to the connection
+func (s *Scenario) stepsFor(connection int) []Step {
+	steps := []Step{}
+	for _, step := range s.Steps {
+		if len(step.Connections) == 0 || slices.Contains(step.Connections, connection) {
+			steps = append(steps, step)
+		}
+	}
+
+	return steps
+}
+
+func (i *Impairment) validate() error {
+	switch {
+	case i.Latency.Duration < 0 || i.Jitter.Duration < 0 || i.LossDelay.Duration < 0:
+		return errors.New("latency, jitter and loss delay can not be negative")
+	case i.Loss < 0 || i.Loss > 1:
+		return errors.New("loss is a chance between 0 and 1")
+	case i.LossMode != "" && i.LossMode != LossDrop && i.LossMode != LossDelay:
+		return fmt.Errorf("unknown loss mode %q, use %s or %s", i.LossMode, LossDrop, LossDelay)
+	case i.Bandwidth < 0:
+		return errors.New("bandwidth can not be negative")
+	}
+
+	return nil
+}
+
+// ---------------------------------------------------
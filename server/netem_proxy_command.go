@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mo-shahab/go-pong/config"
+	"github.com/mo-shahab/go-pong/netem"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// gopong netem-proxy [flags]
+// relays websocket connections to the server over a worse network than the
+// real one, either the same for the whole connection or scripted
+func netemProxyCommand(args []string) int {
+	flags := flag.NewFlagSet("netem-proxy", flag.ContinueOnError)
+	listen := flags.String("listen", "localhost:8081", "address the clients connect to")
+	target := flags.String("target", "ws://localhost:8080/ws", "websocket endpoint of the server")
+	scenarioPath := flags.String("scenario", "", "JSON scenario to play on every connection, replaces the impairment flags")
+	seed := flags.Uint64("seed", 1, "seed of the lost frames and the jitter")
+	latency := flags.Duration("latency", 0, "one way latency")
+	jitter := flags.Duration("jitter", 0, "latency varies by up to this much either way")
+	loss := flags.Float64("loss", 0, "chance of a frame being lost, 0 to 1")
+	lossMode := flags.String("loss-mode", netem.LossDrop, "what happens to a lost frame, drop or delay")
+	lossDelay := flags.Duration("loss-delay", 200*time.Millisecond, "extra wait of a frame lost with -loss-mode delay")
+	bandwidth := flags.Int("bandwidth", 0, "bytes per second each way, 0 for no cap")
+	disconnectAfter := flags.Duration("disconnect-after", 0, "cuts every connection after this long, 0 never does")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gopong netem-proxy [flags]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() > 0 || *disconnectAfter < 0 {
+		flags.Usage()
+		return 2
+	}
+
+	var scenario *netem.Scenario
+	if *scenarioPath != "" {
+		loaded, err := netem.LoadScenario(*scenarioPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		scenario = loaded
+	} else {
+		scenario = netem.Constant(*seed, netem.Impairment{
+			Latency:   config.Duration{Duration: *latency},
+			Jitter:    config.Duration{Duration: *jitter},
+			Loss:      *loss,
+			LossMode:  *lossMode,
+			LossDelay: config.Duration{Duration: *lossDelay},
+			Bandwidth: *bandwidth,
+		})
+
+		if *disconnectAfter > 0 {
+			scenario.Steps = append(scenario.Steps, netem.Step{
+				At:         config.Duration{Duration: *disconnectAfter},
+				Disconnect: true,
+			})
+		}
+
+		if err := scenario.Validate(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	log.Printf("Proxying ws://%s to %s", *listen, *target)
+	if err := http.ListenAndServe(*listen, netem.NewProxy(*target, scenario)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
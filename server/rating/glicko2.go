@@ -0,0 +1,164 @@
+package rating
+
+import (
+	"math"
+)
+
+// glicko-2 constants, see http://www.glicko.net/glicko/glicko2.pdf
+const (
+	DefaultRating     = 1500.0
+	DefaultDeviation  = 350.0
+	DefaultVolatility = 0.06
+
+	// constrains the change in volatility over time
+	tau = 0.5
+	// converts between the glicko and glicko-2 scales
+	glickoScale = 173.7178
+	// tolerance for the volatility iteration
+	convergence = 0.000001
+)
+
+// outcome of a single game against an opponent, score is 1 for a win and 0
+// for a loss
+type Result struct {
+	Opponent Rating
+	Score    float64
+}
+
+func g(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func expectedScore(mu, opponentMu, opponentG float64) float64 {
+	return 1 / (1 + math.Exp(-opponentG*(mu-opponentMu)))
+}
+
+// new volatility using the illinois variant of regula falsi (step 5 of the
+// paper)
+func newVolatility(sigma, phi, v, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		numerator := ex * (delta*delta - phi*phi - v - ex)
+		denominator := 2 * math.Pow(phi*phi+v+ex, 2)
+		return numerator/denominator - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > convergence {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+
+		B, fB = C, fC
+	}
+
+	return math.Exp(A / 2)
+}
+
+// applies one rating period worth of results to the player
+func Update(player Rating, results []Result) Rating {
+	mu := (player.Rating - DefaultRating) / glickoScale
+	phi := player.Deviation / glickoScale
+	sigma := player.Volatility
+
+	// a player that did not play only gets their deviation increased
+	if len(results) == 0 {
+		phiStar := math.Sqrt(phi*phi + sigma*sigma)
+		player.Deviation = math.Min(phiStar*glickoScale, DefaultDeviation)
+		return player
+	}
+
+	var vInverse, improvement float64
+	for _, result := range results {
+		opponentMu := (result.Opponent.Rating - DefaultRating) / glickoScale
+		opponentG := g(result.Opponent.Deviation / glickoScale)
+		expected := expectedScore(mu, opponentMu, opponentG)
+
+		vInverse += opponentG * opponentG * expected * (1 - expected)
+		improvement += opponentG * (result.Score - expected)
+	}
+
+	v := 1 / vInverse
+	delta := v * improvement
+
+	sigmaPrime := newVolatility(sigma, phi, v, delta)
+	phiStar := math.Sqrt(phi*phi + sigmaPrime*sigmaPrime)
+	phiPrime := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	muPrime := mu + phiPrime*phiPrime*improvement
+
+	player.Rating = muPrime*glickoScale + DefaultRating
+	player.Deviation = phiPrime * glickoScale
+	player.Volatility = sigmaPrime
+
+	return player
+}
+
+// composite rating of a team, the average rating with the root mean square
+// of the deviations
+func TeamRating(team []Rating) Rating {
+	if len(team) == 0 {
+		return NewRating("")
+	}
+
+	var ratingSum, deviationSquares, volatilitySum float64
+	for _, member := range team {
+		ratingSum += member.Rating
+		deviationSquares += member.Deviation * member.Deviation
+		volatilitySum += member.Volatility
+	}
+
+	count := float64(len(team))
+
+	return Rating{
+		Rating:     ratingSum / count,
+		Deviation:  math.Sqrt(deviationSquares / count),
+		Volatility: volatilitySum / count,
+	}
+}
+
+// updates every member of both teams, each player is rated as if their team
+// average played the other team's composite, the resulting rating change is
+// applied to the player while deviation and volatility stay individual
+func UpdateTeams(winners []Rating, losers []Rating) ([]Rating, []Rating) {
+	return updateTeam(winners, losers, 1), updateTeam(losers, winners, 0)
+}
+
+func updateTeam(team []Rating, opponents []Rating, score float64) []Rating {
+	average := TeamRating(team).Rating
+	opponent := TeamRating(opponents)
+
+	updated := make([]Rating, len(team))
+	for i, member := range team {
+		virtual := member
+		virtual.Rating = average
+
+		result := Update(virtual, []Result{{Opponent: opponent, Score: score}})
+
+		member.Rating += result.Rating - average
+		member.Deviation = result.Deviation
+		member.Volatility = result.Volatility
+		member.Matches++
+		updated[i] = member
+	}
+
+	return updated
+}
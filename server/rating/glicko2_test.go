@@ -0,0 +1,136 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	// the example in Glickman's "Example of the Glicko-2 system", which
+	// rounds on the way so the rating is only close to 1464.06
+	example := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+
+	tests := []struct {
+		name    string
+		player  Rating
+		results []Result
+
+		wantRating     float64
+		wantDeviation  float64
+		wantVolatility float64
+		tolerance      float64
+	}{
+		{
+			name:   "glickman's example",
+			player: example,
+			results: []Result{
+				{Opponent: Rating{Rating: 1400, Deviation: 30}, Score: 1},
+				{Opponent: Rating{Rating: 1550, Deviation: 100}, Score: 0},
+				{Opponent: Rating{Rating: 1700, Deviation: 300}, Score: 0},
+			},
+			wantRating:     1464.06,
+			wantDeviation:  151.52,
+			wantVolatility: 0.05999,
+			tolerance:      0.01,
+		},
+		{
+			name:           "no games only widens the deviation",
+			player:         example,
+			wantRating:     1500,
+			wantDeviation:  200.27,
+			wantVolatility: 0.06,
+			tolerance:      0.01,
+		},
+		{
+			name:           "the deviation never passes the default",
+			player:         NewRating("new"),
+			wantRating:     DefaultRating,
+			wantDeviation:  DefaultDeviation,
+			wantVolatility: DefaultVolatility,
+		},
+		{
+			name:    "a draw against an equal player",
+			player:  NewRating("draw"),
+			results: []Result{{Opponent: NewRating("other"), Score: 0.5}},
+
+			wantRating:     DefaultRating,
+			wantDeviation:  290.32,
+			wantVolatility: 0.06,
+			tolerance:      0.01,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Update(test.player, test.results)
+
+			// the paper gives the rating and deviation to two decimals and
+			// the volatility to five
+			checks := []struct {
+				field     string
+				got, want float64
+				tolerance float64
+			}{
+				{"rating", got.Rating, test.wantRating, math.Max(test.tolerance, 1e-9)},
+				{"deviation", got.Deviation, test.wantDeviation, math.Max(test.tolerance, 1e-9)},
+				{"volatility", got.Volatility, test.wantVolatility, 0.00001},
+			}
+
+			for _, check := range checks {
+				if math.Abs(check.got-check.want) > check.tolerance {
+					t.Errorf("got %s %v, want %v", check.field, check.got, check.want)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateTeams(t *testing.T) {
+	tests := []struct {
+		name    string
+		winners []Rating
+		losers  []Rating
+	}{
+		{name: "one on one", winners: []Rating{NewRating("a")}, losers: []Rating{NewRating("b")}},
+		{
+			name:    "uneven teams",
+			winners: []Rating{{PlayerId: "a", Rating: 1600, Deviation: 80, Volatility: 0.06}, {PlayerId: "b", Rating: 1400, Deviation: 200, Volatility: 0.06}},
+			losers:  []Rating{NewRating("c"), {PlayerId: "d", Rating: 1800, Deviation: 50, Volatility: 0.06}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			winners, losers := UpdateTeams(test.winners, test.losers)
+
+			for i, winner := range winners {
+				if winner.Rating <= test.winners[i].Rating || winner.Matches != 1 {
+					t.Errorf("winner %s went from %+v to %+v", winner.PlayerId, test.winners[i], winner)
+				}
+			}
+
+			for i, loser := range losers {
+				if loser.Rating >= test.losers[i].Rating || loser.Matches != 1 {
+					t.Errorf("loser %s went from %+v to %+v", loser.PlayerId, test.losers[i], loser)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateTeamsDeviation(t *testing.T) {
+	// the team plays as one, but the less certain player's rating moves more
+	sure := Rating{PlayerId: "sure", Rating: 1500, Deviation: 50, Volatility: 0.06}
+	unsure := Rating{PlayerId: "unsure", Rating: 1500, Deviation: 300, Volatility: 0.06}
+
+	winners, _ := UpdateTeams([]Rating{sure, unsure}, []Rating{NewRating("c")})
+	if winners[0].Rating-sure.Rating >= winners[1].Rating-unsure.Rating {
+		t.Fatalf("the sure player gained %v and the unsure one %v", winners[0].Rating-sure.Rating, winners[1].Rating-unsure.Rating)
+	}
+
+	// equal players gain and lose the same
+	winners, losers := UpdateTeams([]Rating{NewRating("a")}, []Rating{NewRating("b")})
+	if gain, loss := winners[0].Rating-DefaultRating, DefaultRating-losers[0].Rating; math.Abs(gain-loss) > 1e-9 {
+		t.Fatalf("gained %v and lost %v", gain, loss)
+	}
+}
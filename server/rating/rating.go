@@ -0,0 +1,146 @@
+package rating
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// skill rating of a single player
+type Rating struct {
+	PlayerId   string    `json:"player_id"`
+	Rating     float64   `json:"rating"`
+	Deviation  float64   `json:"deviation"`
+	Volatility float64   `json:"volatility"`
+	Matches    int       `json:"matches"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// rating of a player before and after a match
+type Change struct {
+	Before Rating `json:"before"`
+	After  Rating `json:"after"`
+}
+
+// where the ratings are kept, found is false for players that have not
+// played a rated match yet
+type Store interface {
+	GetRating(playerId string) (Rating, bool, error)
+	PutRating(rating Rating) error
+	ListRatings() ([]Rating, error)
+}
+
+// rating subsystem, updates ratings after matches through the store
+type Service struct {
+	Store Store
+	Mu    sync.Mutex
+}
+
+func NewRating(playerId string) Rating {
+	return Rating{
+		PlayerId:   playerId,
+		Rating:     DefaultRating,
+		Deviation:  DefaultDeviation,
+		Volatility: DefaultVolatility,
+	}
+}
+
+func NewService(store Store) *Service {
+	return &Service{
+		Store: store,
+	}
+}
+
+// rating of the player, players without a stored rating get the default one
+func (s *Service) Get(playerId string) (Rating, error) {
+	rating, found, err := s.Store.GetRating(playerId)
+	if err != nil {
+		return Rating{}, err
+	}
+
+	if !found {
+		return NewRating(playerId), nil
+	}
+
+	return rating, nil
+}
+
+// rating of the player, only if they have played a rated match already
+func (s *Service) Lookup(playerId string) (Rating, bool) {
+	rating, found, err := s.Store.GetRating(playerId)
+	if err != nil || !found {
+		return Rating{}, false
+	}
+
+	return rating, true
+}
+
+// highest rated players first
+func (s *Service) Top(limit int) ([]Rating, error) {
+	ratings, err := s.Store.ListRatings()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ratings, func(i, j int) bool {
+		return ratings[i].Rating > ratings[j].Rating
+	})
+
+	if limit > 0 && len(ratings) > limit {
+		ratings = ratings[:limit]
+	}
+
+	return ratings, nil
+}
+
+// updates the ratings of everyone on the winning and losing teams, now is
+// when the match ended
+func (s *Service) RecordMatch(winnerIds []string, loserIds []string, now time.Time) ([]Change, error) {
+	if len(winnerIds) == 0 || len(loserIds) == 0 {
+		return nil, nil
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	winners, err := s.load(winnerIds)
+	if err != nil {
+		return nil, err
+	}
+
+	losers, err := s.load(loserIds)
+	if err != nil {
+		return nil, err
+	}
+
+	updatedWinners, updatedLosers := UpdateTeams(winners, losers)
+
+	before := append(winners, losers...)
+	after := append(updatedWinners, updatedLosers...)
+
+	changes := make([]Change, len(before))
+	for i := range before {
+		after[i].UpdatedAt = now
+
+		if err := s.Store.PutRating(after[i]); err != nil {
+			return nil, err
+		}
+
+		changes[i] = Change{Before: before[i], After: after[i]}
+	}
+
+	return changes, nil
+}
+
+func (s *Service) load(playerIds []string) ([]Rating, error) {
+	ratings := make([]Rating, len(playerIds))
+	for i, playerId := range playerIds {
+		rating, err := s.Get(playerId)
+		if err != nil {
+			return nil, err
+		}
+		ratings[i] = rating
+	}
+
+	return ratings, nil
+}
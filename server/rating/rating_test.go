@@ -0,0 +1,54 @@
+package rating
+
+import (
+	"testing"
+	"time"
+)
+
+// ratings kept in a map, the store package depends on this one
+type mapStore map[string]Rating
+
+func (m mapStore) GetRating(playerId string) (Rating, bool, error) {
+	r, found := m[playerId]
+	return r, found, nil
+}
+
+func (m mapStore) PutRating(r Rating) error {
+	m[r.PlayerId] = r
+	return nil
+}
+
+func (m mapStore) ListRatings() ([]Rating, error) {
+	ratings := []Rating{}
+	for _, r := range m {
+		ratings = append(ratings, r)
+	}
+
+	return ratings, nil
+}
+
+func TestRecordMatch(t *testing.T) {
+	st := mapStore{}
+	s := NewService(st)
+	endedAt := time.Date(2024, time.March, 1, 18, 30, 0, 0, time.UTC)
+
+	changes, err := s.RecordMatch([]string{"winner"}, []string{"loser"}, endedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2", len(changes))
+	}
+
+	for _, change := range changes {
+		stored := st[change.After.PlayerId]
+		if !stored.UpdatedAt.Equal(endedAt) || stored != change.After {
+			t.Errorf("stored %+v, want %+v updated at %v", stored, change.After, endedAt)
+		}
+	}
+
+	if st["winner"].Rating <= st["loser"].Rating {
+		t.Errorf("the winner is at %v and the loser at %v", st["winner"].Rating, st["loser"].Rating)
+	}
+}
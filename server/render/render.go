@@ -0,0 +1,186 @@
+package render
+
+import (
+	"github.com/mo-shahab/go-pong/simulation"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// drawing constants, the look follows the browser client
+const (
+	MaxWidth    = 480 // frames of larger arenas are scaled down to fit
+	MaxHeight   = 360
+	scoreHeight = 36 // height of the score digits in arena pixels
+	scoreTop    = 20
+	centerDash  = 15
+	centerWidth = 2
+	minGIFDelay = 2 // browsers slow down anything faster than 20ms
+)
+
+// palette indexes
+const (
+	background uint8 = iota
+	foreground
+	centerLine
+)
+
+var palette = color.Palette{
+	color.Black,
+	color.White,
+	color.Gray{Y: 0x80},
+}
+
+// 3x5 digits for the scoreboard, the standard library has no text drawing
+var digits = [10][5]string{
+	{"###", "#.#", "#.#", "#.#", "###"},
+	{".#.", "##.", ".#.", ".#.", "###"},
+	{"###", "..#", "###", "#..", "###"},
+	{"###", "..#", "###", "..#", "###"},
+	{"#.#", "#.#", "###", "..#", "..#"},
+	{"###", "#..", "###", "..#", "###"},
+	{"###", "#..", "###", "#.#", "###"},
+	{"###", "..#", "..#", "..#", "..#"},
+	{"###", "#.#", "###", "#.#", "###"},
+	{"###", "#.#", "###", "..#", "###"},
+}
+
+// draws simulation states of one arena as images
+type Renderer struct {
+	Arena  simulation.Arena
+	Scale  float64
+	Width  int
+	Height int
+}
+
+func New(arena simulation.Arena) *Renderer {
+	// whichever side is further over its bound decides, so both fit
+	scale := 1.0
+	if over := max(arena.Canvas.Width/MaxWidth, arena.Canvas.Height/MaxHeight); over > 1 {
+		scale = 1 / over
+	}
+
+	return &Renderer{
+		Arena:  arena,
+		Scale:  scale,
+		Width:  max(1, int(math.Round(arena.Canvas.Width*scale))),
+		Height: max(1, int(math.Round(arena.Canvas.Height*scale))),
+	}
+}
+
+// ---------------------------------------------------
+// Encoding functions
+
+func (r *Renderer) PNG(w io.Writer, state simulation.State) error {
+	return png.Encode(w, r.Frame(state))
+}
+
+// an endlessly looping animation showing each state for the delay
+func (r *Renderer) GIF(w io.Writer, states []simulation.State, delay time.Duration) error {
+	animation := &gif.GIF{}
+	centiseconds := max(minGIFDelay, int(math.Round(float64(delay)/float64(10*time.Millisecond))))
+
+	for _, state := range states {
+		animation.Image = append(animation.Image, r.Frame(state))
+		animation.Delay = append(animation.Delay, centiseconds)
+	}
+
+	return gif.EncodeAll(w, animation)
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Drawing functions
+
+// draws the arena, the scores, both paddles and the ball
+func (r *Renderer) Frame(state simulation.State) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, r.Width, r.Height), palette)
+
+	width := r.Arena.Canvas.Width
+	height := r.Arena.Canvas.Height
+	paddle := r.Arena.Paddle
+
+	for y := 0.0; y < height; y += 2 * centerDash {
+		r.fillRect(img, width/2-centerWidth/2, y, centerWidth, centerDash, centerLine)
+	}
+
+	r.drawNumber(img, int(state.Scores.LeftScores), width/4, scoreTop)
+	r.drawNumber(img, int(state.Scores.RightScores), 3*width/4, scoreTop)
+
+	r.fillRect(img, 0, state.LeftPaddle, paddle.Width, paddle.Height, foreground)
+	r.fillRect(img, width-paddle.Width, state.RightPaddle, paddle.Width, paddle.Height, foreground)
+
+	if state.Ball.Visible {
+		r.fillCircle(img, state.Ball.X, state.Ball.Y, state.Ball.Radius, foreground)
+	}
+
+	return img
+}
+
+// fills a rectangle given in arena coordinates, it is clipped to the image
+func (r *Renderer) fillRect(img *image.Paletted, x, y, w, h float64, index uint8) {
+	rect := image.Rect(
+		int(math.Round(x*r.Scale)),
+		int(math.Round(y*r.Scale)),
+		int(math.Round((x+w)*r.Scale)),
+		int(math.Round((y+h)*r.Scale)),
+	).Intersect(img.Bounds())
+
+	for py := rect.Min.Y; py < rect.Max.Y; py++ {
+		for px := rect.Min.X; px < rect.Max.X; px++ {
+			img.SetColorIndex(px, py, index)
+		}
+	}
+}
+
+func (r *Renderer) fillCircle(img *image.Paletted, cx, cy, radius float64, index uint8) {
+	cx, cy = cx*r.Scale, cy*r.Scale
+	radius = max(1, radius*r.Scale)
+
+	rect := image.Rect(
+		int(math.Floor(cx-radius)),
+		int(math.Floor(cy-radius)),
+		int(math.Ceil(cx+radius)),
+		int(math.Ceil(cy+radius)),
+	).Intersect(img.Bounds())
+
+	for py := rect.Min.Y; py < rect.Max.Y; py++ {
+		for px := rect.Min.X; px < rect.Max.X; px++ {
+			dx := float64(px) + 0.5 - cx
+			dy := float64(py) + 0.5 - cy
+			if dx*dx+dy*dy <= radius*radius {
+				img.SetColorIndex(px, py, index)
+			}
+		}
+	}
+}
+
+// draws the number centered on x with its top at y
+func (r *Renderer) drawNumber(img *image.Paletted, number int, x, y float64) {
+	text := strconv.Itoa(max(0, number))
+	cell := float64(scoreHeight) / 5
+
+	// digits are 3 cells wide with a cell between them
+	width := float64(len(text)*4-1) * cell
+	left := x - width/2
+
+	for i, char := range text {
+		glyph := digits[char-'0']
+
+		for row, line := range glyph {
+			for col, pixel := range line {
+				if pixel == '#' {
+					r.fillRect(img, left+float64(i*4+col)*cell, y+float64(row)*cell, cell, cell, foreground)
+				}
+			}
+		}
+	}
+}
+
+// ---------------------------------------------------
@@ -0,0 +1,35 @@
+package render
+
+import (
+	"github.com/mo-shahab/go-pong/canvas"
+	"github.com/mo-shahab/go-pong/simulation"
+	"testing"
+)
+
+func TestNewScale(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height float64
+		wantWidth     int
+		wantHeight    int
+	}{
+		{name: "fits", width: 400, height: 300, wantWidth: 400, wantHeight: 300},
+		{name: "too wide", width: 960, height: 300, wantWidth: 480, wantHeight: 150},
+		{name: "too tall", width: 400, height: 3600, wantWidth: 40, wantHeight: 360},
+		{name: "too large", width: 4096, height: 4096, wantWidth: 360, wantHeight: 360},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := New(simulation.Arena{Canvas: canvas.Canvas{Width: test.width, Height: test.height}})
+
+			if r.Width != test.wantWidth || r.Height != test.wantHeight {
+				t.Fatalf("got %dx%d, want %dx%d", r.Width, r.Height, test.wantWidth, test.wantHeight)
+			}
+
+			if bounds := r.Frame(simulation.State{}).Bounds(); bounds.Dx() != r.Width || bounds.Dy() != r.Height {
+				t.Fatalf("got a %dx%d frame, want %dx%d", bounds.Dx(), bounds.Dy(), r.Width, r.Height)
+			}
+		})
+	}
+}
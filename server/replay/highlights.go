@@ -0,0 +1,84 @@
+package replay
+
+import (
+	"github.com/mo-shahab/go-pong/simulation"
+)
+
+// play from a serve to the goal that ended it, or to the end of the replay
+// for a match that was abandoned
+type Rally struct {
+	From int64
+	To   int64
+	Hits int
+}
+
+// ---------------------------------------------------
+// Highlight functions
+
+// the simulation state of every nth tick from one tick to another, the
+// player is left at the last of them
+func (p *Player) States(from, to int64, every int) []simulation.State {
+	every = max(1, every)
+	states := []simulation.State{}
+
+	p.JumpTo(from)
+	for {
+		if (p.Sim.Tick-from)%int64(every) == 0 {
+			states = append(states, p.Sim.State)
+		}
+
+		if p.Sim.Tick >= to || p.Done() {
+			return states
+		}
+
+		p.Step()
+	}
+}
+
+// plays the whole replay and returns its rallies in order, each one ends on
+// the tick that served the ball again. the player is left at the end
+func (p *Player) Rallies() []Rally {
+	rallies := []Rally{}
+	current := Rally{}
+
+	p.JumpTo(0)
+	for !p.Done() {
+		p.Step()
+
+		if p.Result.Hit != "" {
+			current.Hits++
+		}
+
+		if p.Result.Goal != "" {
+			current.To = p.Sim.Tick
+			rallies = append(rallies, current)
+			current = Rally{From: p.Sim.Tick}
+		}
+	}
+
+	if p.Sim.Tick > current.From {
+		current.To = p.Sim.Tick
+		rallies = append(rallies, current)
+	}
+
+	return rallies
+}
+
+// the rally with the most paddle hits, the longer one wins a tie. false if
+// the replay has no play at all
+func (p *Player) LongestRally() (Rally, bool) {
+	longest := Rally{}
+	found := false
+
+	for _, rally := range p.Rallies() {
+		if !found || rally.Hits > longest.Hits ||
+			(rally.Hits == longest.Hits && rally.To-rally.From > longest.To-longest.From) {
+			longest = rally
+			found = true
+		}
+	}
+
+	return longest, found
+}
+
+// ---------------------------------------------------
@@ -0,0 +1,145 @@
+package replay
+
+import (
+	"errors"
+	pb "github.com/mo-shahab/go-pong/proto"
+	"github.com/mo-shahab/go-pong/simulation"
+	"io"
+	"sort"
+)
+
+var ErrNoKeyframe = errors.New("replay does not start with a snapshot")
+
+// plays a replay back tick by tick by simulating it again, keyframes let it
+// seek without starting over from tick zero. it is not safe for concurrent
+// use
+type Player struct {
+	Header   *pb.ReplayHeader
+	Frames   []*pb.ReplayFrame
+	Arena    simulation.Arena
+	Sim      *simulation.Simulation
+	LastTick int64
+	Result   simulation.Result // what happened during the last step
+
+	// snapshots that did not match the simulated state, the snapshot wins
+	Mismatches int
+
+	keyframes []int // indexes of the snapshot frames
+	next      int   // index of the first frame not applied yet
+}
+
+// reads the whole replay, a replay cut short is played up to where it ends
+func Load(r io.Reader) (*Player, error) {
+	reader, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	frames, err := reader.ReadAll()
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+
+	return NewPlayer(reader.Header, frames)
+}
+
+// starts at tick zero
+func NewPlayer(header *pb.ReplayHeader, frames []*pb.ReplayFrame) (*Player, error) {
+	p := &Player{
+		Header: header,
+		Frames: frames,
+		Arena:  Arena(header.Arena),
+	}
+
+	for i, frame := range frames {
+		if frame.GetSnapshot() != nil {
+			p.keyframes = append(p.keyframes, i)
+		}
+
+		if frame.Tick > p.LastTick {
+			p.LastTick = frame.Tick
+		}
+	}
+
+	if len(p.keyframes) == 0 || p.keyframes[0] != 0 {
+		return nil, ErrNoKeyframe
+	}
+
+	p.JumpTo(0)
+
+	return p, nil
+}
+
+// true once every frame has been played
+func (p *Player) Done() bool {
+	return p.next >= len(p.Frames) && p.Sim.Tick >= p.LastTick
+}
+
+// advances one tick and returns the frames recorded for it, inputs and
+// snapshots have already been applied to the simulation
+func (p *Player) Step() []*pb.ReplayFrame {
+	p.Result = p.Sim.Step()
+	return p.apply()
+}
+
+// jumps to the tick by simulating from the closest keyframe before it,
+// returns the frames of the tick itself. ticks past the end stop at the end
+func (p *Player) JumpTo(tick int64) []*pb.ReplayFrame {
+	if tick < 0 {
+		tick = 0
+	} else if tick > p.LastTick {
+		tick = p.LastTick
+	}
+
+	// first keyframe after the tick, the one before it is where we start
+	k := sort.Search(len(p.keyframes), func(i int) bool {
+		return p.Frames[p.keyframes[i]].Tick > tick
+	})
+	keyframe := p.keyframes[k-1]
+
+	p.Sim = simulation.Restore(p.Arena, p.Header.Seed, State(p.Frames[keyframe], p.Arena))
+	p.next = keyframe + 1
+	p.Result = simulation.Result{}
+
+	for p.Sim.Tick < tick {
+		p.apply()
+		p.Sim.Step()
+	}
+
+	return p.apply()
+}
+
+// applies the frames up to the current tick and returns them
+func (p *Player) apply() []*pb.ReplayFrame {
+	start := p.next
+
+	for p.next < len(p.Frames) && p.Frames[p.next].Tick <= p.Sim.Tick {
+		frame := p.Frames[p.next]
+		p.next++
+
+		switch {
+		case frame.GetInput() != nil:
+			p.Sim.MovePaddle(frame.GetInput().Team, frame.GetInput().Direction)
+
+		case frame.GetSnapshot() != nil:
+			state := State(frame, p.Arena)
+			if state != p.Sim.State {
+				p.Mismatches++
+				p.Sim.State = state
+			}
+		}
+	}
+
+	return p.Frames[start:p.next]
+}
+
+// the latest event of the type played so far, nil if there was none
+func (p *Player) LastEvent(msgType pb.MsgType) *pb.Message {
+	for i := p.next - 1; i >= 0; i-- {
+		if event := p.Frames[i].GetEvent(); event != nil && event.Type == msgType {
+			return event
+		}
+	}
+
+	return nil
+}
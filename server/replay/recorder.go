@@ -0,0 +1,115 @@
+package replay
+
+import (
+	pb "github.com/mo-shahab/go-pong/proto"
+	"github.com/mo-shahab/go-pong/simulation"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// frames a recorder holds before it starts dropping them, a few minutes of
+// play even if the disk stalls
+const recorderBuffer = 8192
+
+// records a match in the background so the game loop never waits on the
+// disk, all methods are safe to call while holding other locks
+type Recorder struct {
+	ID      string
+	frames  chan *pb.ReplayFrame
+	done    chan struct{}
+	dropped atomic.Int64
+	once    sync.Once
+}
+
+// takes ownership of the writer and closes it once the recording is closed
+func NewRecorder(id string, w io.WriteCloser, header *pb.ReplayHeader) *Recorder {
+	r := &Recorder{
+		ID:     id,
+		frames: make(chan *pb.ReplayFrame, recorderBuffer),
+		done:   make(chan struct{}),
+	}
+
+	go r.run(w, header)
+
+	return r
+}
+
+func (r *Recorder) run(w io.WriteCloser, header *pb.ReplayHeader) {
+	defer close(r.done)
+
+	writer, err := NewWriter(w, header)
+
+	// keep draining after an error so the game never blocks on a dead
+	// recording
+	for frame := range r.frames {
+		if err == nil {
+			err = writer.WriteFrame(frame)
+		}
+	}
+
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		log.Printf("Failed to write replay %s: %v", r.ID, err)
+	}
+}
+
+func (r *Recorder) record(frame *pb.ReplayFrame) {
+	select {
+	case r.frames <- frame:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+func (r *Recorder) Input(tick int64, playerId string, team string, direction string) {
+	r.record(&pb.ReplayFrame{
+		Tick: tick,
+		Frame: &pb.ReplayFrame_Input{
+			Input: &pb.ReplayInput{
+				PlayerId:  playerId,
+				Team:      team,
+				Direction: direction,
+			},
+		},
+	})
+}
+
+func (r *Recorder) Snapshot(state simulation.State) {
+	r.record(&pb.ReplayFrame{
+		Tick: state.Tick,
+		Frame: &pb.ReplayFrame_Snapshot{
+			Snapshot: NewSnapshot(state),
+		},
+	})
+}
+
+// the message must not be changed after it was handed over
+func (r *Recorder) Event(tick int64, message *pb.Message) {
+	r.record(&pb.ReplayFrame{
+		Tick: tick,
+		Frame: &pb.ReplayFrame_Event{
+			Event: message,
+		},
+	})
+}
+
+// stops recording and waits for everything to reach the writer
+func (r *Recorder) Close() {
+	r.once.Do(func() {
+		close(r.frames)
+		<-r.done
+
+		if dropped := r.dropped.Load(); dropped > 0 {
+			log.Printf("Replay %s is incomplete, %d frames were dropped", r.ID, dropped)
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package replay
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/mo-shahab/go-pong/ball"
+	"github.com/mo-shahab/go-pong/canvas"
+	"github.com/mo-shahab/go-pong/paddle"
+	pb "github.com/mo-shahab/go-pong/proto"
+	"github.com/mo-shahab/go-pong/scores"
+	"github.com/mo-shahab/go-pong/simulation"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"io"
+)
+
+// file format constants, the version goes up whenever old readers would
+// misread new files
+const (
+	Magic   = "GPRP"
+	Version = 1
+)
+
+// ticks between keyframe snapshots, about a second of play
+const KeyframeInterval = 32
+
+var (
+	ErrNotReplay          = errors.New("not a replay file")
+	ErrUnsupportedVersion = errors.New("unsupported replay version")
+)
+
+// ---------------------------------------------------
+// Writer functions
+
+// writes a replay file, frames have to be written in tick order
+type Writer struct {
+	w *bufio.Writer
+}
+
+func NewWriter(w io.Writer, header *pb.ReplayHeader) (*Writer, error) {
+	writer := &Writer{w: bufio.NewWriter(w)}
+
+	if _, err := writer.w.WriteString(Magic); err != nil {
+		return nil, err
+	}
+
+	if err := writer.w.WriteByte(Version); err != nil {
+		return nil, err
+	}
+
+	if _, err := protodelim.MarshalTo(writer.w, header); err != nil {
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+func (w *Writer) WriteFrame(frame *pb.ReplayFrame) error {
+	_, err := protodelim.MarshalTo(w.w, frame)
+	return err
+}
+
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Reader functions
+
+// reads a replay file frame by frame
+type Reader struct {
+	Header *pb.ReplayHeader
+	r      *bufio.Reader
+}
+
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{r: bufio.NewReader(r)}
+
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(reader.r, magic); err != nil || string(magic) != Magic {
+		return nil, ErrNotReplay
+	}
+
+	version, err := reader.r.ReadByte()
+	if err != nil {
+		return nil, ErrNotReplay
+	}
+
+	if version != Version {
+		return nil, fmt.Errorf("%w %d", ErrUnsupportedVersion, version)
+	}
+
+	reader.Header = &pb.ReplayHeader{}
+	if err := protodelim.UnmarshalFrom(reader.r, reader.Header); err != nil {
+		return nil, fmt.Errorf("reading the replay header: %w", err)
+	}
+
+	return reader, nil
+}
+
+// returns io.EOF after the last frame, a replay cut short by a crash ends
+// with io.ErrUnexpectedEOF instead
+func (r *Reader) Next() (*pb.ReplayFrame, error) {
+	frame := &pb.ReplayFrame{}
+	if err := protodelim.UnmarshalFrom(r.r, frame); err != nil {
+		return nil, err
+	}
+
+	return frame, nil
+}
+
+// reads every remaining frame
+func (r *Reader) ReadAll() ([]*pb.ReplayFrame, error) {
+	frames := []*pb.ReplayFrame{}
+
+	for {
+		frame, err := r.Next()
+		if err == io.EOF {
+			return frames, nil
+		}
+		if err != nil {
+			return frames, err
+		}
+
+		frames = append(frames, frame)
+	}
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Conversion functions
+
+func NewArena(arena simulation.Arena) *pb.ReplayArena {
+	return &pb.ReplayArena{
+		Width:        arena.Canvas.Width,
+		Height:       arena.Canvas.Height,
+		PaddleWidth:  arena.Paddle.Width,
+		PaddleHeight: arena.Paddle.Height,
+		BallRadius:   arena.BallRadius,
+	}
+}
+
+func Arena(arena *pb.ReplayArena) simulation.Arena {
+	return simulation.Arena{
+		Canvas:     canvas.Canvas{Width: arena.GetWidth(), Height: arena.GetHeight()},
+		Paddle:     paddle.Paddle{Width: arena.GetPaddleWidth(), Height: arena.GetPaddleHeight()},
+		BallRadius: arena.GetBallRadius(),
+	}
+}
+
+func NewSnapshot(state simulation.State) *pb.ReplaySnapshot {
+	return &pb.ReplaySnapshot{
+		BallX:       state.Ball.X,
+		BallY:       state.Ball.Y,
+		BallDx:      state.Ball.Dx,
+		BallDy:      state.Ball.Dy,
+		LeftPaddle:  state.LeftPaddle,
+		RightPaddle: state.RightPaddle,
+		LeftScore:   state.Scores.LeftScores,
+		RightScore:  state.Scores.RightScores,
+	}
+}
+
+// simulation state of a snapshot frame, the ball radius comes from the
+// header's arena
+func State(frame *pb.ReplayFrame, arena simulation.Arena) simulation.State {
+	snapshot := frame.GetSnapshot()
+
+	return simulation.State{
+		Ball: ball.Ball{
+			X:       snapshot.GetBallX(),
+			Y:       snapshot.GetBallY(),
+			Dx:      snapshot.GetBallDx(),
+			Dy:      snapshot.GetBallDy(),
+			Radius:  arena.BallRadius,
+			Visible: true,
+		},
+		LeftPaddle:  snapshot.GetLeftPaddle(),
+		RightPaddle: snapshot.GetRightPaddle(),
+		Scores: scores.Scores{
+			LeftScores:  snapshot.GetLeftScore(),
+			RightScores: snapshot.GetRightScore(),
+		},
+		Tick: frame.GetTick(),
+	}
+}
+
+// ---------------------------------------------------
@@ -0,0 +1,96 @@
+package replay
+
+import (
+	"fmt"
+	pb "github.com/mo-shahab/go-pong/proto"
+	"github.com/mo-shahab/go-pong/simulation"
+)
+
+// first snapshot the simulation did not reproduce
+type Divergence struct {
+	Tick      int64
+	Recorded  simulation.State
+	Simulated simulation.State
+}
+
+// outcome of re-running a replay against its snapshots
+type Verification struct {
+	Ticks      int64
+	Snapshots  int // snapshots compared, the starting one is not counted
+	Inputs     int
+	Divergence *Divergence // nil when every snapshot matched
+}
+
+// ---------------------------------------------------
+// Verification functions
+
+// re-runs the match from the first snapshot using only the seed and the
+// recorded inputs, and compares the simulation with every later snapshot.
+// it stops at the first one that differs
+func Verify(header *pb.ReplayHeader, frames []*pb.ReplayFrame) (*Verification, error) {
+	if len(frames) == 0 || frames[0].GetSnapshot() == nil {
+		return nil, ErrNoKeyframe
+	}
+
+	arena := Arena(header.Arena)
+	sim := simulation.Restore(arena, header.Seed, State(frames[0], arena))
+	verification := &Verification{}
+
+	for _, frame := range frames[1:] {
+		for sim.Tick < frame.Tick {
+			sim.Step()
+		}
+
+		switch {
+		case frame.GetInput() != nil:
+			sim.MovePaddle(frame.GetInput().Team, frame.GetInput().Direction)
+			verification.Inputs++
+
+		case frame.GetSnapshot() != nil:
+			verification.Snapshots++
+
+			recorded := State(frame, arena)
+			if recorded != sim.State {
+				verification.Ticks = sim.Tick
+				verification.Divergence = &Divergence{
+					Tick:      frame.Tick,
+					Recorded:  recorded,
+					Simulated: sim.State,
+				}
+				return verification, nil
+			}
+		}
+	}
+
+	verification.Ticks = sim.Tick
+
+	return verification, nil
+}
+
+// the fields that differ, one line each
+func (d *Divergence) Differences() []string {
+	fields := []struct {
+		name                string
+		recorded, simulated any
+	}{
+		{"ball x", d.Recorded.Ball.X, d.Simulated.Ball.X},
+		{"ball y", d.Recorded.Ball.Y, d.Simulated.Ball.Y},
+		{"ball dx", d.Recorded.Ball.Dx, d.Simulated.Ball.Dx},
+		{"ball dy", d.Recorded.Ball.Dy, d.Simulated.Ball.Dy},
+		{"left paddle", d.Recorded.LeftPaddle, d.Simulated.LeftPaddle},
+		{"right paddle", d.Recorded.RightPaddle, d.Simulated.RightPaddle},
+		{"left score", d.Recorded.Scores.LeftScores, d.Simulated.Scores.LeftScores},
+		{"right score", d.Recorded.Scores.RightScores, d.Simulated.Scores.RightScores},
+	}
+
+	differences := []string{}
+	for _, field := range fields {
+		if field.recorded != field.simulated {
+			differences = append(differences, fmt.Sprintf("%s: recorded %v, simulated %v", field.name, field.recorded, field.simulated))
+		}
+	}
+
+	return differences
+}
+
+// ---------------------------------------------------
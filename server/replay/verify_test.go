@@ -0,0 +1,120 @@
+package replay
+
+import (
+	pb "github.com/mo-shahab/go-pong/proto"
+	"google.golang.org/protobuf/proto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// the corpus is matches recorded by the server, a player moving at random
+// against the bots and two players from a load test. a change to the
+// physics that is meant to change them has to record the corpus again,
+// anything else that breaks it is a regression
+const corpus = "testdata/*.replay"
+
+func readReplay(t *testing.T, path string) (*pb.ReplayHeader, []*pb.ReplayFrame) {
+	t.Helper()
+
+	replayFile, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replayFile.Close()
+
+	reader, err := NewReader(replayFile)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+
+	frames, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read the frames of %s: %v", path, err)
+	}
+
+	return reader.Header, frames
+}
+
+func corpusPaths(t *testing.T) []string {
+	t.Helper()
+
+	paths, err := filepath.Glob(corpus)
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("No replays in %s", corpus)
+	}
+
+	return paths
+}
+
+func TestVerifyCorpus(t *testing.T) {
+	for _, path := range corpusPaths(t) {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			header, frames := readReplay(t, path)
+
+			verification, err := Verify(header, frames)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if divergence := verification.Divergence; divergence != nil {
+				t.Errorf("diverged at tick %d after %d matching snapshots", divergence.Tick, verification.Snapshots-1)
+				for _, difference := range divergence.Differences() {
+					t.Error(difference)
+				}
+				return
+			}
+
+			if verification.Snapshots == 0 || verification.Inputs == 0 {
+				t.Fatalf("checked %d snapshots and %d inputs, the replay plays nothing", verification.Snapshots, verification.Inputs)
+			}
+		})
+	}
+}
+
+func TestVerifyDivergence(t *testing.T) {
+	header, frames := readReplay(t, corpusPaths(t)[0])
+
+	tests := []struct {
+		name   string
+		change func(snapshot *pb.ReplaySnapshot)
+		want   string
+	}{
+		{name: "ball", change: func(s *pb.ReplaySnapshot) { s.BallX++ }, want: "ball x"},
+		{name: "paddle", change: func(s *pb.ReplaySnapshot) { s.RightPaddle-- }, want: "right paddle"},
+		{name: "score", change: func(s *pb.ReplaySnapshot) { s.LeftScore++ }, want: "left score"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the last snapshot, copied so the other tests get the original
+			changed := make([]*pb.ReplayFrame, len(frames))
+			copy(changed, frames)
+
+			last := len(changed) - 1
+			for changed[last].GetSnapshot() == nil {
+				last--
+			}
+			tick := changed[last].Tick
+
+			changed[last] = proto.Clone(changed[last]).(*pb.ReplayFrame)
+			test.change(changed[last].GetSnapshot())
+
+			verification, err := Verify(header, changed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			divergence := verification.Divergence
+			if divergence == nil || divergence.Tick != tick {
+				t.Fatalf("got divergence %+v, want one at tick %d", divergence, tick)
+			}
+
+			differences := divergence.Differences()
+			if len(differences) != 1 || !strings.HasPrefix(differences[0], test.want) {
+				t.Fatalf("got differences %q, want only the %s", differences, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/mo-shahab/go-pong/render"
+	"github.com/mo-shahab/go-pong/replay"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// files the file store keeps replays in
+const replayFileExtension = ".replay"
+
+// gopong replay <command> ...
+func replayCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: gopong replay verify|render ...")
+		return 2
+	}
+
+	switch args[0] {
+	case "verify":
+		return verifyReplays(args[1:])
+	case "render":
+		return renderReplay(args[1:])
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown replay command %q\n", args[0])
+	return 2
+}
+
+// ---------------------------------------------------
+// Verify functions
+
+// re-simulates every replay and reports the first divergence of each one,
+// exits with 1 if any replay diverged or could not be read so it can gate
+// CI on a corpus of recorded matches
+func verifyReplays(args []string) int {
+	flags := flag.NewFlagSet("replay verify", flag.ContinueOnError)
+	quiet := flags.Bool("q", false, "only report replays that fail")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gopong replay verify [-q] <file or directory>...")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	paths, err := replayFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	failed := 0
+	for _, path := range paths {
+		if !verifyReplay(path, *quiet) {
+			failed++
+		}
+	}
+
+	fmt.Printf("%d replays verified, %d failed\n", len(paths), failed)
+
+	if failed > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+func verifyReplay(path string, quiet bool) bool {
+	replayFile, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("FAIL %s: %v\n", path, err)
+		return false
+	}
+	defer replayFile.Close()
+
+	reader, err := replay.NewReader(replayFile)
+	if err != nil {
+		fmt.Printf("FAIL %s: %v\n", path, err)
+		return false
+	}
+
+	// a replay cut short is still checked up to where it ends
+	frames, err := reader.ReadAll()
+	truncated := errors.Is(err, io.ErrUnexpectedEOF)
+	if err != nil && !truncated {
+		fmt.Printf("FAIL %s: %v\n", path, err)
+		return false
+	}
+
+	verification, err := replay.Verify(reader.Header, frames)
+	if err != nil {
+		fmt.Printf("FAIL %s: %v\n", path, err)
+		return false
+	}
+
+	if divergence := verification.Divergence; divergence != nil {
+		fmt.Printf("FAIL %s: diverged at tick %d after %d matching snapshots\n", path, divergence.Tick, verification.Snapshots-1)
+		for _, difference := range divergence.Differences() {
+			fmt.Printf("    %s\n", difference)
+		}
+		return false
+	}
+
+	if !quiet {
+		note := ""
+		if truncated {
+			note = ", truncated"
+		}
+
+		fmt.Printf("ok   %s: %d ticks, %d snapshots, %d inputs%s\n", path, verification.Ticks, verification.Snapshots, verification.Inputs, note)
+	}
+
+	return true
+}
+
+// expands directories into the replay files inside them
+func replayFiles(args []string) ([]string, error) {
+	paths := []string{}
+
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+
+		err = filepath.WalkDir(arg, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !entry.IsDir() && strings.HasSuffix(path, replayFileExtension) {
+				paths = append(paths, path)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return paths, nil
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Render functions
+
+// draws part of a replay as an animated GIF, or a single tick as a PNG when
+// the output ends in .png
+func renderReplay(args []string) int {
+	flags := flag.NewFlagSet("replay render", flag.ContinueOnError)
+	from := flags.Int64("from", 0, "first tick to draw")
+	to := flags.Int64("to", -1, "last tick to draw, -1 for the end of the replay")
+	every := flags.Int("every", 2, "draw every nth tick")
+	out := flags.String("out", "clip.gif", "output file, .gif or .png")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gopong replay render [--from tick] [--to tick] [--out clip.gif] <file>")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 || *every < 1 {
+		flags.Usage()
+		return 2
+	}
+
+	replayFile, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer replayFile.Close()
+
+	player, err := replay.Load(replayFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flags.Arg(0), err)
+		return 1
+	}
+
+	if *to < 0 {
+		*to = player.LastTick
+	}
+
+	if *to < *from {
+		fmt.Fprintln(os.Stderr, "--to comes before --from")
+		return 2
+	}
+
+	output, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer output.Close()
+
+	renderer := render.New(player.Arena)
+
+	if strings.HasSuffix(strings.ToLower(*out), ".png") {
+		player.JumpTo(*from)
+		err = renderer.PNG(output, player.Sim.State)
+	} else {
+		states := player.States(*from, *to, *every)
+		delay := time.Duration(player.Header.TickIntervalMs) * time.Millisecond * time.Duration(*every)
+		err = renderer.GIF(output, states, delay)
+	}
+
+	if err == nil {
+		err = output.Close()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Printf("wrote %s\n", *out)
+
+	return 0
+}
+
+// ---------------------------------------------------
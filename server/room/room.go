@@ -5,8 +5,10 @@ import (
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/mo-shahab/go-pong/client"
+	"github.com/mo-shahab/go-pong/clock"
 	"log"
 	"sync"
+	"time"
 )
 
 // typedef to define the Room
@@ -14,6 +16,7 @@ type Room struct {
 	ID         string
 	Host       *websocket.Conn
 	Clients    map[string]*client.Client
+	Spectators map[string]*client.Client
 	MaxPlayers int
 	Mu         sync.Mutex
 }
@@ -21,6 +24,7 @@ type Room struct {
 // state of all the rooms
 type RoomManager struct {
 	Rooms map[string]*Room
+	Clock clock.Clock // the waiting rooms count down on it
 	Mu    sync.Mutex
 }
 
@@ -29,6 +33,8 @@ type WaitingRoomState struct {
 	Room *Room
 	CurrentPlayers int
 	TimeLeft int
+	Deadline time.Time
+	Clock clock.Clock
 	IsActive bool
 	Ctx context.Context
 	Cancel context.CancelFunc
@@ -38,20 +44,42 @@ type WaitingRoomState struct {
 func NewRoomManager() *RoomManager {
 	return &RoomManager{
 		Rooms: make(map[string]*Room),
+		Clock: clock.Real{},
 	}
 }
 
-func NewWaitingRoomState(room *Room, timeLeft int, ctx context.Context, cancel context.CancelFunc) *WaitingRoomState {
+// the context is done once the clock has moved past the deadline, or when
+// the waiting room is cancelled
+func NewWaitingRoomState(room *Room, clk clock.Clock, duration time.Duration) *WaitingRoomState {
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	timeout := clk.AfterFunc(duration, cancelCtx)
+
 	return &WaitingRoomState{
 		Room:           room,
 		CurrentPlayers: len(room.Clients),
-		TimeLeft:       timeLeft,
+		TimeLeft:       int(duration.Seconds()),
+		Deadline:       clk.Now().Add(duration),
+		Clock:          clk,
 		IsActive:       true,
 		Ctx:            ctx,
-		Cancel:         cancel,
+		Cancel: func() {
+			timeout.Stop()
+			cancelCtx()
+		},
 	}
 }
 
+// a waiting room for one of the manager's rooms, on the manager's clock
+func (rm *RoomManager) NewWaitingRoom(room *Room, duration time.Duration) *WaitingRoomState {
+	return NewWaitingRoomState(room, rm.Clock, duration)
+}
+
+// works out TimeLeft from the deadline, expects w.Mu to be held
+func (w *WaitingRoomState) UpdateTimeLeft() int {
+	w.TimeLeft = max(int(w.Deadline.Sub(w.Clock.Now()).Seconds()), 0)
+	return w.TimeLeft
+}
+
 
 // helpers
 func generateRoomId() string {
@@ -72,6 +100,7 @@ func (rm *RoomManager) CreateRoom(host *client.Client, maxPlayers int) string {
 		ID:         roomId,
 		Host:       host.Conn,
 		Clients:    map[string]*client.Client{host.ID: host},
+		Spectators: make(map[string]*client.Client),
 		MaxPlayers: maxPlayers,
 	}
 
@@ -100,7 +129,26 @@ func (rm *RoomManager) JoinRoom(roomId string, client *client.Client) (bool, str
 	}
 
 	room.Clients[client.ID] = client
-	log.Println("Client %s joined the Room with room id: %s", client.ID, roomId)
+	log.Printf("Client %s joined the Room with room id: %s", client.ID, roomId)
+
+	return true, ""
+}
+
+// spectators do not take a player slot, so any existing room can be watched
+func (rm *RoomManager) Spectate(roomId string, client *client.Client) (bool, string) {
+	rm.Mu.Lock()
+	defer rm.Mu.Unlock()
+
+	room, exists := rm.Rooms[roomId]
+	if !exists {
+		return false, "Room id is invalid"
+	}
+
+	room.Mu.Lock()
+	defer room.Mu.Unlock()
+
+	room.Spectators[client.ID] = client
+	log.Printf("Client %s is spectating the Room with room id: %s", client.ID, roomId)
 
 	return true, ""
 }
@@ -117,17 +165,37 @@ func (rm *RoomManager) RemoveClient(roomId string, clientId string) {
 	room.Mu.Lock()
 	defer room.Mu.Unlock()
 
+	// spectators leaving never close the room
+	if _, spectating := room.Spectators[clientId]; spectating {
+		delete(room.Spectators, clientId)
+		return
+	}
+
+	leaving, exists := room.Clients[clientId]
+	if !exists {
+		return
+	}
+
 	delete(room.Clients, clientId)
 
-	if room.MaxPlayers == 0 || room.Clients[clientId].Conn == room.Host {
+	if room.MaxPlayers == 0 || leaving.Conn == room.Host {
 
 		for _, client := range room.Clients {
+			// bots have no connection, they leave once the room is gone
+			if client.Conn == nil {
+				continue
+			}
+
 			// write the protobuf message saying that the room is closed (broadcast it basically)
 			client.Conn.Close()
 		}
 
+		for _, client := range room.Spectators {
+			client.Conn.Close()
+		}
+
 		delete(rm.Rooms, roomId)
-		log.Println("Room with %s has been closed", roomId)
+		log.Printf("Room with %s has been closed", roomId)
 	}
 }
 
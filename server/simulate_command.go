@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/mo-shahab/go-pong/bot"
+	"github.com/mo-shahab/go-pong/canvas"
+	"github.com/mo-shahab/go-pong/match"
+	"github.com/mo-shahab/go-pong/paddle"
+	"github.com/mo-shahab/go-pong/simulation"
+	"github.com/mo-shahab/go-pong/wsserver"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// the settings a run was made with, written next to the statistics so
+// sweeps over them can be compared
+type simulateSettings struct {
+	Width                 float64 `json:"width"`
+	Height                float64 `json:"height"`
+	PaddleWidth           float64 `json:"paddle_width"`
+	PaddleHeight          float64 `json:"paddle_height"`
+	BallRadius            float64 `json:"ball_radius"`
+	BallSpeed             float64 `json:"ball_speed"`
+	MaxBounceAngleDegrees float64 `json:"max_bounce_angle_degrees"`
+	PaddleStep            float64 `json:"paddle_step"`
+	WinningScore          int32   `json:"winning_score"`
+	Seed                  int64   `json:"seed"`
+}
+
+type simulateOutput struct {
+	Settings simulateSettings `json:"settings"`
+	match.Summary
+}
+
+// gopong simulate [flags]
+// plays bot against bot matches in-process as fast as the cpu allows and
+// prints aggregate statistics, for tuning the physics with data
+func simulateCommand(args []string) int {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	matches := flags.Int("matches", 100, "number of matches to play")
+	seed := flags.Int64("seed", 1, "seed of the first match, match i uses seed+i")
+	left := flags.String("left", "medium", "difficulty of the left bot")
+	right := flags.String("right", "medium", "difficulty of the right bot")
+	parallel := flags.Int("parallel", runtime.GOMAXPROCS(0), "matches played at the same time")
+	format := flags.String("format", "json", "output format, json or csv")
+	out := flags.String("out", "", "file to write to instead of stdout")
+	noHeader := flags.Bool("no-header", false, "leave out the csv header row, for appending to a sweep")
+
+	width := flags.Float64("width", 800, "arena width")
+	height := flags.Float64("height", 600, "arena height")
+	paddleWidth := flags.Float64("paddle-width", 10, "paddle width")
+	paddleHeight := flags.Float64("paddle-height", 100, "paddle height")
+	ballRadius := flags.Float64("ball-radius", simulation.BallRadius, "ball radius")
+	ballSpeed := flags.Float64("ball-speed", simulation.BallSpeed, "ball speed when served, in pixels per tick")
+	maxBounceAngle := flags.Float64("max-bounce-angle", simulation.MaxBounceAngle*180/math.Pi, "bounce angle off the paddle's edge, in degrees")
+	paddleStep := flags.Float64("paddle-step", simulation.PaddleStep, "pixels a paddle moves per input")
+	winningScore := flags.Int("winning-score", wsserver.WinningScore, "goals that win a match")
+	maxMinutes := flags.Float64("max-minutes", 10, "minutes of play after which a match is a draw")
+
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gopong simulate [flags]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	leftBot, ok := bot.ByName(*left)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown difficulty %q\n", *left)
+		return 2
+	}
+
+	rightBot, ok := bot.ByName(*right)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown difficulty %q\n", *right)
+		return 2
+	}
+
+	if *format != "json" && *format != "csv" {
+		fmt.Fprintf(os.Stderr, "unknown format %q, use json or csv\n", *format)
+		return 2
+	}
+
+	// the float checks are written so NaN fails them too
+	if *matches < 1 || *parallel < 1 || *winningScore < 1 || !(*maxMinutes > 0) {
+		fmt.Fprintln(os.Stderr, "-matches, -parallel, -winning-score and -max-minutes must be positive")
+		return 2
+	}
+
+	for _, size := range []float64{*width, *height, *paddleWidth, *paddleHeight, *ballRadius, *ballSpeed, *paddleStep} {
+		if !(size > 0) {
+			fmt.Fprintln(os.Stderr, "the arena, paddle, ball radius, ball speed and paddle step must be positive")
+			return 2
+		}
+	}
+
+	// the same shape the server asks of a player's arena
+	if !(*paddleWidth <= *width/4) {
+		fmt.Fprintln(os.Stderr, "-paddle-width must be at most a quarter of -width")
+		return 2
+	}
+
+	diameter := 2 * *ballRadius
+	if !(*paddleHeight >= diameter && *paddleHeight <= *height-2*diameter) {
+		fmt.Fprintln(os.Stderr, "-paddle-height must be between the ball's diameter and -height less two diameters")
+		return 2
+	}
+
+	config := match.Config{
+		Arena: simulation.Arena{
+			Canvas:     canvas.Canvas{Width: *width, Height: *height},
+			Paddle:     paddle.Paddle{Width: *paddleWidth, Height: *paddleHeight},
+			BallRadius: *ballRadius,
+		},
+		Physics: simulation.Physics{
+			BallSpeed:      *ballSpeed,
+			MaxBounceAngle: *maxBounceAngle * math.Pi / 180,
+			PaddleStep:     *paddleStep,
+		},
+		Left:         leftBot,
+		Right:        rightBot,
+		WinningScore: int32(*winningScore),
+		TickInterval: wsserver.BallTickInterval,
+		MaxTicks:     int64(time.Duration(*maxMinutes*float64(time.Minute)) / wsserver.BallTickInterval),
+	}
+
+	output := simulateOutput{
+		Settings: simulateSettings{
+			Width:                 *width,
+			Height:                *height,
+			PaddleWidth:           *paddleWidth,
+			PaddleHeight:          *paddleHeight,
+			BallRadius:            *ballRadius,
+			BallSpeed:             *ballSpeed,
+			MaxBounceAngleDegrees: *maxBounceAngle,
+			PaddleStep:            *paddleStep,
+			WinningScore:          int32(*winningScore),
+			Seed:                  *seed,
+		},
+		Summary: match.Summarize(config, playMatches(config, *seed, *matches, *parallel)),
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	var err error
+	if *format == "csv" {
+		err = writeSimulateCSV(w, output, !*noHeader)
+	} else {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(output)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+// plays the matches on a pool of goroutines, the results are in seed order
+// so the output does not depend on -parallel
+func playMatches(config match.Config, seed int64, matches int, parallel int) []match.Result {
+	results := make([]match.Result, matches)
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(parallel, matches) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = match.Play(config, seed+int64(i))
+			}
+		}()
+	}
+
+	for i := range matches {
+		next <- i
+	}
+	close(next)
+
+	wg.Wait()
+
+	return results
+}
+
+// one row per run, the speed histogram is only in the json output
+func writeSimulateCSV(w io.Writer, output simulateOutput, header bool) error {
+	settings := output.Settings
+	summary := output.Summary
+
+	float := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	columns := []struct {
+		name  string
+		value string
+	}{
+		{"width", float(settings.Width)},
+		{"height", float(settings.Height)},
+		{"paddle_width", float(settings.PaddleWidth)},
+		{"paddle_height", float(settings.PaddleHeight)},
+		{"ball_radius", float(settings.BallRadius)},
+		{"ball_speed", float(settings.BallSpeed)},
+		{"max_bounce_angle_degrees", float(settings.MaxBounceAngleDegrees)},
+		{"paddle_step", float(settings.PaddleStep)},
+		{"winning_score", strconv.Itoa(int(settings.WinningScore))},
+		{"seed", strconv.FormatInt(settings.Seed, 10)},
+		{"matches", strconv.Itoa(summary.Matches)},
+		{"draws", strconv.Itoa(summary.Draws)},
+		{"left_bot", summary.Left.Bot},
+		{"left_wins", strconv.Itoa(summary.Left.Wins)},
+		{"left_win_rate", float(summary.Left.WinRate)},
+		{"right_bot", summary.Right.Bot},
+		{"right_wins", strconv.Itoa(summary.Right.Wins)},
+		{"right_win_rate", float(summary.Right.WinRate)},
+		{"rallies", strconv.Itoa(summary.Rallies)},
+		{"average_rally_hits", float(summary.AverageRallyHits)},
+		{"average_rally_seconds", float(summary.AverageRallySeconds)},
+		{"longest_rally_hits", strconv.Itoa(summary.LongestRallyHits)},
+		{"goals_per_minute", float(summary.GoalsPerMinute)},
+		{"average_match_seconds", float(summary.AverageMatchSeconds)},
+		{"ball_speed_mean", float(summary.BallSpeed.Mean)},
+		{"ball_speed_p50", float(summary.BallSpeed.P50)},
+		{"ball_speed_p90", float(summary.BallSpeed.P90)},
+		{"ball_speed_max", float(summary.BallSpeed.Max)},
+	}
+
+	writer := csv.NewWriter(w)
+
+	if header {
+		names := []string{}
+		for _, column := range columns {
+			names = append(names, column.name)
+		}
+		writer.Write(names)
+	}
+
+	values := []string{}
+	for _, column := range columns {
+		values = append(values, column.value)
+	}
+	writer.Write(values)
+
+	writer.Flush()
+	return writer.Error()
+}
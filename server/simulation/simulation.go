@@ -0,0 +1,269 @@
+package simulation
+
+import (
+	"github.com/mo-shahab/go-pong/ball"
+	"github.com/mo-shahab/go-pong/canvas"
+	"github.com/mo-shahab/go-pong/paddle"
+	"github.com/mo-shahab/go-pong/scores"
+	"math"
+	"math/rand/v2"
+)
+
+// ball constants
+const (
+	BallRadius     = 8
+	BallSpeed      = 10
+	MaxBounceAngle = math.Pi / 3 // 60 degrees max
+)
+
+// paddle constants
+const (
+	PaddleStep = 30
+)
+
+// tunable rules of the physics, live games and replays always use the
+// defaults
+type Physics struct {
+	BallSpeed      float64 // pixels per tick when served
+	MaxBounceAngle float64 // radians off the horizontal at the paddle's edge
+	PaddleStep     float64 // pixels per paddle move
+}
+
+var DefaultPhysics = Physics{
+	BallSpeed:      BallSpeed,
+	MaxBounceAngle: MaxBounceAngle,
+	PaddleStep:     PaddleStep,
+}
+
+// size of the play field, set by the first client to initialize the game
+type Arena struct {
+	Canvas     canvas.Canvas
+	Paddle     paddle.Paddle
+	BallRadius float64
+}
+
+// everything that changes while the game runs, enough to continue the
+// simulation from a snapshot
+type State struct {
+	Ball        ball.Ball
+	LeftPaddle  float64
+	RightPaddle float64
+	Scores      scores.Scores
+	Tick        int64
+}
+
+// what happened during a tick, teams are "left" or "right"
+type Result struct {
+	Hit  string // team whose paddle hit the ball
+	Goal string // team that scored
+}
+
+// deterministic pong physics, the same seed, arena and paddle moves always
+// play out the same way. it is not safe for concurrent use
+type Simulation struct {
+	Arena   Arena
+	Physics Physics
+	Seed    int64
+	State
+}
+
+// starts with the ball in the middle heading left and both paddles centered
+func New(arena Arena, seed int64) *Simulation {
+	return NewWithPhysics(arena, DefaultPhysics, seed)
+}
+
+// like New with other rules, for trying out changes to the game
+func NewWithPhysics(arena Arena, physics Physics, seed int64) *Simulation {
+	if arena.BallRadius == 0 {
+		arena.BallRadius = BallRadius
+	}
+
+	s := &Simulation{
+		Arena:   arena,
+		Physics: physics,
+		Seed:    seed,
+	}
+
+	s.Ball = ball.Ball{
+		X:       arena.Canvas.Width / 2,
+		Y:       arena.Canvas.Height / 2,
+		Dx:      -physics.BallSpeed,
+		Dy:      0,
+		Radius:  arena.BallRadius,
+		Visible: true,
+	}
+
+	center := (arena.Canvas.Height / 2) - (arena.Paddle.Height / 2)
+	s.LeftPaddle = center
+	s.RightPaddle = center
+
+	return s
+}
+
+// continues from a snapshot taken earlier from a simulation with the same
+// arena and seed
+func Restore(arena Arena, seed int64, state State) *Simulation {
+	return &Simulation{
+		Arena:   arena,
+		Physics: DefaultPhysics,
+		Seed:    seed,
+		State:   state,
+	}
+}
+
+// random numbers for the current tick, derived from the seed and the tick so
+// snapshots do not need to carry generator state
+func (s *Simulation) rand() *rand.Rand {
+	return rand.New(rand.NewPCG(uint64(s.Seed), uint64(s.Tick)))
+}
+
+// ---------------------------------------------------
+// Ball Logic functions
+
+// advances the game by one tick
+func (s *Simulation) Step() Result {
+	rng := s.rand()
+	result := Result{}
+
+	s.moveBall()
+	result.Hit = s.handlePaddleCollision(rng)
+	result.Goal = s.checkBallOutOfBounds(rng)
+
+	s.Tick++
+
+	return result
+}
+
+func (s *Simulation) moveBall() {
+	s.Ball.X += s.Ball.Dx
+	s.Ball.Y += s.Ball.Dy
+
+	// wall collision (top & bottom)
+	if s.Ball.Y-s.Ball.Radius <= 0 || s.Ball.Y+s.Ball.Radius >= s.Arena.Canvas.Height {
+		s.Ball.Dy *= -1
+	}
+}
+
+// bounces the ball off a paddle, the further from the paddle's center it
+// hits the steeper it leaves. returns the team that hit it
+func (s *Simulation) handlePaddleCollision(rng *rand.Rand) string {
+	ballRadius := s.Ball.Radius
+	paddleHeight := s.Arena.Paddle.Height
+
+	leftPaddleRight := s.Arena.Paddle.Width
+	leftPaddleTop := s.LeftPaddle
+	leftPaddleBottom := leftPaddleTop + paddleHeight
+
+	rightPaddleLeft := s.Arena.Canvas.Width - s.Arena.Paddle.Width
+	rightPaddleTop := s.RightPaddle
+	rightPaddleBottom := rightPaddleTop + paddleHeight
+
+	ballSpeed := math.Hypot(s.Ball.Dx, s.Ball.Dy)
+	hit := ""
+
+	if s.Ball.X-ballRadius <= leftPaddleRight &&
+		s.Ball.Y >= leftPaddleTop &&
+		s.Ball.Y <= leftPaddleBottom {
+
+		relativePosition := (s.Ball.Y - (leftPaddleTop + paddleHeight/2)) / (paddleHeight / 2)
+		bounceAngle := relativePosition * s.Physics.MaxBounceAngle
+		s.Ball.Dx = math.Abs(ballSpeed * math.Cos(bounceAngle))
+		s.Ball.Dy = ballSpeed * math.Sin(bounceAngle)
+		s.Ball.Dy += randomVariation(rng)
+		s.Ball.X = leftPaddleRight + ballRadius
+		hit = "left"
+	}
+
+	if s.Ball.X+ballRadius >= rightPaddleLeft &&
+		s.Ball.Y >= rightPaddleTop &&
+		s.Ball.Y <= rightPaddleBottom {
+
+		relativePosition := (s.Ball.Y - (rightPaddleTop + paddleHeight/2)) / (paddleHeight / 2)
+		bounceAngle := relativePosition * s.Physics.MaxBounceAngle
+		s.Ball.Dx = -math.Abs(ballSpeed * math.Cos(bounceAngle))
+		s.Ball.Dy = ballSpeed * math.Sin(bounceAngle)
+		s.Ball.Dy += randomVariation(rng)
+		s.Ball.X = rightPaddleLeft - ballRadius
+		hit = "right"
+	}
+
+	return hit
+}
+
+// scores the goal if the ball went past a paddle and serves it again from
+// the middle, returns the team that scored
+func (s *Simulation) checkBallOutOfBounds(rng *rand.Rand) string {
+	// ball went past the left paddle, the right team scores
+	if s.Ball.X-s.Ball.Radius <= 0 {
+		s.Scores.RightScores++
+		s.resetBall(1, rng)
+		return "right"
+	}
+
+	// ball went past the right paddle, the left team scores
+	if s.Ball.X+s.Ball.Radius >= s.Arena.Canvas.Width {
+		s.Scores.LeftScores++
+		s.resetBall(-1, rng)
+		return "left"
+	}
+
+	return ""
+}
+
+func (s *Simulation) resetBall(directionX int, rng *rand.Rand) {
+	s.Ball.X = s.Arena.Canvas.Width / 2
+	s.Ball.Y = s.Arena.Canvas.Height / 2
+
+	s.Ball.Dx = float64(directionX) * s.Physics.BallSpeed
+	s.Ball.Dy = (rng.Float64() - 0.5) * 5.0
+}
+
+func randomVariation(rng *rand.Rand) float64 {
+	return (rng.Float64() - 0.5) * 2
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Paddle Logic functions
+
+// moves the team's paddle one step up or down, moves that would leave the
+// arena are ignored. returns whether the paddle moved
+func (s *Simulation) MovePaddle(team string, direction string) bool {
+	var movement float64
+
+	if direction == "up" {
+		movement = -s.Physics.PaddleStep
+	} else if direction == "down" {
+		movement = s.Physics.PaddleStep
+	} else {
+		return false
+	}
+
+	position := &s.LeftPaddle
+	if team == "right" {
+		position = &s.RightPaddle
+	} else if team != "left" {
+		return false
+	}
+
+	newPosition := *position + movement
+	if newPosition < 0 || newPosition+s.Arena.Paddle.Height > s.Arena.Canvas.Height {
+		return false
+	}
+
+	*position = newPosition
+
+	return true
+}
+
+// top edge of the team's paddle
+func (s State) PaddlePosition(team string) float64 {
+	if team == "right" {
+		return s.RightPaddle
+	}
+
+	return s.LeftPaddle
+}
+
+// ---------------------------------------------------
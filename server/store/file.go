@@ -0,0 +1,420 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mo-shahab/go-pong/rating"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// file store layout and compaction constants
+const (
+	logFileName      = "store.log"
+	replayDirName    = "replays"
+	replayExtension  = ".replay"
+	compactThreshold = 1000
+)
+
+// record kinds in the log
+const (
+	recordPlayer  = "player"
+	recordAccount = "account"
+	recordMatch   = "match"
+	recordRating  = "rating"
+)
+
+var replayIdPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// a single line of the log
+type record struct {
+	Kind    string         `json:"kind"`
+	Player  *Player        `json:"player,omitempty"`
+	Account *Account       `json:"account,omitempty"`
+	Match   *MatchResult   `json:"match,omitempty"`
+	Rating  *rating.Rating `json:"rating,omitempty"`
+}
+
+// embedded on-disk store, players, matches and ratings are appended to a
+// JSON lines log that is replayed into memory on open, replays are kept as
+// one file each
+type FileStore struct {
+	Dir string
+
+	index   *MemoryStore
+	logFile *os.File
+	records int
+	closed  bool
+	Mu      sync.Mutex
+}
+
+func OpenFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, replayDirName), 0755); err != nil {
+		return nil, err
+	}
+
+	fs := &FileStore{
+		Dir:   dir,
+		index: NewMemoryStore(),
+	}
+
+	if err := fs.load(); err != nil {
+		return nil, err
+	}
+
+	if fs.records > compactThreshold && fs.records > 2*fs.liveRecords() {
+		if err := fs.compact(); err != nil {
+			return nil, err
+		}
+	}
+
+	logFile, err := os.OpenFile(fs.logPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fs.logFile = logFile
+
+	log.Printf("Opened store in %s with %d records", dir, fs.records)
+
+	return fs, nil
+}
+
+// helpers
+func (fs *FileStore) logPath() string {
+	return filepath.Join(fs.Dir, logFileName)
+}
+
+func (fs *FileStore) replayPath(id string) (string, error) {
+	if !replayIdPattern.MatchString(id) {
+		return "", fmt.Errorf("invalid replay id %q", id)
+	}
+
+	return filepath.Join(fs.Dir, replayDirName, id+replayExtension), nil
+}
+
+func (fs *FileStore) liveRecords() int {
+	return len(fs.index.Players) + len(fs.index.Accounts) + len(fs.index.Matches) + len(fs.index.Ratings)
+}
+
+func (fs *FileStore) apply(rec record) error {
+	switch {
+	case rec.Kind == recordPlayer && rec.Player != nil:
+		return fs.index.PutPlayer(*rec.Player)
+	case rec.Kind == recordAccount && rec.Account != nil:
+		return fs.index.PutAccount(*rec.Account)
+	case rec.Kind == recordMatch && rec.Match != nil:
+		return fs.index.AddMatch(*rec.Match)
+	case rec.Kind == recordRating && rec.Rating != nil:
+		return fs.index.PutRating(*rec.Rating)
+	}
+
+	return fmt.Errorf("unknown record kind %q", rec.Kind)
+}
+
+// replays the log into the in memory index
+func (fs *FileStore) load() error {
+	logFile, err := os.Open(fs.logPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	// end of the last complete line
+	var offset int64
+
+	reader := bufio.NewReader(logFile)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// a line without a newline was cut off by a crash mid write, it
+			// is cut off the file so the next record starts on its own line
+			if len(line) > 0 {
+				if len(strings.TrimSpace(string(line))) > 0 {
+					log.Println("Dropping a truncated record at the end of the store log")
+				}
+				return os.Truncate(fs.logPath(), offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(line))
+
+		rec := record{}
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("corrupt store log record %d: %w", fs.records+1, err)
+		}
+
+		if err := fs.apply(rec); err != nil {
+			return err
+		}
+		fs.records++
+	}
+}
+
+// rewrites the log with only the latest version of every record
+func (fs *FileStore) compact() error {
+	tmpPath := fs.logPath() + ".tmp"
+
+	tmpFile, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(tmpFile)
+	encoder := json.NewEncoder(writer)
+	written := 0
+
+	write := func(rec record) {
+		if err == nil {
+			err = encoder.Encode(rec)
+			written++
+		}
+	}
+
+	playerIds := make([]string, 0, len(fs.index.Players))
+	for id := range fs.index.Players {
+		playerIds = append(playerIds, id)
+	}
+	sort.Strings(playerIds)
+
+	for _, id := range playerIds {
+		player := fs.index.Players[id]
+		write(record{Kind: recordPlayer, Player: &player})
+	}
+
+	for _, account := range fs.index.Accounts {
+		write(record{Kind: recordAccount, Account: &account})
+	}
+
+	for i := range fs.index.Matches {
+		write(record{Kind: recordMatch, Match: &fs.index.Matches[i]})
+	}
+
+	for _, r := range fs.index.Ratings {
+		write(record{Kind: recordRating, Rating: &r})
+	}
+
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, fs.logPath()); err != nil {
+		return err
+	}
+
+	log.Printf("Compacted the store log from %d to %d records", fs.records, written)
+	fs.records = written
+
+	return nil
+}
+
+func (fs *FileStore) append(rec record) error {
+	fs.Mu.Lock()
+	defer fs.Mu.Unlock()
+
+	if fs.closed {
+		return ErrClosed
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fs.logFile.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	if err := fs.logFile.Sync(); err != nil {
+		return err
+	}
+
+	fs.records++
+
+	return fs.apply(rec)
+}
+
+// ---------------------------------------------------
+// Players
+
+func (fs *FileStore) GetPlayer(id string) (Player, bool, error) {
+	return fs.index.GetPlayer(id)
+}
+
+func (fs *FileStore) FindPlayerByToken(tokenHash string) (Player, bool, error) {
+	return fs.index.FindPlayerByToken(tokenHash)
+}
+
+func (fs *FileStore) PutPlayer(player Player) error {
+	return fs.append(record{Kind: recordPlayer, Player: &player})
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Accounts
+
+func (fs *FileStore) GetAccount(username string) (Account, bool, error) {
+	return fs.index.GetAccount(username)
+}
+
+func (fs *FileStore) PutAccount(account Account) error {
+	return fs.append(record{Kind: recordAccount, Account: &account})
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Matches
+
+func (fs *FileStore) AddMatch(match MatchResult) error {
+	return fs.append(record{Kind: recordMatch, Match: &match})
+}
+
+func (fs *FileStore) GetMatch(id string) (MatchResult, bool, error) {
+	return fs.index.GetMatch(id)
+}
+
+func (fs *FileStore) ListMatches(limit int) ([]MatchResult, error) {
+	return fs.index.ListMatches(limit)
+}
+
+func (fs *FileStore) ListPlayerMatches(playerId string, limit int) ([]MatchResult, error) {
+	return fs.index.ListPlayerMatches(playerId, limit)
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Ratings
+
+func (fs *FileStore) GetRating(playerId string) (rating.Rating, bool, error) {
+	return fs.index.GetRating(playerId)
+}
+
+func (fs *FileStore) PutRating(r rating.Rating) error {
+	return fs.append(record{Kind: recordRating, Rating: &r})
+}
+
+func (fs *FileStore) ListRatings() ([]rating.Rating, error) {
+	return fs.index.ListRatings()
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Replays
+
+// writes to a temporary file that is renamed into place on close, so a
+// replay that is still being recorded is never listed
+type fileReplayWriter struct {
+	*os.File
+	path string
+}
+
+func (w *fileReplayWriter) Close() error {
+	if err := w.File.Close(); err != nil {
+		os.Remove(w.File.Name())
+		return err
+	}
+
+	return os.Rename(w.File.Name(), w.path)
+}
+
+func (fs *FileStore) CreateReplay(id string) (io.WriteCloser, error) {
+	path, err := fs.replayPath(id)
+	if err != nil {
+		return nil, err
+	}
+
+	replayFile, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileReplayWriter{File: replayFile, path: path}, nil
+}
+
+func (fs *FileStore) OpenReplay(id string) (io.ReadCloser, error) {
+	// ids that could not have been stored are simply not found
+	path, err := fs.replayPath(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	replayFile, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return replayFile, err
+}
+
+func (fs *FileStore) ListReplays() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(fs.Dir, replayDirName))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, replayExtension) {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, replayExtension))
+	}
+
+	return ids, nil
+}
+
+func (fs *FileStore) DeleteReplay(id string) error {
+	path, err := fs.replayPath(id)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// ---------------------------------------------------
+
+func (fs *FileStore) Close() error {
+	fs.Mu.Lock()
+	defer fs.Mu.Unlock()
+
+	if fs.closed {
+		return nil
+	}
+
+	fs.closed = true
+	return fs.logFile.Close()
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"github.com/mo-shahab/go-pong/rating"
+	"github.com/mo-shahab/go-pong/scores"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// the store logs every open, which buries the test output
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func openTestStore(t *testing.T, dir string) *FileStore {
+	t.Helper()
+
+	fs, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to open the store: %v", err)
+	}
+
+	return fs
+}
+
+func TestFileStoreTruncatedTail(t *testing.T) {
+	tests := []struct {
+		name string
+		tail string
+	}{
+		{name: "cut off record", tail: `{"kind":"player","player":{"id":"cut`},
+		{name: "blank tail", tail: "  "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			fs := openTestStore(t, dir)
+			if err := fs.PutPlayer(Player{ID: "first", Name: "First"}); err != nil {
+				t.Fatal(err)
+			}
+			fs.Close()
+
+			// a crash in the middle of writing the next record
+			logFile, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			logFile.WriteString(test.tail)
+			logFile.Close()
+
+			fs = openTestStore(t, dir)
+			if err := fs.PutPlayer(Player{ID: "second", Name: "Second"}); err != nil {
+				t.Fatal(err)
+			}
+			fs.Close()
+
+			fs = openTestStore(t, dir)
+			defer fs.Close()
+
+			for _, id := range []string{"first", "second"} {
+				if _, found, _ := fs.GetPlayer(id); !found {
+					t.Fatalf("player %s is missing after reopening", id)
+				}
+			}
+		})
+	}
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	player := Player{ID: "p1", Name: "First", TokenHash: "hash", CreatedAt: at, LastSeen: at}
+	account := Account{Username: "first", PasswordHash: "secret", PlayerId: "p1", CreatedAt: at}
+	match := MatchResult{
+		ID:           "m1",
+		RoomId:       "room",
+		Winner:       "Left",
+		Scores:       scores.Scores{LeftScores: 5, RightScores: 3},
+		Participants: []Participant{{PlayerId: "p1", Name: "First", Team: "left", Hits: 12}},
+		Goals:        []Goal{{Team: "left", ScorerIds: []string{"p1"}, Time: 4.5, Scores: scores.Scores{LeftScores: 1}, Rally: 3}},
+		Duration:     61.5,
+		LongestRally: 9,
+		ReplayId:     "m1",
+		StartedAt:    at,
+		EndedAt:      at.Add(time.Minute),
+	}
+	r := rating.Rating{PlayerId: "p1", Rating: 1520.5, Deviation: 180, Volatility: 0.06, Matches: 1, UpdatedAt: at}
+
+	tests := []struct {
+		name string
+		// times the player is written again before closing, past the
+		// threshold the log is compacted on the next open
+		rewrites    int
+		wantRecords int
+	}{
+		{name: "reopen", rewrites: 0, wantRecords: 4},
+		{name: "compacted", rewrites: compactThreshold, wantRecords: 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			fs := openTestStore(t, dir)
+			for _, err := range []error{
+				fs.PutPlayer(player),
+				fs.PutAccount(account),
+				fs.AddMatch(match),
+				fs.PutRating(r),
+			} {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < test.rewrites; i++ {
+				if err := fs.PutPlayer(player); err != nil {
+					t.Fatal(err)
+				}
+			}
+			fs.Close()
+
+			fs = openTestStore(t, dir)
+			defer fs.Close()
+
+			if fs.records != test.wantRecords {
+				t.Errorf("got %d records after reopening, want %d", fs.records, test.wantRecords)
+			}
+
+			if got, _, _ := fs.GetPlayer(player.ID); !reflect.DeepEqual(got, player) {
+				t.Errorf("got player %+v, want %+v", got, player)
+			}
+			if got, found, _ := fs.FindPlayerByToken(player.TokenHash); !found || got.ID != player.ID {
+				t.Errorf("got player %+v by token, want %s", got, player.ID)
+			}
+			if got, _, _ := fs.GetAccount(account.Username); !reflect.DeepEqual(got, account) {
+				t.Errorf("got account %+v, want %+v", got, account)
+			}
+			if got, _, _ := fs.GetMatch(match.ID); !reflect.DeepEqual(got, match) {
+				t.Errorf("got match %+v, want %+v", got, match)
+			}
+			if got, _, _ := fs.GetRating(r.PlayerId); !reflect.DeepEqual(got, r) {
+				t.Errorf("got rating %+v, want %+v", got, r)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package store
+
+import (
+	"bytes"
+	"github.com/mo-shahab/go-pong/rating"
+	"io"
+	"sort"
+	"sync"
+)
+
+// keeps everything in maps, nothing survives a restart, meant for tests and
+// as the index behind the file store
+type MemoryStore struct {
+	Players  map[string]Player
+	Accounts map[string]Account
+	Matches  []MatchResult
+	Ratings  map[string]rating.Rating
+	Replays  map[string][]byte
+	Mu       sync.Mutex
+
+	matchIndex map[string]int
+	tokenIndex map[string]string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		Players:    make(map[string]Player),
+		Accounts:   make(map[string]Account),
+		Ratings:    make(map[string]rating.Rating),
+		Replays:    make(map[string][]byte),
+		matchIndex: make(map[string]int),
+		tokenIndex: make(map[string]string),
+	}
+}
+
+// ---------------------------------------------------
+// Players
+
+func (ms *MemoryStore) GetPlayer(id string) (Player, bool, error) {
+	ms.Mu.Lock()
+	defer ms.Mu.Unlock()
+
+	player, found := ms.Players[id]
+	return player, found, nil
+}
+
+func (ms *MemoryStore) FindPlayerByToken(tokenHash string) (Player, bool, error) {
+	ms.Mu.Lock()
+	defer ms.Mu.Unlock()
+
+	id, found := ms.tokenIndex[tokenHash]
+	if !found {
+		return Player{}, false, nil
+	}
+
+	return ms.Players[id], true, nil
+}
+
+func (ms *MemoryStore) PutPlayer(player Player) error {
+	ms.Mu.Lock()
+	defer ms.Mu.Unlock()
+
+	if previous, exists := ms.Players[player.ID]; exists {
+		delete(ms.tokenIndex, previous.TokenHash)
+	}
+
+	if player.TokenHash != "" {
+		ms.tokenIndex[player.TokenHash] = player.ID
+	}
+
+	ms.Players[player.ID] = player
+	return nil
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Accounts
+
+func (ms *MemoryStore) GetAccount(username string) (Account, bool, error) {
+	ms.Mu.Lock()
+	defer ms.Mu.Unlock()
+
+	account, found := ms.Accounts[username]
+	return account, found, nil
+}
+
+func (ms *MemoryStore) PutAccount(account Account) error {
+	ms.Mu.Lock()
+	defer ms.Mu.Unlock()
+
+	ms.Accounts[account.Username] = account
+	return nil
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Matches
+
+func (ms *MemoryStore) AddMatch(match MatchResult) error {
+	ms.Mu.Lock()
+	defer ms.Mu.Unlock()
+
+	if i, exists := ms.matchIndex[match.ID]; exists {
+		ms.Matches[i] = match
+		return nil
+	}
+
+	ms.matchIndex[match.ID] = len(ms.Matches)
+	ms.Matches = append(ms.Matches, match)
+	return nil
+}
+
+func (ms *MemoryStore) GetMatch(id string) (MatchResult, bool, error) {
+	ms.Mu.Lock()
+	defer ms.Mu.Unlock()
+
+	i, exists := ms.matchIndex[id]
+	if !exists {
+		return MatchResult{}, false, nil
+	}
+
+	return ms.Matches[i], true, nil
+}
+
+func (ms *MemoryStore) ListMatches(limit int) ([]MatchResult, error) {
+	return ms.listMatches(limit, func(MatchResult) bool { return true }), nil
+}
+
+func (ms *MemoryStore) ListPlayerMatches(playerId string, limit int) ([]MatchResult, error) {
+	return ms.listMatches(limit, func(match MatchResult) bool {
+		for _, participant := range match.Participants {
+			if participant.PlayerId == playerId {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func (ms *MemoryStore) listMatches(limit int, keep func(MatchResult) bool) []MatchResult {
+	ms.Mu.Lock()
+	defer ms.Mu.Unlock()
+
+	matches := []MatchResult{}
+	for i := len(ms.Matches) - 1; i >= 0; i-- {
+		if limit > 0 && len(matches) >= limit {
+			break
+		}
+
+		if keep(ms.Matches[i]) {
+			matches = append(matches, ms.Matches[i])
+		}
+	}
+
+	return matches
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Ratings
+
+func (ms *MemoryStore) GetRating(playerId string) (rating.Rating, bool, error) {
+	ms.Mu.Lock()
+	defer ms.Mu.Unlock()
+
+	r, found := ms.Ratings[playerId]
+	return r, found, nil
+}
+
+func (ms *MemoryStore) PutRating(r rating.Rating) error {
+	ms.Mu.Lock()
+	defer ms.Mu.Unlock()
+
+	ms.Ratings[r.PlayerId] = r
+	return nil
+}
+
+func (ms *MemoryStore) ListRatings() ([]rating.Rating, error) {
+	ms.Mu.Lock()
+	defer ms.Mu.Unlock()
+
+	ratings := make([]rating.Rating, 0, len(ms.Ratings))
+	for _, r := range ms.Ratings {
+		ratings = append(ratings, r)
+	}
+
+	return ratings, nil
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Replays
+
+// buffers the replay and only makes it visible once it is closed
+type memoryReplayWriter struct {
+	bytes.Buffer
+	id    string
+	store *MemoryStore
+}
+
+func (w *memoryReplayWriter) Close() error {
+	w.store.Mu.Lock()
+	defer w.store.Mu.Unlock()
+
+	w.store.Replays[w.id] = w.Bytes()
+	return nil
+}
+
+func (ms *MemoryStore) CreateReplay(id string) (io.WriteCloser, error) {
+	return &memoryReplayWriter{id: id, store: ms}, nil
+}
+
+func (ms *MemoryStore) OpenReplay(id string) (io.ReadCloser, error) {
+	ms.Mu.Lock()
+	defer ms.Mu.Unlock()
+
+	data, exists := ms.Replays[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (ms *MemoryStore) ListReplays() ([]string, error) {
+	ms.Mu.Lock()
+	defer ms.Mu.Unlock()
+
+	ids := make([]string, 0, len(ms.Replays))
+	for id := range ms.Replays {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+func (ms *MemoryStore) DeleteReplay(id string) error {
+	ms.Mu.Lock()
+	defer ms.Mu.Unlock()
+
+	delete(ms.Replays, id)
+	return nil
+}
+
+// ---------------------------------------------------
+
+func (ms *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"errors"
+	"github.com/mo-shahab/go-pong/rating"
+	"github.com/mo-shahab/go-pong/scores"
+	"io"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrClosed   = errors.New("store is closed")
+)
+
+// a player known to the server
+type Player struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	TokenHash string    `json:"token_hash,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// a registered account, the player it owns carries the identity used for
+// ratings and match history
+type Account struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash"`
+	PlayerId     string    `json:"player_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// a player taking part in a match
+type Participant struct {
+	PlayerId string `json:"player_id"`
+	Name     string `json:"name"`
+	Team     string `json:"team"`
+	Hits     int    `json:"hits"`
+}
+
+// a goal in the match timeline, the time is counted from the start of the
+// match
+type Goal struct {
+	Team      string        `json:"team"`
+	ScorerIds []string      `json:"scorer_ids"`
+	Time      float64       `json:"time_seconds"`
+	Scores    scores.Scores `json:"scores"`
+	Rally     int           `json:"rally"`
+}
+
+// outcome and statistics of a finished match, the ball speed is in pixels
+// per second
+type MatchResult struct {
+	ID               string        `json:"id"`
+	RoomId           string        `json:"room_id"`
+	Winner           string        `json:"winner"`
+	Scores           scores.Scores `json:"scores"`
+	Participants     []Participant `json:"participants"`
+	Goals            []Goal        `json:"goals"`
+	Duration         float64       `json:"duration_seconds"`
+	LongestRally     int           `json:"longest_rally"`
+	AverageBallSpeed float64       `json:"average_ball_speed"`
+	ReplayId         string        `json:"replay_id,omitempty"`
+	StartedAt        time.Time     `json:"started_at"`
+	EndedAt          time.Time     `json:"ended_at"`
+}
+
+type Players interface {
+	GetPlayer(id string) (Player, bool, error)
+	FindPlayerByToken(tokenHash string) (Player, bool, error)
+	PutPlayer(player Player) error
+}
+
+// usernames are unique, callers are expected to check before creating
+type Accounts interface {
+	GetAccount(username string) (Account, bool, error)
+	PutAccount(account Account) error
+}
+
+// match results are listed newest first
+type Matches interface {
+	AddMatch(match MatchResult) error
+	GetMatch(id string) (MatchResult, bool, error)
+	ListMatches(limit int) ([]MatchResult, error)
+	ListPlayerMatches(playerId string, limit int) ([]MatchResult, error)
+}
+
+type Ratings interface {
+	rating.Store
+}
+
+// replays are opaque blobs, written and read as streams since they can
+// get large
+type Replays interface {
+	CreateReplay(id string) (io.WriteCloser, error)
+	OpenReplay(id string) (io.ReadCloser, error)
+	ListReplays() ([]string, error)
+	DeleteReplay(id string) error
+}
+
+type Store interface {
+	Players
+	Accounts
+	Matches
+	Ratings
+	Replays
+	Close() error
+}
@@ -0,0 +1,291 @@
+package tui
+
+import (
+	"fmt"
+	pb "github.com/mo-shahab/go-pong/proto"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// smallest terminal the arena is drawn in
+const (
+	minColumns = 30
+	minRows    = 10
+)
+
+// arena assumed until the server sends the room's
+var defaultArena = &pb.ReplayArena{Width: 800, Height: 600, PaddleWidth: 10, PaddleHeight: 100}
+
+// ---------------------------------------------------
+// Draw functions
+
+// redraws the screen if anything changed, the size is checked every frame
+// so resizing the terminal just works
+func (app *App) draw(fd int) {
+	columns, rows, err := size(fd)
+	if err != nil || columns <= 0 || rows <= 0 {
+		columns, rows = 80, 24
+	}
+
+	app.Mu.Lock()
+	defer app.Mu.Unlock()
+
+	flashing := app.Scored != "" && time.Since(app.ScoredAt) < goalFlash+frameInterval
+	if !app.dirty && !flashing && columns == app.columns && rows == app.rows {
+		return
+	}
+
+	app.dirty = false
+	app.columns = columns
+	app.rows = rows
+
+	var lines []string
+	switch app.Screen {
+	case screenLobby:
+		lines = app.lobbyLines()
+	case screenPrompt:
+		lines = app.promptLines()
+	case screenQueue:
+		lines = app.queueLines()
+	case screenWaiting:
+		lines = app.waitingLines()
+	case screenGame:
+		lines = app.gameLines(columns, rows)
+	case screenEnd:
+		lines = app.endLines()
+	}
+
+	if app.Screen != screenGame {
+		lines = center(lines, columns, rows-1)
+	}
+
+	for len(lines) < rows-1 {
+		lines = append(lines, "")
+	}
+	lines = append(lines[:rows-1], app.footer())
+
+	frame := strings.Builder{}
+	frame.WriteString("\x1b[H")
+	for i, line := range lines {
+		frame.WriteString(fit(line, columns))
+		frame.WriteString("\x1b[K")
+		if i < len(lines)-1 {
+			frame.WriteString("\r\n")
+		}
+	}
+
+	fmt.Fprint(app.out, frame.String())
+}
+
+func (app *App) lobbyLines() []string {
+	return []string{
+		"G O - P O N G",
+		"",
+		"Playing as " + app.Name,
+		"",
+		"c  create a room ",
+		"j  join a room   ",
+		"s  spectate      ",
+		"m  quick match   ",
+		"q  quit          ",
+	}
+}
+
+func (app *App) promptLines() []string {
+	return []string{
+		fmt.Sprintf("Room to %s: %s_", app.Prompt, app.Input),
+		"",
+		"enter to go, esc to go back",
+	}
+}
+
+func (app *App) queueLines() []string {
+	lines := []string{"Looking for a casual match...", ""}
+
+	if m := app.Matchmaking; m != nil {
+		lines = append(lines,
+			fmt.Sprintf("%d queued, about %ds to go", m.QueuedPlayers, m.EstimatedWait),
+			fmt.Sprintf("%ds in the queue", m.TimeInQueue),
+		)
+	}
+
+	return append(lines, "", "esc to cancel")
+}
+
+func (app *App) waitingLines() []string {
+	lines := []string{"Room " + app.RoomId, ""}
+
+	maxPlayers := int32(0)
+	if w := app.Waiting; w != nil && w.Room != nil {
+		maxPlayers = w.Room.MaxPlayers
+	}
+
+	lines = append(lines, fmt.Sprintf("Players %d/%d", len(app.Players), maxPlayers))
+	for _, player := range app.Players {
+		name := player.Name
+		if player.Bot {
+			name += " (bot)"
+		}
+		if player.PlayerId == app.PlayerId {
+			name += " (you)"
+		}
+		lines = append(lines, "  "+name)
+	}
+
+	if app.Spectators > 0 {
+		lines = append(lines, fmt.Sprintf("%d watching", app.Spectators))
+	}
+
+	lines = append(lines, "")
+
+	switch w := app.Waiting; {
+	case w == nil:
+		lines = append(lines, "Waiting for the room")
+	case w.IsActive:
+		lines = append(lines, fmt.Sprintf("Starting in %ds", w.TimeLeft))
+	default:
+		lines = append(lines, "Waiting for players")
+	}
+
+	lines = append(lines, "")
+	if app.Host {
+		lines = append(lines, "b add a bot, q to quit")
+	} else {
+		lines = append(lines, "q to quit")
+	}
+
+	return lines
+}
+
+// the score on top, the arena in a box scaled to the terminal and the keys
+// at the bottom
+func (app *App) gameLines(columns int, rows int) []string {
+	header := fmt.Sprintf(" LEFT %d : %d RIGHT", app.LeftScore, app.RightScore)
+	if app.Team != "" {
+		header += "   you: " + app.Team
+	}
+
+	width := columns - 2
+	height := rows - 4
+	if width < minColumns-2 || height < minRows-4 {
+		return []string{header, "", "The terminal is too small, make it bigger"}
+	}
+
+	arena := app.Arena
+	if arena == nil {
+		arena = defaultArena
+	}
+
+	grid := make([][]rune, height)
+	for y := range grid {
+		grid[y] = []rune(strings.Repeat(" ", width))
+		if y%2 == 0 {
+			grid[y][width/2] = '┊'
+		}
+	}
+
+	// paddles cover every row they touch
+	paddle := func(column int, top float64) {
+		from := int(top / arena.Height * float64(height))
+		to := int(math.Ceil((top + arena.PaddleHeight) / arena.Height * float64(height)))
+		for y := max(from, 0); y < min(to, height); y++ {
+			grid[y][column] = '█'
+		}
+	}
+
+	paddle(0, app.LeftPaddle)
+	paddle(width-1, app.RightPaddle)
+
+	if ball := app.Ball; ball != nil {
+		x := clamp(int(ball.X/arena.Width*float64(width)), 0, width-1)
+		y := clamp(int(ball.Y/arena.Height*float64(height)), 0, height-1)
+		grid[y][x] = '●'
+	}
+
+	lines := []string{header, "┌" + strings.Repeat("─", width) + "┐"}
+	for _, row := range grid {
+		lines = append(lines, "│"+string(row)+"│")
+	}
+	lines = append(lines, "└"+strings.Repeat("─", width)+"┘")
+
+	return lines
+}
+
+// the line at the bottom, goals and errors before the keys of the game
+func (app *App) footer() string {
+	if app.Screen != screenGame {
+		return app.Status
+	}
+
+	switch {
+	case app.Scored != "" && time.Since(app.ScoredAt) < goalFlash:
+		return " " + strings.ToUpper(app.Scored) + " SCORES"
+	case app.Status != "":
+		return " " + app.Status
+	case app.Team == "spectator":
+		return " watching, q to quit"
+	}
+
+	return " ↑/↓ or w/s to move, q to quit"
+}
+
+func (app *App) endLines() []string {
+	m := app.End
+	lines := []string{
+		fmt.Sprintf("%s WINS %d : %d", strings.ToUpper(m.Winner), m.LeftScore, m.RightScore),
+		"",
+	}
+
+	switch app.Team {
+	case m.Winner:
+		lines = append(lines, "You won!")
+	case "left", "right":
+		lines = append(lines, "You lost")
+	}
+
+	if result := m.Result; result != nil {
+		lines = append(lines,
+			fmt.Sprintf("%.0fs played, longest rally %d hits", result.DurationSeconds, result.LongestRally),
+		)
+	}
+
+	for _, rating := range m.Ratings {
+		lines = append(lines, fmt.Sprintf("%s %.0f (%+.0f)", rating.Name, rating.Rating, rating.Change))
+	}
+
+	return append(lines, "", "enter for the lobby, q to quit")
+}
+
+// centers the block of lines on the screen
+func center(lines []string, columns int, rows int) []string {
+	widest := 0
+	for _, line := range lines {
+		widest = max(widest, utf8.RuneCountInString(line))
+	}
+
+	left := strings.Repeat(" ", max((columns-widest)/2, 0))
+	centered := make([]string, max((rows-len(lines))/2, 0))
+	for _, line := range lines {
+		centered = append(centered, left+line)
+	}
+
+	return centered
+}
+
+// cuts the line to the width, the rest of the row is cleared when drawn
+func fit(line string, width int) string {
+	runes := []rune(line)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+
+	return line
+}
+
+func clamp(value, low, high int) int {
+	return max(low, min(value, high))
+}
+
+// ---------------------------------------------------
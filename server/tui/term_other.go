@@ -0,0 +1,21 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package tui
+
+import "errors"
+
+var errUnsupported = errors.New("the terminal client is not supported on this platform")
+
+type terminalState struct{}
+
+func makeRaw(fd int) (*terminalState, error) {
+	return nil, errUnsupported
+}
+
+func restore(fd int, state *terminalState) error {
+	return errUnsupported
+}
+
+func size(fd int) (int, int, error) {
+	return 0, 0, errUnsupported
+}
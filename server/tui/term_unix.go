@@ -0,0 +1,68 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package tui
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// terminal settings to put back when the tui exits
+type terminalState struct {
+	termios syscall.Termios
+}
+
+// ---------------------------------------------------
+// Terminal functions
+
+// turns off echo, line buffering and signals on the terminal so every key
+// press is read as it comes, like cfmakeraw
+func makeRaw(fd int) (*terminalState, error) {
+	termios := syscall.Termios{}
+	if err := ioctl(fd, ioctlGetTermios, unsafe.Pointer(&termios)); err != nil {
+		return nil, err
+	}
+
+	state := &terminalState{termios: termios}
+
+	termios.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	termios.Oflag &^= syscall.OPOST
+	termios.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	termios.Cflag &^= syscall.CSIZE | syscall.PARENB
+	termios.Cflag |= syscall.CS8
+	termios.Cc[syscall.VMIN] = 1
+	termios.Cc[syscall.VTIME] = 0
+
+	if err := ioctl(fd, ioctlSetTermios, unsafe.Pointer(&termios)); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func restore(fd int, state *terminalState) error {
+	return ioctl(fd, ioctlSetTermios, unsafe.Pointer(&state.termios))
+}
+
+// columns and rows of the terminal
+func size(fd int) (int, int, error) {
+	var winsize struct {
+		Rows, Cols, Xpixel, Ypixel uint16
+	}
+
+	if err := ioctl(fd, syscall.TIOCGWINSZ, unsafe.Pointer(&winsize)); err != nil {
+		return 0, 0, err
+	}
+
+	return int(winsize.Cols), int(winsize.Rows), nil
+}
+
+func ioctl(fd int, request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// ---------------------------------------------------
@@ -0,0 +1,556 @@
+// terminal client, plays and spectates over the game server from a terminal
+// with ansi escapes and box drawing characters
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mo-shahab/go-pong/gopongclient"
+	pb "github.com/mo-shahab/go-pong/proto"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redraw and request timing
+const (
+	frameInterval  = 33 * time.Millisecond
+	requestTimeout = 5 * time.Second
+	goalFlash      = 2 * time.Second
+)
+
+// the screens of the tui
+const (
+	screenLobby   = "lobby"
+	screenPrompt  = "prompt"
+	screenQueue   = "queue"
+	screenWaiting = "waiting"
+	screenGame    = "game"
+	screenEnd     = "end"
+)
+
+// keys that are not a single printable byte
+const (
+	keyUp    = "up"
+	keyDown  = "down"
+	keyEnter = "enter"
+	keyEsc   = "esc"
+	keyBack  = "backspace"
+	keyQuit  = "ctrl-c"
+)
+
+var errQuit = errors.New("quit")
+
+type Options struct {
+	URL      string
+	Name     string
+	Token    string // guest token to play as an earlier player
+	Room     string // room to join right away
+	Spectate bool   // watch the room instead of playing in it
+}
+
+// what is on screen, guarded by Mu
+type App struct {
+	Client *gopongclient.Client
+
+	Mu     sync.Mutex
+	Screen string
+	Status string // last error or notice, shown under the screen
+
+	Name     string
+	PlayerId string
+
+	// room and lobby
+	Prompt      string // what the join prompt is for, "join" or "spectate"
+	Input       string
+	RoomId      string
+	Host        bool
+	Players     []*pb.PlayerInfo
+	Spectators  int32
+	Waiting     *pb.WaitingRoomStateMessage
+	Matchmaking *pb.MatchmakingStatusMessage
+
+	// game
+	Arena       *pb.ReplayArena
+	Team        string
+	Ball        *pb.Ball
+	LeftPaddle  float64
+	RightPaddle float64
+	LeftScore   int32
+	RightScore  int32
+	Scored      string
+	ScoredAt    time.Time
+	End         *pb.MatchEndMessage
+
+	keys     chan string
+	quit     chan error
+	readying bool // a spectator's ready is on its way
+	out      io.Writer
+	dirty    bool
+	columns  int // size of the last frame
+	rows     int
+}
+
+// ---------------------------------------------------
+// App functions
+
+// connects and runs the tui on the terminal until the player quits
+func Run(options Options) error {
+	in := int(os.Stdin.Fd())
+
+	state, err := makeRaw(in)
+	if err != nil {
+		return fmt.Errorf("gopong tui needs a terminal: %w", err)
+	}
+	defer restore(in, state)
+
+	app := &App{
+		Screen: screenLobby,
+		keys:   make(chan string, 16),
+		quit:   make(chan error, 1),
+		out:    os.Stdout,
+		dirty:  true,
+	}
+
+	// alternate screen, hidden cursor
+	fmt.Fprint(app.out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(app.out, "\x1b[?25h\x1b[?1049l")
+
+	app.Client = gopongclient.New(gopongclient.Options{
+		URL:       options.URL,
+		Name:      options.Name,
+		Token:     options.Token,
+		Reconnect: true,
+	})
+	app.handle()
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	err = app.Client.Connect(ctx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer app.Client.Close()
+
+	go app.readKeys(os.Stdin)
+
+	if options.Room != "" {
+		go app.join(options.Room, options.Spectate)
+	}
+
+	ticker := time.NewTicker(frameInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case key := <-app.keys:
+			app.key(key)
+
+		case <-ticker.C:
+			app.draw(in)
+
+		case err := <-app.quit:
+			if errors.Is(err, errQuit) {
+				return nil
+			}
+			return err
+
+		case <-app.Client.Done():
+			return errors.New("the connection to the server was lost")
+		}
+	}
+}
+
+// wires the client's events to the screen, the callbacks only update state
+// so the client can keep reading
+func (app *App) handle() {
+	h := &app.Client.Handlers
+
+	h.Disconnected = func(err error) {
+		app.update(func() { app.Status = "Connection lost, reconnecting..." })
+	}
+
+	h.Connected = func(resumed bool) {
+		if resumed {
+			app.update(func() { app.Status = "Reconnected" })
+		}
+	}
+
+	h.Identity = func(m *pb.IdentityMessage) {
+		app.update(func() {
+			app.Name = m.Name
+			app.PlayerId = m.PlayerId
+		})
+	}
+
+	h.Error = func(m *pb.ErrorMessage) {
+		app.update(func() { app.Status = m.Error })
+	}
+
+	h.RoomPlayers = func(m *pb.RoomPlayersMessage) {
+		app.update(func() {
+			app.Players = m.Players
+			app.Spectators = m.Spectators
+		})
+	}
+
+	h.WaitingRoom = func(m *pb.WaitingRoomStateMessage) {
+		app.update(func() {
+			app.Waiting = m
+			if app.Screen == screenQueue {
+				app.Screen = screenWaiting
+			}
+		})
+	}
+
+	h.MatchmakingStatus = func(m *pb.MatchmakingStatusMessage) {
+		app.update(func() {
+			app.Matchmaking = m
+			if m.Cancelled && app.Screen == screenQueue {
+				app.Screen = screenLobby
+			}
+		})
+	}
+
+	h.MatchFound = func(m *pb.MatchFoundMessage) {
+		app.update(func() {
+			app.enterRoom(m.RoomId, false)
+			app.Status = "Match found"
+		})
+	}
+
+	// ready has to wait for the server, so it runs off the reading goroutine
+	h.GameStart = func(m *pb.GameStartMessage) {
+		go app.ready()
+	}
+
+	h.InitialGameState = func(m *pb.InitialGameStateMessage) {
+		app.update(func() {
+			app.Team = m.YourTeam
+
+			// a spectator can get ready before any player set up the game,
+			// there is no arena yet and it asks again once the ball moves
+			if m.Arena == nil {
+				return
+			}
+
+			app.Screen = screenGame
+			app.Arena = m.Arena
+			app.LeftPaddle = m.LeftPaddleData
+			app.RightPaddle = m.RightPaddleData
+		})
+	}
+
+	h.GameState = func(m *pb.GameStateMessage) {
+		app.update(func() {
+			if m.LeftPaddleData != nil {
+				app.LeftPaddle = *m.LeftPaddleData
+			}
+			if m.RightPaddleData != nil {
+				app.RightPaddle = *m.RightPaddleData
+			}
+		})
+	}
+
+	h.PaddlePositions = func(m *pb.PaddlePositionsMessage) {
+		app.update(func() {
+			app.LeftPaddle = m.LeftPaddleData
+			app.RightPaddle = m.RightPaddleData
+		})
+	}
+
+	h.BallPosition = func(m *pb.BallPositionMessage) {
+		app.update(func() {
+			app.Ball = m.Ball
+
+			if app.Arena == nil && app.Team == "spectator" && !app.readying {
+				app.readying = true
+				go app.ready()
+			}
+		})
+	}
+
+	h.Score = func(m *pb.ScoreMessage) {
+		app.update(func() {
+			app.LeftScore = m.LeftScore
+			app.RightScore = m.RightScore
+			app.Scored = m.Scored
+			app.ScoredAt = time.Now()
+		})
+	}
+
+	h.MatchEnd = func(m *pb.MatchEndMessage) {
+		app.update(func() {
+			app.End = m
+			app.LeftScore = m.LeftScore
+			app.RightScore = m.RightScore
+			app.Screen = screenEnd
+		})
+	}
+
+	h.RoomClosed = func(m *pb.RoomClosedMessage) {
+		app.update(func() {
+			if app.Screen != screenEnd {
+				app.Screen = screenLobby
+			}
+			app.Status = "Room closed: " + m.Reason
+		})
+	}
+}
+
+// ends Run, the first reason wins
+func (app *App) stop(err error) {
+	select {
+	case app.quit <- err:
+	default:
+	}
+}
+
+func (app *App) update(change func()) {
+	app.Mu.Lock()
+	defer app.Mu.Unlock()
+
+	change()
+	app.dirty = true
+}
+
+// resets the room and game state for a room just entered, expects app.Mu
+// to be held
+func (app *App) enterRoom(roomId string, host bool) {
+	app.Screen = screenWaiting
+	app.RoomId = roomId
+	app.Host = host
+	app.Players = nil
+	app.Spectators = 0
+	app.Waiting = nil
+	app.Matchmaking = nil
+	app.Arena = nil
+	app.Team = ""
+	app.Ball = nil
+	app.LeftScore = 0
+	app.RightScore = 0
+	app.Scored = ""
+	app.End = nil
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Request functions
+
+func (app *App) create() {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	roomId, err := app.Client.CreateRoom(ctx, 2)
+	app.update(func() {
+		if err != nil {
+			app.Status = err.Error()
+			return
+		}
+		app.enterRoom(roomId, true)
+		app.Status = ""
+	})
+}
+
+func (app *App) join(roomId string, spectate bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	response, err := app.Client.JoinRoom(ctx, roomId, spectate)
+	app.update(func() {
+		if err != nil {
+			app.Screen = screenLobby
+			app.Status = err.Error()
+			return
+		}
+		app.enterRoom(roomId, false)
+		app.Status = ""
+		if response.Spectator {
+			app.Status = "Watching room " + roomId
+		}
+	})
+
+	// a game already running can be watched right away
+	if err == nil && response.Spectator {
+		app.ready()
+	}
+}
+
+func (app *App) enqueue() {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	status, err := app.Client.Enqueue(ctx, "casual", 1)
+	app.update(func() {
+		if err != nil {
+			app.Screen = screenLobby
+			app.Status = err.Error()
+			return
+		}
+		app.Screen = screenQueue
+		app.Matchmaking = status
+		app.Status = ""
+	})
+}
+
+// gets the arena and the starting state, the room's arena is set by the
+// first player so the tui scales whatever it gets
+func (app *App) ready() {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	_, err := app.Client.Ready(ctx, gopongclient.DefaultArena)
+	app.update(func() {
+		app.readying = false
+		if err != nil {
+			app.Status = err.Error()
+		}
+	})
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Input functions
+
+// turns the terminal's bytes into keys, arrows come as escape sequences
+func (app *App) readKeys(in io.Reader) {
+	buffer := make([]byte, 64)
+
+	for {
+		n, err := in.Read(buffer)
+		if err != nil {
+			app.stop(err)
+			return
+		}
+
+		chunk := buffer[:n]
+		for len(chunk) > 0 {
+			key, length := parseKey(chunk)
+			chunk = chunk[length:]
+			if key != "" {
+				app.keys <- key
+			}
+		}
+	}
+}
+
+// the first key in the bytes and how many bytes it took
+func parseKey(b []byte) (string, int) {
+	switch {
+	case len(b) >= 3 && b[0] == 0x1b && (b[1] == '[' || b[1] == 'O'):
+		switch b[2] {
+		case 'A':
+			return keyUp, 3
+		case 'B':
+			return keyDown, 3
+		}
+		return "", 3
+	case b[0] == 0x1b:
+		return keyEsc, 1
+	case b[0] == '\r' || b[0] == '\n':
+		return keyEnter, 1
+	case b[0] == 0x7f || b[0] == 0x08:
+		return keyBack, 1
+	case b[0] == 0x03:
+		return keyQuit, 1
+	}
+
+	return string(b[:1]), 1
+}
+
+func (app *App) key(key string) {
+	if key == keyQuit {
+		app.stop(errQuit)
+		return
+	}
+
+	app.Mu.Lock()
+	screen := app.Screen
+	app.Mu.Unlock()
+
+	switch screen {
+	case screenLobby:
+		switch key {
+		case "c":
+			go app.create()
+		case "j", "s":
+			app.update(func() {
+				app.Screen = screenPrompt
+				app.Prompt = map[string]string{"j": "join", "s": "spectate"}[key]
+				app.Input = ""
+				app.Status = ""
+			})
+		case "m":
+			go app.enqueue()
+		case "q":
+			app.stop(errQuit)
+		}
+
+	case screenPrompt:
+		switch key {
+		case keyEsc:
+			app.update(func() { app.Screen = screenLobby })
+		case keyEnter:
+			app.Mu.Lock()
+			roomId := strings.TrimSpace(app.Input)
+			spectate := app.Prompt == "spectate"
+			app.Mu.Unlock()
+
+			if roomId != "" {
+				go app.join(roomId, spectate)
+			}
+		case keyBack:
+			app.update(func() {
+				if len(app.Input) > 0 {
+					app.Input = app.Input[:len(app.Input)-1]
+				}
+			})
+		default:
+			if len(key) == 1 && key[0] > ' ' && key[0] < 0x7f {
+				app.update(func() { app.Input += key })
+			}
+		}
+
+	case screenQueue:
+		switch key {
+		case keyEsc, "q":
+			app.Client.CancelMatchmaking()
+		}
+
+	case screenWaiting:
+		switch key {
+		case "b":
+			app.Client.AddBot("")
+		case "q":
+			app.stop(errQuit)
+		}
+
+	case screenGame:
+		switch key {
+		case keyUp, "w", "k":
+			app.Client.Move(gopongclient.Up)
+		case keyDown, "s", "j":
+			app.Client.Move(gopongclient.Down)
+		case "q":
+			app.stop(errQuit)
+		}
+
+	case screenEnd:
+		switch key {
+		case keyEnter, keyEsc:
+			app.update(func() {
+				app.Screen = screenLobby
+				app.Status = ""
+			})
+		case "q":
+			app.stop(errQuit)
+		}
+	}
+}
+
+// ---------------------------------------------------
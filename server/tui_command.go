@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mo-shahab/go-pong/tui"
+	"os"
+)
+
+// gopong tui [flags]
+// plays or watches from the terminal
+func tuiCommand(args []string) int {
+	flags := flag.NewFlagSet("tui", flag.ContinueOnError)
+	url := flags.String("url", "ws://localhost:8080/ws", "websocket endpoint of the server")
+	name := flags.String("name", "", "display name, a guest name is picked if empty")
+	token := flags.String("token", "", "guest token to play as an earlier player")
+	room := flags.String("room", "", "room to join right away")
+	spectate := flags.Bool("spectate", false, "watch the room given with -room instead of playing")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gopong tui [flags]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	err := tui.Run(tui.Options{
+		URL:      *url,
+		Name:     *name,
+		Token:    *token,
+		Room:     *room,
+		Spectate: *spectate,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,263 @@
+package wsserver
+
+import (
+	"github.com/google/uuid"
+	"github.com/mo-shahab/go-pong/bot"
+	"github.com/mo-shahab/go-pong/client"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// a bot standing in for a player who left mid-match
+type backfill struct {
+	Team  string
+	Bot   *client.Client
+	Until time.Time // the player can take the paddle back until then
+}
+
+// ---------------------------------------------------
+// Bot functions
+
+// a player without a connection, it is listed in wsh.Connections like any
+// other client so broadcasts and player lists include it
+func newBotClient(difficulty bot.Difficulty) *client.Client {
+	id := uuid.New().String()
+
+	botClient := &client.Client{
+		SendQueue: make(chan []byte, 100),
+		ID:        "bot_" + id,
+		PlayerId:  "bot-" + id,
+		Name:      strings.ToUpper(difficulty.Name[:1]) + difficulty.Name[1:] + "Bot-" + id[:4],
+		Bot:       true,
+	}
+
+	// nobody reads what the room sends a bot, it looks at the game instead
+	go func() {
+		for range botClient.SendQueue {
+		}
+	}()
+
+	return botClient
+}
+
+// puts a bot in the host's room while it is still in the lobby, returns why
+// it could not
+func (wsh *WebSocketHandler) addBot(host *client.Client, level string) (bool, string) {
+	difficulty, valid := bot.ByName(level)
+	if !valid {
+		return false, "Unknown bot difficulty " + level
+	}
+
+	roomObj, exists := wsh.RoomManager.GetRoom(host.RoomId)
+	if !exists {
+		return false, "You are not in a room"
+	}
+
+	if roomObj.Host != host.Conn {
+		return false, "Only the host can add bots"
+	}
+
+	wsh.Mu.Lock()
+	_, waiting := wsh.WaitingRooms[host.RoomId]
+	wsh.Mu.Unlock()
+
+	if !waiting {
+		return false, "Bots can only be added in the lobby"
+	}
+
+	botClient := newBotClient(difficulty)
+
+	wsh.Mu.Lock()
+	wsh.Connections[botClient.ID] = botClient
+	wsh.Mu.Unlock()
+
+	if joined, reason := wsh.joinRoom(host.RoomId, botClient); !joined {
+		wsh.Mu.Lock()
+		delete(wsh.Connections, botClient.ID)
+		close(botClient.SendQueue)
+		wsh.Mu.Unlock()
+
+		return false, reason
+	}
+
+	log.Printf("Added a %s bot %s to room %s", difficulty.Name, botClient.ID, host.RoomId)
+
+	go wsh.runBot(botClient, bot.New(difficulty, BallTickInterval, rand.Uint64()), false)
+
+	return true, ""
+}
+
+// joins the bots of the room to its game once a player has set it up, so the
+// players get to pick their sides first. once the ball runs they have all
+// joined, and a bot that handed a paddle back stays out until it is removed.
+// expects wsh.Mu to be held
+func (wsh *WebSocketHandler) joinBots(g *game) {
+	if g.BallRunning {
+		return
+	}
+
+	for _, c := range wsh.Connections {
+		if c.Bot && c.RoomId == g.RoomId {
+			wsh.joinGame(c)
+		}
+	}
+}
+
+// plays the bot's paddle every tick until its game is over, its room is
+// gone or every player has left, the moves go through the same handling as a player's.
+// backfills start out in the game, they have played before their first tick
+func (wsh *WebSocketHandler) runBot(botClient *client.Client, b *bot.Bot, played bool) {
+	ticker := wsh.Clock.NewTicker(BallTickInterval)
+	defer ticker.Stop()
+
+	for range ticker.C() {
+		wsh.Mu.Lock()
+
+		if wsh.Connections[botClient.ID] != botClient {
+			wsh.Mu.Unlock()
+			return
+		}
+
+		// games outside of rooms have no room to check
+		_, roomExists := wsh.RoomManager.GetRoom(botClient.RoomId)
+		roomExists = roomExists || botClient.RoomId == ""
+		g, playing := wsh.gameOf(botClient)
+		played = played || playing
+
+		if !roomExists || !wsh.roomHasPlayers(botClient.RoomId) || (played && (!playing || g.Finished)) {
+			roomId := botClient.RoomId
+			wsh.removeBot(botClient)
+			wsh.Mu.Unlock()
+
+			if roomExists {
+				wsh.broadcastRoomPlayers(roomId)
+			}
+			return
+		}
+
+		if !playing || !g.BallRunning {
+			wsh.Mu.Unlock()
+			continue
+		}
+
+		team := botClient.Team
+		arena := g.Sim.Arena
+		state := g.Sim.State
+
+		wsh.Mu.Unlock()
+
+		if direction := b.Decide(team, arena, state); direction != "" {
+			wsh.handleMovement(botClient, direction)
+		}
+	}
+}
+
+// whether anyone other than bots and spectators is still connected to the
+// room, expects wsh.Mu to be held
+func (wsh *WebSocketHandler) roomHasPlayers(roomId string) bool {
+	for _, c := range wsh.Connections {
+		if c.RoomId == roomId && !c.Bot && !c.Spectator {
+			return true
+		}
+	}
+
+	return false
+}
+
+// only runBot removes its bot, so nothing sends to the queue after it is
+// closed. expects wsh.Mu to be held
+func (wsh *WebSocketHandler) removeBot(botClient *client.Client) {
+	wsh.leaveGame(botClient)
+	wsh.RoomManager.RemoveClient(botClient.RoomId, botClient.ID)
+
+	delete(wsh.Connections, botClient.ID)
+	close(botClient.SendQueue)
+
+	log.Printf("Bot %s left room %s", botClient.ID, botClient.RoomId)
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Backfill functions
+
+// puts a bot on the side of a player who just left the game if nobody else
+// is left on it, the match goes on with the same score. expects wsh.Mu to
+// be held
+func (wsh *WebSocketHandler) backfillPlayer(g *game, leaving *client.Client) {
+	settings := wsh.Config.Bots
+	if !settings.Backfill || leaving.Bot || !g.BallRunning || g.Finished {
+		return
+	}
+
+	// nobody to play against, the game stops on its own
+	if g.teamPaddle(leaving.Team).players > 0 || g.humans() == 0 {
+		return
+	}
+
+	difficulty, valid := bot.ByName(settings.BackfillDifficulty)
+	if !valid {
+		log.Printf("Unknown backfill bot difficulty %q, using %s", settings.BackfillDifficulty, bot.Medium.Name)
+		difficulty = bot.Medium
+	}
+
+	botClient := newBotClient(difficulty)
+	botClient.RoomId = g.RoomId
+	botClient.Team = leaving.Team
+
+	wsh.Connections[botClient.ID] = botClient
+	g.Clients[botClient.ID] = botClient
+	g.teamPaddle(leaving.Team).players++
+
+	g.Backfills[leaving.PlayerId] = &backfill{
+		Team:  leaving.Team,
+		Bot:   botClient,
+		Until: wsh.Clock.Now().Add(settings.ReconnectGrace.Duration),
+	}
+
+	log.Printf("Bot %s took over the %s side of room %q from %s", botClient.ID, leaving.Team, g.RoomId, leaving.PlayerId)
+
+	go wsh.runBot(botClient, bot.New(difficulty, BallTickInterval, rand.Uint64()), true)
+}
+
+// gives a player who left mid-match their paddle back from the bot that took
+// over, if they rejoin the room within the grace period. after that the bot
+// plays the match out
+func (wsh *WebSocketHandler) reclaimPaddle(roomId string, client *client.Client) bool {
+	wsh.Mu.Lock()
+	defer wsh.Mu.Unlock()
+
+	g, exists := wsh.Games[roomId]
+	if !exists || g.Finished {
+		return false
+	}
+
+	taken, exists := g.Backfills[client.PlayerId]
+	if !exists {
+		return false
+	}
+
+	delete(g.Backfills, client.PlayerId)
+
+	if wsh.Clock.Now().After(taken.Until) {
+		return false
+	}
+
+	// runBot notices the bot is out of the game and removes it
+	wsh.leaveGame(taken.Bot)
+
+	client.RoomId = roomId
+	client.Spectator = false
+	client.Team = taken.Team
+
+	g.Clients[client.ID] = client
+	g.teamPaddle(taken.Team).players++
+
+	log.Printf("Player %s took the %s side of room %q back", client.PlayerId, taken.Team, roomId)
+
+	return true
+}
+
+// ---------------------------------------------------
@@ -0,0 +1,383 @@
+package wsserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mo-shahab/go-pong/clock"
+	pb "github.com/mo-shahab/go-pong/proto"
+	"google.golang.org/protobuf/proto"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// room event feed constants
+const (
+	subscriberBuffer  = 64
+	snapshotInterval  = time.Second
+	heartbeatInterval = 15 * time.Second
+)
+
+// room phases reported on the event feed
+const (
+	phaseWaiting  = "waiting"
+	phasePlaying  = "playing"
+	phaseFinished = "finished"
+	phaseClosed   = "closed"
+)
+
+type eventPlayer struct {
+	PlayerId string `json:"player_id"`
+	Name     string `json:"name"`
+	Team     string `json:"team"`
+}
+
+type roomEvent struct {
+	RoomId     string        `json:"room_id"`
+	Phase      string        `json:"phase"`
+	Players    []eventPlayer `json:"players"`
+	Spectators int           `json:"spectators"`
+	LeftScore  *int32        `json:"left_score,omitempty"`
+	RightScore *int32        `json:"right_score,omitempty"`
+
+	// for the snapshots, not part of the room event
+	leftPaddle  float64
+	rightPaddle float64
+}
+
+type phaseEvent struct {
+	Phase    string `json:"phase"`
+	TimeLeft int32  `json:"time_left,omitempty"`
+	Players  int32  `json:"players,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type goalEvent struct {
+	Team       string        `json:"team"`
+	Scorers    []eventPlayer `json:"scorers"`
+	LeftScore  int32         `json:"left_score"`
+	RightScore int32         `json:"right_score"`
+}
+
+type matchEndEvent struct {
+	Winner     string `json:"winner"`
+	LeftScore  int32  `json:"left_score"`
+	RightScore int32  `json:"right_score"`
+	MatchId    string `json:"match_id,omitempty"`
+}
+
+type snapshotEvent struct {
+	BallX       float64 `json:"ball_x"`
+	BallY       float64 `json:"ball_y"`
+	LeftPaddle  float64 `json:"left_paddle"`
+	RightPaddle float64 `json:"right_paddle"`
+	LeftScore   int32   `json:"left_score"`
+	RightScore  int32   `json:"right_score"`
+}
+
+func newEventPlayer(player *pb.PlayerInfo) eventPlayer {
+	return eventPlayer{
+		PlayerId: player.PlayerId,
+		Name:     player.Name,
+		Team:     player.Team,
+	}
+}
+
+// ---------------------------------------------------
+// Room event source functions
+
+// registers a listener for everything broadcast to the room, the returned
+// function removes it again. listeners see the room like spectators do,
+// including the spectator delay
+func (wsh *WebSocketHandler) subscribe(roomId string) (<-chan []byte, func()) {
+	events := make(chan []byte, subscriberBuffer)
+
+	wsh.Mu.Lock()
+	if wsh.Subscribers[roomId] == nil {
+		wsh.Subscribers[roomId] = make(map[chan []byte]bool)
+	}
+	wsh.Subscribers[roomId][events] = true
+	wsh.Mu.Unlock()
+
+	unsubscribe := func() {
+		wsh.Mu.Lock()
+		delete(wsh.Subscribers[roomId], events)
+		if len(wsh.Subscribers[roomId]) == 0 {
+			delete(wsh.Subscribers, roomId)
+		}
+		wsh.Mu.Unlock()
+	}
+
+	return events, unsubscribe
+}
+
+// expects wsh.Mu to be held
+func (wsh *WebSocketHandler) sendToSubscribers(roomId string, message []byte) {
+	for events := range wsh.Subscribers[roomId] {
+		select {
+		case events <- message:
+		default:
+			log.Printf("Dropping message, event subscriber of room %s is behind", roomId)
+		}
+	}
+}
+
+// current state of the room for a new event listener, expects wsh.Mu to be
+// held
+func (wsh *WebSocketHandler) roomState(roomId string) roomEvent {
+	state := roomEvent{
+		RoomId:     roomId,
+		Phase:      phaseWaiting,
+		Players:    []eventPlayer{},
+		Spectators: wsh.spectatorCount(roomId),
+	}
+
+	for _, client := range wsh.Connections {
+		if client.RoomId == roomId && !client.Spectator {
+			state.Players = append(state.Players, newEventPlayer(newPlayerInfo(client)))
+		}
+	}
+
+	if _, waiting := wsh.WaitingRooms[roomId]; !waiting {
+		state.Phase = phasePlaying
+	}
+
+	// live scores are held back like everything else when spectators are
+	// delayed
+	if g, exists := wsh.Games[roomId]; exists && wsh.spectatorDelay() == 0 {
+		// copies, the ball loop keeps writing the game's once the lock is
+		// released
+		leftScore, rightScore := g.Sim.Scores.LeftScores, g.Sim.Scores.RightScores
+		state.LeftScore = &leftScore
+		state.RightScore = &rightScore
+		state.leftPaddle = g.Sim.LeftPaddle
+		state.rightPaddle = g.Sim.RightPaddle
+	}
+
+	return state
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Server-Sent Events functions
+
+// read only feed of a room as server-sent events with JSON payloads, for
+// dashboards that do not speak the websocket protocol
+func (wsh *WebSocketHandler) ServeRoomEvents(w http.ResponseWriter, r *http.Request) {
+	roomId := r.PathValue("id")
+
+	if _, exists := wsh.RoomManager.GetRoom(roomId); !exists {
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := wsh.subscribe(roomId)
+	defer unsubscribe()
+
+	wsh.Mu.Lock()
+	state := wsh.roomState(roomId)
+	wsh.Mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	feed := &roomFeed{
+		w:           w,
+		phase:       state.Phase,
+		players:     make(map[string]eventPlayer),
+		leftPaddle:  state.leftPaddle,
+		rightPaddle: state.rightPaddle,
+		clock:       wsh.Clock,
+	}
+
+	for _, player := range state.Players {
+		feed.players[player.PlayerId] = player
+	}
+
+	if state.LeftScore != nil {
+		feed.leftScore = *state.LeftScore
+		feed.rightScore = *state.RightScore
+	}
+
+	feed.write("room", state)
+	flusher.Flush()
+
+	heartbeat := wsh.Clock.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-heartbeat.C():
+			fmt.Fprint(w, ": ping\n\n")
+
+		case encoded := <-events:
+			message := &pb.Message{}
+			if err := proto.Unmarshal(encoded, message); err != nil {
+				log.Println("Failed to decode a room event: ", err)
+				continue
+			}
+
+			if !feed.handle(message) {
+				flusher.Flush()
+				return
+			}
+		}
+
+		if feed.err != nil {
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+// state of a single event stream, used to turn room broadcasts into events
+type roomFeed struct {
+	w            http.ResponseWriter
+	phase        string
+	players      map[string]eventPlayer
+	leftScore    int32
+	rightScore   int32
+	leftPaddle   float64
+	rightPaddle  float64
+	lastSnapshot time.Time
+	clock        clock.Clock
+	err          error
+}
+
+func (f *roomFeed) write(event string, data any) {
+	if f.err != nil {
+		return
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		log.Println("Failed to encode a room event: ", err)
+		return
+	}
+
+	_, f.err = fmt.Fprintf(f.w, "event: %s\ndata: %s\n\n", event, encoded)
+}
+
+func (f *roomFeed) setPhase(event phaseEvent) {
+	if event.Phase == f.phase {
+		return
+	}
+
+	f.phase = event.Phase
+	f.write("phase", event)
+}
+
+// writes the events for a room broadcast, returns false once the room is
+// gone and the stream should end
+func (f *roomFeed) handle(message *pb.Message) bool {
+	switch message.Type {
+	case pb.MsgType_waiting_room_state:
+		state := message.GetWaitingRoomState()
+		f.setPhase(phaseEvent{
+			Phase:    phaseWaiting,
+			TimeLeft: state.TimeLeft,
+			Players:  state.CurrentPlayers,
+		})
+
+	case pb.MsgType_game_start:
+		f.setPhase(phaseEvent{Phase: phasePlaying})
+
+	case pb.MsgType_room_players:
+		f.updatePlayers(message.GetRoomPlayers().Players)
+
+	case pb.MsgType_score:
+		score := message.GetScore()
+		f.leftScore = score.LeftScore
+		f.rightScore = score.RightScore
+
+		scorers := make([]eventPlayer, 0, len(score.Scorers))
+		for _, scorer := range score.Scorers {
+			scorers = append(scorers, newEventPlayer(scorer))
+		}
+
+		f.write("goal", goalEvent{
+			Team:       strings.ToLower(score.Scored),
+			Scorers:    scorers,
+			LeftScore:  score.LeftScore,
+			RightScore: score.RightScore,
+		})
+
+	case pb.MsgType_paddle_positions:
+		paddles := message.GetPaddlePositions()
+		f.leftPaddle = paddles.LeftPaddleData
+		f.rightPaddle = paddles.RightPaddleData
+
+	case pb.MsgType_ball_position:
+		if f.clock.Since(f.lastSnapshot) < snapshotInterval {
+			return true
+		}
+		f.lastSnapshot = f.clock.Now()
+
+		ball := message.GetBallPosition().GetBall()
+		f.write("snapshot", snapshotEvent{
+			BallX:       ball.GetX(),
+			BallY:       ball.GetY(),
+			LeftPaddle:  f.leftPaddle,
+			RightPaddle: f.rightPaddle,
+			LeftScore:   f.leftScore,
+			RightScore:  f.rightScore,
+		})
+
+	case pb.MsgType_match_end:
+		matchEnd := message.GetMatchEnd()
+		f.write("match_end", matchEndEvent{
+			Winner:     matchEnd.Winner,
+			LeftScore:  matchEnd.LeftScore,
+			RightScore: matchEnd.RightScore,
+			MatchId:    matchEnd.GetResult().GetMatchId(),
+		})
+		f.setPhase(phaseEvent{Phase: phaseFinished})
+
+	case pb.MsgType_room_closed:
+		f.setPhase(phaseEvent{
+			Phase:  phaseClosed,
+			Reason: message.GetRoomClosed().Reason,
+		})
+		return false
+	}
+
+	return true
+}
+
+// turns the full player list into joined and left events
+func (f *roomFeed) updatePlayers(players []*pb.PlayerInfo) {
+	current := make(map[string]eventPlayer, len(players))
+	for _, player := range players {
+		current[player.PlayerId] = newEventPlayer(player)
+	}
+
+	for id, player := range current {
+		if _, known := f.players[id]; !known {
+			f.write("player_joined", player)
+		}
+	}
+
+	for id, player := range f.players {
+		if _, still := current[id]; !still {
+			f.write("player_left", player)
+		}
+	}
+
+	f.players = current
+}
+
+// ---------------------------------------------------
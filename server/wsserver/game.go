@@ -0,0 +1,333 @@
+package wsserver
+
+import (
+	"fmt"
+	"github.com/mo-shahab/go-pong/canvas"
+	"github.com/mo-shahab/go-pong/client"
+	"github.com/mo-shahab/go-pong/paddle"
+	pb "github.com/mo-shahab/go-pong/proto"
+	"github.com/mo-shahab/go-pong/rating"
+	"github.com/mo-shahab/go-pong/replay"
+	"github.com/mo-shahab/go-pong/simulation"
+	"google.golang.org/protobuf/proto"
+	"log"
+	"time"
+)
+
+// match constants
+const (
+	WinningScore = 5
+	GoalPause    = 3 * time.Second
+)
+
+// bounds of the arena a player can ask for, everything about the match is
+// sized by it, from the simulation to the thumbnails and highlight GIFs
+const (
+	minArenaSide       = 100
+	maxArenaSide       = 4096
+	maxPaddleWidthPart = 4 // of the arena width
+)
+
+// team reported to spectators, they never hold a paddle
+const spectatorTeam = "spectator"
+
+// state of the match played in a room, clients that are not in a room share
+// the game with the empty room id
+type game struct {
+	RoomId          string
+	Clients         map[string]*client.Client
+	LeftPaddleData  paddleData
+	RightPaddleData paddleData
+	Sim             *simulation.Simulation
+	Stats           matchStats
+	GoalReplay      goalReplayBuffer
+	PastStates      []timedState
+	Backfills       map[string]*backfill // by the player id of who left
+	ReplayId        string
+	Recorder        *replay.Recorder
+	BallRunning     bool
+	Initialized     bool
+	Finished        bool
+	StartedAt       time.Time
+}
+
+func newGame(roomId string) *game {
+	return &game{
+		RoomId:    roomId,
+		Clients:   make(map[string]*client.Client),
+		Stats:     newMatchStats(),
+		Backfills: make(map[string]*backfill),
+	}
+}
+
+// the arena asked for by the first player to get ready, the checks are
+// written so NaN fails them too
+func newArena(init *pb.InitMessage) (simulation.Arena, error) {
+	if !(init.Width >= minArenaSide && init.Width <= maxArenaSide) || !(init.Height >= minArenaSide && init.Height <= maxArenaSide) {
+		return simulation.Arena{}, fmt.Errorf("Arena must be between %dx%d and %dx%d", minArenaSide, minArenaSide, maxArenaSide, maxArenaSide)
+	}
+
+	if !(init.PaddleWidth >= 1 && init.PaddleWidth <= init.Width/maxPaddleWidthPart) {
+		return simulation.Arena{}, fmt.Errorf("Paddle width must be between 1 and %g", init.Width/maxPaddleWidthPart)
+	}
+
+	// the ball has to fit past a paddle
+	if !(init.PaddleHeight >= 2*ballRadius && init.PaddleHeight <= init.Height-4*ballRadius) {
+		return simulation.Arena{}, fmt.Errorf("Paddle height must be between %d and %g", 2*ballRadius, init.Height-4*ballRadius)
+	}
+
+	return simulation.Arena{
+		Canvas:     canvas.Canvas{Width: init.Width, Height: init.Height},
+		Paddle:     paddle.Paddle{Width: init.PaddleWidth, Height: init.PaddleHeight},
+		BallRadius: ballRadius,
+	}, nil
+}
+
+func (g *game) players() int {
+	return g.LeftPaddleData.players + g.RightPaddleData.players
+}
+
+func (g *game) teamPaddle(team string) *paddleData {
+	if team == "left" {
+		return &g.LeftPaddleData
+	}
+
+	return &g.RightPaddleData
+}
+
+// players that are not bots, a game only bots are left in is over
+func (g *game) humans() int {
+	count := 0
+	for _, client := range g.Clients {
+		if !client.Bot {
+			count++
+		}
+	}
+
+	return count
+}
+
+// ---------------------------------------------------
+// Game membership functions, all of them expect wsh.Mu to be held
+
+// returns the game of the client's room, creating it if needed, and puts the
+// client on the team with fewer players
+func (wsh *WebSocketHandler) joinGame(client *client.Client) *game {
+	g, exists := wsh.Games[client.RoomId]
+	if !exists {
+		g = newGame(client.RoomId)
+		wsh.Games[client.RoomId] = g
+		log.Printf("Created game for room %q", client.RoomId)
+	}
+
+	if _, playing := g.Clients[client.ID]; playing {
+		return g
+	}
+
+	if g.LeftPaddleData.players <= g.RightPaddleData.players {
+		client.Team = "left"
+		g.LeftPaddleData.players++
+	} else {
+		client.Team = "right"
+		g.RightPaddleData.players++
+	}
+
+	g.Clients[client.ID] = client
+	log.Printf("Client %s plays on the %s team in room %q", client.ID, client.Team, client.RoomId)
+
+	return g
+}
+
+func (wsh *WebSocketHandler) leaveGame(client *client.Client) {
+	g, exists := wsh.Games[client.RoomId]
+	if !exists {
+		return
+	}
+
+	if _, playing := g.Clients[client.ID]; !playing {
+		return
+	}
+
+	delete(g.Clients, client.ID)
+
+	if client.Team == "left" {
+		g.LeftPaddleData.players--
+	} else {
+		g.RightPaddleData.players--
+	}
+
+	if len(g.Clients) == 0 && !g.BallRunning {
+		delete(wsh.Games, g.RoomId)
+	}
+}
+
+// state of the room's game as seen by a spectator, the game may not have been
+// set up by the players yet
+func (wsh *WebSocketHandler) spectatorGameState(client *client.Client) *pb.InitialGameStateMessage {
+	state := &pb.InitialGameStateMessage{
+		YourTeam: spectatorTeam,
+	}
+
+	g, exists := wsh.Games[client.RoomId]
+	if !exists {
+		return state
+	}
+
+	state.Arena = replay.NewArena(g.Sim.Arena)
+
+	// with a delay the live positions would give away what spectators are
+	// not supposed to see yet
+	if wsh.spectatorDelay() == 0 {
+		state.LeftPaddleData = g.Sim.LeftPaddle
+		state.RightPaddleData = g.Sim.RightPaddle
+		state.Clients = int32(g.players())
+	}
+
+	return state
+}
+
+// returns the game the client is playing in, if any
+func (wsh *WebSocketHandler) gameOf(client *client.Client) (*game, bool) {
+	g, exists := wsh.Games[client.RoomId]
+	if !exists {
+		return nil, false
+	}
+
+	if _, playing := g.Clients[client.ID]; !playing {
+		return nil, false
+	}
+
+	return g, true
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Match end functions
+
+// ends the match once a team reached the winning score and updates the
+// ratings of everyone who played in it
+func (wsh *WebSocketHandler) finishMatch(g *game, winner string) {
+	wsh.Mu.Lock()
+
+	g.Finished = true
+	if wsh.Games[g.RoomId] == g {
+		delete(wsh.Games, g.RoomId)
+	}
+
+	winners := []string{}
+	losers := []string{}
+	names := make(map[string]string)
+
+	for _, client := range g.Clients {
+		names[client.PlayerId] = client.Name
+
+		// matches against bots do not count towards the ratings
+		if client.Bot {
+			continue
+		}
+
+		if client.Team == winner {
+			winners = append(winners, client.PlayerId)
+		} else {
+			losers = append(losers, client.PlayerId)
+		}
+	}
+
+	finalScores := g.Sim.Scores
+	endedAt := wsh.Clock.Now()
+	result := g.matchResult(winner, endedAt)
+
+	wsh.Mu.Unlock()
+
+	log.Printf("Match in room %q finished, %s team won %d-%d",
+		g.RoomId, winner, finalScores.LeftScores, finalScores.RightScores)
+
+	if err := wsh.Store.AddMatch(result); err != nil {
+		log.Println("Failed to record the match: ", err)
+	}
+
+	changes, err := wsh.Ratings.RecordMatch(winners, losers, endedAt)
+	if err != nil {
+		log.Println("Failed to update the ratings: ", err)
+	}
+
+	ratingMessages := make([]*pb.RatingMessage, 0, len(changes))
+	for _, change := range changes {
+		ratingMessage := newRatingMessage(change.After)
+		ratingMessage.Name = names[change.After.PlayerId]
+		ratingMessage.Change = change.After.Rating - change.Before.Rating
+		ratingMessages = append(ratingMessages, ratingMessage)
+	}
+
+	matchEndMessage := &pb.MatchEndMessage{
+		RoomId:     g.RoomId,
+		Winner:     winner,
+		LeftScore:  finalScores.LeftScores,
+		RightScore: finalScores.RightScores,
+		Ratings:    ratingMessages,
+		Result:     newMatchResultMessage(result),
+	}
+
+	wrappedMessage := &pb.Message{
+		Type: pb.MsgType_match_end,
+		MessageType: &pb.Message_MatchEnd{
+			MatchEnd: matchEndMessage,
+		},
+	}
+
+	wsh.Mu.Lock()
+	g.recordEvent(wrappedMessage)
+	wsh.Mu.Unlock()
+
+	wsh.stopRecording(g)
+
+	encoded, err := proto.Marshal(wrappedMessage)
+	if err != nil {
+		log.Println("Failed to marshal match end message: ", err)
+		return
+	}
+
+	wsh.broadcastToRoom(g.RoomId, encoded)
+}
+
+func newRatingMessage(r rating.Rating) *pb.RatingMessage {
+	return &pb.RatingMessage{
+		PlayerId:   r.PlayerId,
+		Rating:     r.Rating,
+		Deviation:  r.Deviation,
+		Volatility: r.Volatility,
+		Matches:    int32(r.Matches),
+	}
+}
+
+func (wsh *WebSocketHandler) sendRating(client *client.Client, playerId string) {
+	r, err := wsh.Ratings.Get(playerId)
+	if err != nil {
+		log.Println("Failed to load the rating: ", err)
+		wsh.sendError(client, "Failed to load the rating")
+		return
+	}
+
+	ratingMessage := newRatingMessage(r)
+	if player, found, err := wsh.Store.GetPlayer(playerId); err == nil && found {
+		ratingMessage.Name = player.Name
+	}
+
+	wrappedMessage := &pb.Message{
+		Type: pb.MsgType_rating,
+		MessageType: &pb.Message_Rating{
+			Rating: ratingMessage,
+		},
+	}
+
+	encoded, err := proto.Marshal(wrappedMessage)
+	if err != nil {
+		log.Println("Failed to marshal rating message: ", err)
+		return
+	}
+
+	wsh.sendToClient(client, encoded)
+}
+
+// ---------------------------------------------------
@@ -0,0 +1,80 @@
+package wsserver
+
+import (
+	pb "github.com/mo-shahab/go-pong/proto"
+	"github.com/mo-shahab/go-pong/simulation"
+	"time"
+)
+
+// how much play goes into a goal replay, the same as the pause after a goal
+// so it has finished by the time the ball is served again
+const goalReplayLength = GoalPause
+
+const goalReplayFrames = int(goalReplayLength / BallTickInterval)
+
+// ring buffer of the last few seconds of ball and paddle positions
+type goalReplayBuffer struct {
+	Frames [goalReplayFrames]*pb.GoalReplayFrame
+	next   int
+	count  int
+}
+
+// ---------------------------------------------------
+// Goal replay functions
+
+func (b *goalReplayBuffer) add(state simulation.State) {
+	b.Frames[b.next] = &pb.GoalReplayFrame{
+		Tick: state.Tick,
+		Ball: &pb.Ball{
+			X:      state.Ball.X,
+			Y:      state.Ball.Y,
+			Radius: state.Ball.Radius,
+		},
+		LeftPaddleData:  state.LeftPaddle,
+		RightPaddleData: state.RightPaddle,
+	}
+
+	b.next = (b.next + 1) % goalReplayFrames
+	if b.count < goalReplayFrames {
+		b.count++
+	}
+}
+
+// forgets everything, the frames before a jump in time do not lead up to
+// what comes after it
+func (b *goalReplayBuffer) reset() {
+	b.next = 0
+	b.count = 0
+}
+
+// the buffered frames, oldest first
+func (b *goalReplayBuffer) frames() []*pb.GoalReplayFrame {
+	frames := make([]*pb.GoalReplayFrame, 0, b.count)
+	start := (b.next - b.count + goalReplayFrames) % goalReplayFrames
+
+	for i := 0; i < b.count; i++ {
+		frames = append(frames, b.Frames[(start+i)%goalReplayFrames])
+	}
+
+	return frames
+}
+
+// the goal replay message for the team that just scored, the buffer is
+// emptied so the next replay only has the play after this goal
+func (b *goalReplayBuffer) message(scored string) *pb.Message {
+	frames := b.frames()
+	b.reset()
+
+	return &pb.Message{
+		Type: pb.MsgType_goal_replay,
+		MessageType: &pb.Message_GoalReplay{
+			GoalReplay: &pb.GoalReplayMessage{
+				Scored:         scored,
+				TickIntervalMs: int32(BallTickInterval / time.Millisecond),
+				Frames:         frames,
+			},
+		},
+	}
+}
+
+// ---------------------------------------------------
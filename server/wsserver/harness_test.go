@@ -0,0 +1,379 @@
+package wsserver
+
+import (
+	"context"
+	"github.com/gorilla/websocket"
+	"github.com/mo-shahab/go-pong/auth"
+	"github.com/mo-shahab/go-pong/client"
+	"github.com/mo-shahab/go-pong/clock"
+	"github.com/mo-shahab/go-pong/config"
+	"github.com/mo-shahab/go-pong/gopongclient"
+	pb "github.com/mo-shahab/go-pong/proto"
+	"github.com/mo-shahab/go-pong/store"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// harness constants
+const (
+	waitTimeout  = 5 * time.Second // real time a test waits for the server to answer
+	clientBuffer = 4096
+)
+
+// where the fake clock starts
+var harnessStart = time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+// a handler served over an in-memory transport, on a clock the test moves
+type harness struct {
+	t        *testing.T
+	Handler  *WebSocketHandler
+	Clock    *clock.Fake
+	Server   *httptest.Server
+	listener *memoryListener
+}
+
+// a player connected through the go client, every message it gets is kept
+// in order for the test to look through
+type testClient struct {
+	*gopongclient.Client
+	t        *testing.T
+	Messages <-chan *pb.Message
+}
+
+// a net.Listener whose connections are in-memory pipes
+type memoryListener struct {
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+type memoryAddr struct{}
+
+// ---------------------------------------------------
+// Harness functions
+
+// the server logs every message, which buries the test output
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// a handler with the default config, changed by the options first
+func newHarness(t *testing.T, options ...func(*config.Config)) *harness {
+	t.Helper()
+
+	cfg := config.Default()
+	for _, option := range options {
+		option(cfg)
+	}
+
+	st := store.NewMemoryStore()
+
+	authService, err := auth.NewService(cfg.Auth, cfg.Names, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &harness{
+		t:        t,
+		Handler:  NewWebSocketHandler(cfg, st, authService),
+		Clock:    clock.NewFake(harnessStart),
+		listener: newMemoryListener(),
+	}
+	h.Handler.SetClock(h.Clock)
+
+	mux := http.NewServeMux()
+	mux.Handle("/ws", h.Handler)
+
+	h.Server = httptest.NewUnstartedServer(mux)
+	h.Server.Listener.Close()
+	h.Server.Listener = h.listener
+	h.Server.Start()
+	t.Cleanup(h.Server.Close)
+
+	return h
+}
+
+// connects a guest and waits for its identity, the options can change the
+// client's before it connects
+func (h *harness) connect(options ...func(*gopongclient.Options)) *testClient {
+	h.t.Helper()
+
+	clientOptions := gopongclient.Options{
+		URL:         "ws://memory/ws",
+		EventBuffer: clientBuffer,
+		Dialer: &websocket.Dialer{
+			NetDialContext:   h.listener.DialContext,
+			HandshakeTimeout: waitTimeout,
+		},
+	}
+	for _, option := range options {
+		option(&clientOptions)
+	}
+
+	c := gopongclient.New(clientOptions)
+
+	messages := c.Subscribe()
+
+	if err := c.Connect(h.context()); err != nil {
+		h.t.Fatalf("Failed to connect: %v", err)
+	}
+	h.t.Cleanup(func() { c.Close() })
+
+	return &testClient{Client: c, t: h.t, Messages: messages}
+}
+
+// stores the replay file and connects a client watching it
+func (h *harness) watch(path string) *testClient {
+	h.t.Helper()
+
+	recorded, err := os.ReadFile(path)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	replayId := strings.TrimSuffix(filepath.Base(path), ".replay")
+
+	w, err := h.Handler.Store.CreateReplay(replayId)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	w.Write(recorded)
+	w.Close()
+
+	return h.connect(func(options *gopongclient.Options) { options.Replay = replayId })
+}
+
+// a room made by the first client and joined by the rest
+func (h *harness) room(maxPlayers int, players ...*testClient) string {
+	h.t.Helper()
+
+	roomId, err := players[0].CreateRoom(h.context(), maxPlayers)
+	if err != nil {
+		h.t.Fatalf("Failed to create a room: %v", err)
+	}
+
+	for _, player := range players[1:] {
+		if _, err := player.JoinRoom(h.context(), roomId, false); err != nil {
+			h.t.Fatalf("Failed to join room %s: %v", roomId, err)
+		}
+	}
+
+	return roomId
+}
+
+// fills a room with the players and gets their game going, the ball is
+// served on the next tick
+func (h *harness) play(players ...*testClient) string {
+	h.t.Helper()
+
+	roomId := h.room(len(players), players...)
+
+	// a full room starts on the waiting room's next second
+	h.Clock.Advance(time.Second)
+	for _, player := range players {
+		player.expect(pb.MsgType_game_start)
+	}
+	h.blockUntil(0)
+
+	for _, player := range players {
+		if _, err := player.Ready(h.context(), gopongclient.DefaultArena); err != nil {
+			h.t.Fatalf("Failed to get ready: %v", err)
+		}
+	}
+	h.blockUntil(1)
+
+	return roomId
+}
+
+// moves the clock one tick and returns what the observer got from it, a
+// goal pause is waited out after the score
+func (h *harness) tick(observer *testClient) *pb.Message {
+	h.t.Helper()
+
+	h.Clock.Advance(BallTickInterval)
+	message := observer.expect(pb.MsgType_ball_position, pb.MsgType_score, pb.MsgType_match_end)
+
+	if score := message.GetScore(); score != nil && max(score.LeftScore, score.RightScore) < WinningScore {
+		// the ball ticker and the goal pause
+		h.blockUntil(2)
+		h.Clock.Advance(GoalPause)
+	}
+
+	return message
+}
+
+// waits until n timers of the rooms and games are waiting on the clock,
+// the matchmaking queue's ticker always is on top of them
+func (h *harness) blockUntil(n int) {
+	h.Clock.BlockUntil(n + 1)
+}
+
+// a context for one request, in real time
+func (h *harness) context() context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	h.t.Cleanup(cancel)
+
+	return ctx
+}
+
+// runs f with wsh.Mu held, for looking at the handler's state
+func (h *harness) inspect(f func(wsh *WebSocketHandler)) {
+	h.Handler.Mu.Lock()
+	defer h.Handler.Mu.Unlock()
+
+	f(h.Handler)
+}
+
+// the server's side of a test client's connection
+func (h *harness) serverClient(c *testClient) *client.Client {
+	h.t.Helper()
+
+	h.Handler.Mu.Lock()
+	defer h.Handler.Mu.Unlock()
+
+	for _, connected := range h.Handler.Connections {
+		if connected.PlayerId == c.PlayerId {
+			return connected
+		}
+	}
+
+	h.t.Fatalf("Player %s is not connected", c.PlayerId)
+	return nil
+}
+
+// waits in real time for the handler to get somewhere on its own, like
+// noticing a closed connection
+func (h *harness) eventually(what string, check func(wsh *WebSocketHandler) bool) {
+	h.t.Helper()
+
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		done := false
+		h.inspect(func(wsh *WebSocketHandler) {
+			done = check(wsh)
+		})
+		if done {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			h.t.Fatalf("Gave up waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Test client functions
+
+// waits for the next message of one of the types, skipping the others
+func (c *testClient) expect(types ...pb.MsgType) *pb.Message {
+	c.t.Helper()
+
+	timeout := time.After(waitTimeout)
+	for {
+		select {
+		case message, ok := <-c.Messages:
+			if !ok {
+				c.t.Fatalf("The connection closed while waiting for %v", types)
+			}
+			if slices.Contains(types, message.Type) {
+				return message
+			}
+
+		case <-timeout:
+			c.t.Fatalf("No %v within %s", types, waitTimeout)
+		}
+	}
+}
+
+// waits for a player list that passes the check, earlier lists are skipped
+func (c *testClient) expectPlayers(check func(*pb.RoomPlayersMessage) bool) *pb.RoomPlayersMessage {
+	c.t.Helper()
+
+	for {
+		players := c.expect(pb.MsgType_room_players).GetRoomPlayers()
+		if check(players) {
+			return players
+		}
+	}
+}
+
+// moves the paddle and waits for the server to have handled it
+func (c *testClient) move(direction string, times int) {
+	c.t.Helper()
+
+	for range times {
+		if err := c.Move(direction); err != nil {
+			c.t.Fatalf("Failed to move: %v", err)
+		}
+		c.expect(pb.MsgType_game_state)
+	}
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Memory transport functions
+
+func newMemoryListener() *memoryListener {
+	return &memoryListener{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *memoryListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *memoryListener) Addr() net.Addr {
+	return memoryAddr{}
+}
+
+// hands one end of a pipe to Accept and returns the other
+func (l *memoryListener) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	server, client := net.Pipe()
+
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (memoryAddr) Network() string {
+	return "memory"
+}
+
+func (memoryAddr) String() string {
+	return "memory"
+}
+
+// ---------------------------------------------------
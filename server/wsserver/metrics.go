@@ -0,0 +1,89 @@
+package wsserver
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// counters for watching the server under load, they are atomic so the hot
+// paths update them without wsh.Mu
+type Metrics struct {
+	DroppedMessages atomic.Int64 // messages that did not fit in a client's send queue
+	Ticks           atomic.Int64
+	TickOverruns    atomic.Int64 // ticks that took longer than BallTickInterval
+	TickNanos       atomic.Int64 // time spent on all the ticks
+	MaxTickNanos    atomic.Int64
+}
+
+// what GET /debug/metrics answers with, the counters only ever go up so two
+// snapshots can be compared
+type metricsSnapshot struct {
+	Time            time.Time `json:"time"`
+	Connections     int       `json:"connections"`
+	Rooms           int       `json:"rooms"`
+	Games           int       `json:"games"`
+	DroppedMessages int64     `json:"dropped_messages"`
+	Ticks           int64     `json:"ticks"`
+	TickOverruns    int64     `json:"tick_overruns"`
+	TickSeconds     float64   `json:"tick_seconds"`
+	MaxTickMs       float64   `json:"max_tick_ms"`
+}
+
+// ---------------------------------------------------
+// Metrics functions
+
+func (m *Metrics) dropped() {
+	m.DroppedMessages.Add(1)
+}
+
+// a tick is late when it started late or its work ran past the next one
+func (m *Metrics) recordTick(late time.Duration, took time.Duration) {
+	total := late + took
+
+	m.Ticks.Add(1)
+	m.TickNanos.Add(int64(took))
+
+	if total > BallTickInterval {
+		m.TickOverruns.Add(1)
+	}
+
+	for {
+		longest := m.MaxTickNanos.Load()
+		if int64(total) <= longest || m.MaxTickNanos.CompareAndSwap(longest, int64(total)) {
+			return
+		}
+	}
+}
+
+func (wsh *WebSocketHandler) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	wsh.Mu.Lock()
+	snapshot := metricsSnapshot{
+		Time:        wsh.Clock.Now().UTC(),
+		Connections: len(wsh.Connections),
+		Games:       len(wsh.Games),
+	}
+	wsh.Mu.Unlock()
+
+	wsh.RoomManager.Mu.Lock()
+	snapshot.Rooms = len(wsh.RoomManager.Rooms)
+	wsh.RoomManager.Mu.Unlock()
+
+	m := wsh.Metrics
+	snapshot.DroppedMessages = m.DroppedMessages.Load()
+	snapshot.Ticks = m.Ticks.Load()
+	snapshot.TickOverruns = m.TickOverruns.Load()
+	snapshot.TickSeconds = time.Duration(m.TickNanos.Load()).Seconds()
+	snapshot.MaxTickMs = float64(m.MaxTickNanos.Load()) / float64(time.Millisecond)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		log.Println("Failed to write the metrics: ", err)
+	}
+}
+
+// ---------------------------------------------------
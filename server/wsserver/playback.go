@@ -0,0 +1,390 @@
+package wsserver
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/mo-shahab/go-pong/client"
+	"github.com/mo-shahab/go-pong/clock"
+	pb "github.com/mo-shahab/go-pong/proto"
+	"github.com/mo-shahab/go-pong/replay"
+	"github.com/mo-shahab/go-pong/store"
+	"google.golang.org/protobuf/proto"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// replay playback constants
+const (
+	minReplaySpeed = 0.25
+	maxReplaySpeed = 4.0
+	controlBuffer  = 16
+)
+
+// a connection watching a replay instead of a live room, it gets the same
+// messages a spectator of the match got
+type playback struct {
+	Client   *client.Client
+	ReplayId string
+	Player   *replay.Player
+	Speed    float64
+	Paused   bool
+	Ended    bool
+
+	// positions since the last goal or seek, for goal replays
+	GoalReplay goalReplayBuffer
+
+	// the read loop hands controls and errors to the playback goroutine,
+	// which is the only one sending on the client's queue
+	Controls chan *pb.ReplayControlMessage
+	Errors   chan string
+	Done     chan struct{}
+	Metrics  *Metrics
+	Clock    clock.Clock
+}
+
+// ---------------------------------------------------
+// Replay playback functions
+
+func (wsh *WebSocketHandler) serveReplay(w http.ResponseWriter, r *http.Request, replayId string) {
+	replayFile, err := wsh.Store.OpenReplay(replayId)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "replay not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		log.Println("Failed to open the replay: ", err)
+		http.Error(w, "failed to open the replay", http.StatusInternalServerError)
+		return
+	}
+
+	player, err := replay.Load(replayFile)
+	replayFile.Close()
+	if err != nil {
+		log.Printf("Failed to load replay %s: %v", replayId, err)
+		http.Error(w, "the replay can not be played", http.StatusInternalServerError)
+		return
+	}
+
+	conn, err := wsh.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Error %s when connecting to the socket", err)
+		return
+	}
+	defer conn.Close()
+
+	p := &playback{
+		Client: &client.Client{
+			Conn:      conn,
+			SendQueue: make(chan []byte, 100),
+			ID:        wsh.newClientId(conn),
+			Spectator: true,
+		},
+		ReplayId: replayId,
+		Player:   player,
+		Speed:    1,
+		Controls: make(chan *pb.ReplayControlMessage, controlBuffer),
+		Errors:   make(chan string, controlBuffer),
+		Done:     make(chan struct{}),
+		Metrics:  wsh.Metrics,
+		Clock:    wsh.Clock,
+	}
+
+	log.Printf("Client %s is watching replay %s", p.Client.ID, replayId)
+
+	// the writer drains the send queue until the playback goroutine closes it
+	go func() {
+		failed := false
+		for msg := range p.Client.SendQueue {
+			if failed {
+				continue
+			}
+
+			if err := conn.WriteMessage(websocket.BinaryMessage, msg); err != nil {
+				log.Println("Binary Message Write error (replay):", err)
+				conn.Close()
+				failed = true
+			}
+		}
+	}()
+
+	go p.run()
+
+	var once sync.Once
+	stop := func() { once.Do(func() { close(p.Done) }) }
+	defer stop()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		message := &pb.Message{}
+		if err := proto.Unmarshal(data, message); err != nil || message.Type != pb.MsgType_replay_control {
+			p.reportError("Replays only accept replay_control messages")
+			continue
+		}
+
+		select {
+		case p.Controls <- message.GetReplayControl():
+		default:
+			p.reportError("Too many replay controls, slow down")
+		}
+	}
+}
+
+// owns the client's send queue, nothing else sends on it and it is closed
+// here once the connection is done
+func (p *playback) run() {
+	defer close(p.Client.SendQueue)
+
+	p.sendSeekState(p.Player.JumpTo(0))
+	p.sendState()
+
+	timer := p.Clock.NewTimer(p.tickInterval())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-p.Done:
+			return
+
+		case control := <-p.Controls:
+			p.handleControl(control)
+
+		case reason := <-p.Errors:
+			p.sendError(reason)
+
+		case <-timer.C():
+			wait := p.tickInterval()
+
+			if !p.Paused && !p.Ended {
+				if p.Player.Done() {
+					p.Ended = true
+					p.sendState()
+				} else {
+					p.GoalReplay.add(p.Player.Sim.State)
+
+					// the live game shows the goal again and holds the ball,
+					// except after the winning goal
+					goal, finished := p.sendFrames(p.Player.Step())
+					if goal != "" && !finished {
+						p.send(p.GoalReplay.message(goal))
+						wait += p.scaled(time.Duration(p.Player.Header.GoalPauseMs) * time.Millisecond)
+					}
+
+					p.sendBall()
+
+					if p.Player.Sim.Tick%replay.KeyframeInterval == 0 {
+						p.sendState()
+					}
+				}
+			}
+
+			timer.Reset(wait)
+		}
+	}
+}
+
+func (p *playback) handleControl(control *pb.ReplayControlMessage) {
+	switch control.Action {
+	case "pause":
+		p.Paused = true
+
+	case "resume":
+		p.Paused = false
+
+	case "seek":
+		p.Ended = false
+		p.sendSeekState(p.Player.JumpTo(control.Tick))
+
+	case "speed":
+		// written so NaN fails the check too
+		if !(control.Speed >= minReplaySpeed && control.Speed <= maxReplaySpeed) {
+			p.sendError(fmt.Sprintf("Speed must be between %gx and %gx", minReplaySpeed, maxReplaySpeed))
+			return
+		}
+		p.Speed = control.Speed
+
+	default:
+		p.sendError(fmt.Sprintf("Unknown replay action %q", control.Action))
+		return
+	}
+
+	p.sendState()
+}
+
+func (p *playback) scaled(d time.Duration) time.Duration {
+	return time.Duration(float64(d) / p.Speed)
+}
+
+func (p *playback) tickInterval() time.Duration {
+	interval := time.Duration(p.Player.Header.TickIntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = BallTickInterval
+	}
+
+	return p.scaled(interval)
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Replay message functions
+
+// the playback goroutine is the only sender, so the queue is never closed
+// under it
+func (p *playback) send(message *pb.Message) {
+	encoded, err := proto.Marshal(message)
+	if err != nil {
+		log.Println("Failed to marshal replay message: ", err)
+		return
+	}
+
+	select {
+	case p.Client.SendQueue <- encoded:
+	default:
+		p.Metrics.dropped()
+		log.Printf("Dropping message, send queue full for client %s", p.Client.ID)
+	}
+}
+
+// called by the read loop, the error is sent by the playback goroutine. a
+// client flooding it with bad messages loses some of the errors
+func (p *playback) reportError(reason string) {
+	select {
+	case p.Errors <- reason:
+	default:
+		log.Printf("Dropping replay error for client %s: %s", p.Client.ID, reason)
+	}
+}
+
+func (p *playback) sendError(reason string) {
+	p.send(&pb.Message{
+		Type: pb.MsgType_error,
+		MessageType: &pb.Message_Error{
+			Error: &pb.ErrorMessage{Error: reason},
+		},
+	})
+}
+
+// sends the recorded events and the paddle moves, returns the team that
+// scored, if any, and whether the match ended
+func (p *playback) sendFrames(frames []*pb.ReplayFrame) (string, bool) {
+	goal := ""
+	finished := false
+	moved := false
+
+	for _, frame := range frames {
+		if event := frame.GetEvent(); event != nil {
+			p.send(event)
+
+			switch event.Type {
+			case pb.MsgType_score:
+				goal = strings.ToLower(event.GetScore().Scored)
+			case pb.MsgType_match_end:
+				finished = true
+			}
+		}
+
+		if frame.GetInput() != nil {
+			moved = true
+		}
+	}
+
+	// live spectators see moves as paddle positions
+	if moved {
+		p.send(&pb.Message{
+			Type: pb.MsgType_paddle_positions,
+			MessageType: &pb.Message_PaddlePositions{
+				PaddlePositions: &pb.PaddlePositionsMessage{
+					LeftPaddleData:  p.Player.Sim.LeftPaddle,
+					RightPaddleData: p.Player.Sim.RightPaddle,
+				},
+			},
+		})
+	}
+
+	return goal, finished
+}
+
+func (p *playback) sendBall() {
+	p.send(&pb.Message{
+		Type: pb.MsgType_ball_position,
+		MessageType: &pb.Message_BallPosition{
+			BallPosition: &pb.BallPositionMessage{
+				Ball: &pb.Ball{
+					X:      p.Player.Sim.Ball.X,
+					Y:      p.Player.Sim.Ball.Y,
+					Radius: p.Player.Sim.Ball.Radius,
+				},
+			},
+		},
+	})
+}
+
+// brings the client up to date after a jump, everything between the old and
+// the new tick was skipped
+func (p *playback) sendSeekState(frames []*pb.ReplayFrame) {
+	// the frames of the tick go out below, so the list only has to come from
+	// earlier when the tick does not have one
+	hasPlayers := false
+	for _, frame := range frames {
+		if frame.GetEvent().GetType() == pb.MsgType_room_players {
+			hasPlayers = true
+		}
+	}
+
+	if roomPlayers := p.Player.LastEvent(pb.MsgType_room_players); roomPlayers != nil && !hasPlayers {
+		p.send(roomPlayers)
+	}
+
+	p.GoalReplay.reset()
+
+	team := spectatorTeam
+	sim := p.Player.Sim
+
+	p.send(&pb.Message{
+		Type: pb.MsgType_game_state,
+		MessageType: &pb.Message_GameState{
+			GameState: &pb.GameStateMessage{
+				LeftPaddleData:  &sim.LeftPaddle,
+				RightPaddleData: &sim.RightPaddle,
+				Ball: &pb.Ball{
+					X:      sim.Ball.X,
+					Y:      sim.Ball.Y,
+					Radius: sim.Ball.Radius,
+				},
+				LeftScore:  &sim.Scores.LeftScores,
+				RightScore: &sim.Scores.RightScores,
+				YourTeam:   &team,
+			},
+		},
+	})
+
+	p.sendFrames(frames)
+}
+
+func (p *playback) sendState() {
+	p.send(&pb.Message{
+		Type: pb.MsgType_replay_state,
+		MessageType: &pb.Message_ReplayState{
+			ReplayState: &pb.ReplayStateMessage{
+				ReplayId:       p.ReplayId,
+				Tick:           p.Player.Sim.Tick,
+				LastTick:       p.Player.LastTick,
+				Speed:          p.Speed,
+				Paused:         p.Paused,
+				Ended:          p.Ended,
+				TickIntervalMs: p.Player.Header.TickIntervalMs,
+			},
+		},
+	})
+}
+
+// ---------------------------------------------------
@@ -0,0 +1,250 @@
+package wsserver
+
+import (
+	"github.com/google/uuid"
+	"github.com/mo-shahab/go-pong/auth"
+	"github.com/mo-shahab/go-pong/client"
+	"github.com/mo-shahab/go-pong/identity"
+	pb "github.com/mo-shahab/go-pong/proto"
+	"github.com/mo-shahab/go-pong/store"
+	"google.golang.org/protobuf/proto"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// chat constants
+const (
+	maxChatLength = 200
+)
+
+// ---------------------------------------------------
+// Identity functions
+
+// account holders are identified by their session claims, guests restore
+// their player from the token in the query or get a new one, and can pick
+// a display name
+func (wsh *WebSocketHandler) identify(client *client.Client, r *http.Request, claims *auth.Claims) {
+	if claims != nil {
+		wsh.identifyAccount(client, claims)
+		return
+	}
+
+	query := r.URL.Query()
+	now := wsh.Clock.Now()
+
+	player := store.Player{}
+	found := false
+
+	if token := query.Get("token"); token != "" {
+		var err error
+		player, found, err = wsh.Store.FindPlayerByToken(identity.HashToken(token))
+		if err != nil {
+			log.Println("Failed to look up the player token: ", err)
+		}
+	}
+
+	issuedToken := ""
+	if !found {
+		token, err := identity.GenerateToken()
+		if err != nil {
+			log.Println("Failed to generate a player token: ", err)
+		} else {
+			issuedToken = token
+		}
+
+		player = store.Player{
+			ID:        uuid.New().String(),
+			TokenHash: identity.HashToken(issuedToken),
+			CreatedAt: now,
+		}
+		player.Name = identity.GuestName(player.ID)
+	}
+
+	if name := query.Get("name"); name != "" {
+		validName, err := identity.ValidateName(name, wsh.Config.Names)
+		if err != nil {
+			wsh.sendError(client, err.Error())
+		} else {
+			player.Name = validName
+		}
+	}
+
+	player.LastSeen = now
+	if err := wsh.Store.PutPlayer(player); err != nil {
+		log.Println("Failed to save the player: ", err)
+	}
+
+	wsh.Mu.Lock()
+	client.PlayerId = player.ID
+	client.Name = player.Name
+	wsh.Mu.Unlock()
+
+	log.Printf("Client %s is player %s (%s)", client.ID, player.ID, player.Name)
+
+	wsh.sendIdentity(client, &pb.IdentityMessage{
+		PlayerId: player.ID,
+		Name:     player.Name,
+		Token:    issuedToken,
+	})
+}
+
+func (wsh *WebSocketHandler) identifyAccount(client *client.Client, claims *auth.Claims) {
+	now := wsh.Clock.Now()
+
+	player, found, err := wsh.Store.GetPlayer(claims.Subject)
+	if err != nil {
+		log.Println("Failed to load the account player: ", err)
+	}
+
+	if !found {
+		player = store.Player{
+			ID:        claims.Subject,
+			Name:      claims.Name,
+			CreatedAt: now,
+		}
+	}
+
+	player.LastSeen = now
+	if err := wsh.Store.PutPlayer(player); err != nil {
+		log.Println("Failed to save the player: ", err)
+	}
+
+	wsh.Mu.Lock()
+	client.PlayerId = player.ID
+	client.Name = player.Name
+	wsh.Mu.Unlock()
+
+	log.Printf("Client %s is account %s, player %s (%s)", client.ID, claims.Username, player.ID, player.Name)
+
+	wsh.sendIdentity(client, &pb.IdentityMessage{
+		PlayerId: player.ID,
+		Name:     player.Name,
+		Username: claims.Username,
+	})
+}
+
+func (wsh *WebSocketHandler) sendIdentity(client *client.Client, identityMessage *pb.IdentityMessage) {
+	wrappedMessage := &pb.Message{
+		Type: pb.MsgType_identity,
+		MessageType: &pb.Message_Identity{
+			Identity: identityMessage,
+		},
+	}
+
+	encoded, err := proto.Marshal(wrappedMessage)
+	if err != nil {
+		log.Println("Failed to marshal identity message: ", err)
+		return
+	}
+
+	wsh.sendToClient(client, encoded)
+}
+
+func newPlayerInfo(client *client.Client) *pb.PlayerInfo {
+	team := client.Team
+	if client.Spectator {
+		team = spectatorTeam
+	}
+
+	return &pb.PlayerInfo{
+		PlayerId: client.PlayerId,
+		Name:     client.Name,
+		Team:     team,
+		Bot:      client.Bot,
+	}
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Player list and chat functions
+
+func (wsh *WebSocketHandler) broadcastRoomPlayers(roomId string) {
+	wsh.Mu.Lock()
+	players := []*pb.PlayerInfo{}
+	for _, client := range wsh.Connections {
+		if client.RoomId == roomId && !client.Spectator {
+			players = append(players, newPlayerInfo(client))
+		}
+	}
+	spectators := wsh.spectatorCount(roomId)
+	wsh.Mu.Unlock()
+
+	sort.Slice(players, func(i, j int) bool {
+		if players[i].Team != players[j].Team {
+			return players[i].Team < players[j].Team
+		}
+		return players[i].Name < players[j].Name
+	})
+
+	roomPlayersMessage := &pb.RoomPlayersMessage{
+		RoomId:     roomId,
+		Players:    players,
+		Spectators: int32(spectators),
+	}
+
+	wrappedMessage := &pb.Message{
+		Type: pb.MsgType_room_players,
+		MessageType: &pb.Message_RoomPlayers{
+			RoomPlayers: roomPlayersMessage,
+		},
+	}
+
+	wsh.Mu.Lock()
+	wsh.recordRoomEvent(roomId, wrappedMessage)
+	wsh.Mu.Unlock()
+
+	encoded, err := proto.Marshal(wrappedMessage)
+	if err != nil {
+		log.Println("Failed to marshal room players message: ", err)
+		return
+	}
+
+	wsh.broadcastToRoom(roomId, encoded)
+}
+
+func (wsh *WebSocketHandler) handleChat(client *client.Client, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+
+	if utf8.RuneCountInString(text) > maxChatLength {
+		wsh.sendError(client, "Chat message is too long")
+		return
+	}
+
+	wsh.Mu.Lock()
+	from := newPlayerInfo(client)
+	roomId := client.RoomId
+	wsh.Mu.Unlock()
+
+	chatMessage := &pb.ChatMessage{
+		Text: text,
+		From: from,
+	}
+
+	wrappedMessage := &pb.Message{
+		Type: pb.MsgType_chat,
+		MessageType: &pb.Message_Chat{
+			Chat: chatMessage,
+		},
+	}
+
+	wsh.Mu.Lock()
+	wsh.recordRoomEvent(roomId, wrappedMessage)
+	wsh.Mu.Unlock()
+
+	encoded, err := proto.Marshal(wrappedMessage)
+	if err != nil {
+		log.Println("Failed to marshal chat message: ", err)
+		return
+	}
+
+	wsh.broadcastToRoom(roomId, encoded)
+}
+
+// ---------------------------------------------------
@@ -0,0 +1,102 @@
+package wsserver
+
+import (
+	"github.com/google/uuid"
+	"github.com/mo-shahab/go-pong/client"
+	pb "github.com/mo-shahab/go-pong/proto"
+	"github.com/mo-shahab/go-pong/replay"
+	"io"
+	"log"
+	"time"
+)
+
+// ---------------------------------------------------
+// Replay recording functions, all of them expect wsh.Mu to be held except
+// for createReplay and stopRecording
+
+// creates the replay file, without wsh.Mu since the disk can be slow and
+// every room waits on the lock
+func (wsh *WebSocketHandler) createReplay() (string, io.WriteCloser, error) {
+	replayId := uuid.New().String()
+
+	w, err := wsh.Store.CreateReplay(replayId)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return replayId, w, nil
+}
+
+// starts recording the game into the created replay
+func (wsh *WebSocketHandler) startRecording(g *game, replayId string, w io.WriteCloser) {
+	players := []*pb.PlayerInfo{}
+	for _, client := range g.Clients {
+		players = append(players, newPlayerInfo(client))
+	}
+
+	header := &pb.ReplayHeader{
+		Version:          replay.Version,
+		ReplayId:         replayId,
+		RoomId:           g.RoomId,
+		Seed:             g.Sim.Seed,
+		Arena:            replay.NewArena(g.Sim.Arena),
+		Players:          players,
+		StartedAt:        g.StartedAt.UnixMilli(),
+		TickIntervalMs:   int32(BallTickInterval / time.Millisecond),
+		WinningScore:     WinningScore,
+		GoalPauseMs:      int32(GoalPause / time.Millisecond),
+		KeyframeInterval: replay.KeyframeInterval,
+	}
+
+	g.ReplayId = replayId
+	g.Recorder = replay.NewRecorder(replayId, w, header)
+	g.Recorder.Snapshot(g.Sim.State)
+
+	log.Printf("Recording room %q to replay %s", g.RoomId, replayId)
+}
+
+func (g *game) recordInput(client *client.Client, direction string) {
+	if g.Recorder == nil {
+		return
+	}
+
+	g.Recorder.Input(g.Sim.Tick, client.PlayerId, client.Team, direction)
+}
+
+// snapshots the state every few ticks so playback can seek without
+// simulating from the start
+func (g *game) recordKeyframe() {
+	if g.Recorder == nil || g.Sim.Tick%replay.KeyframeInterval != 0 {
+		return
+	}
+
+	g.Recorder.Snapshot(g.Sim.State)
+}
+
+func (g *game) recordEvent(message *pb.Message) {
+	if g.Recorder == nil {
+		return
+	}
+
+	g.Recorder.Event(g.Sim.Tick, message)
+}
+
+func (wsh *WebSocketHandler) recordRoomEvent(roomId string, message *pb.Message) {
+	if g, exists := wsh.Games[roomId]; exists {
+		g.recordEvent(message)
+	}
+}
+
+// takes wsh.Mu itself and waits for the replay to be written out
+func (wsh *WebSocketHandler) stopRecording(g *game) {
+	wsh.Mu.Lock()
+	recorder := g.Recorder
+	g.Recorder = nil
+	wsh.Mu.Unlock()
+
+	if recorder != nil {
+		recorder.Close()
+	}
+}
+
+// ---------------------------------------------------
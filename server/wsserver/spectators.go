@@ -0,0 +1,100 @@
+package wsserver
+
+import (
+	"log"
+	"time"
+)
+
+// most messages a room may have waiting for its spectators, about five
+// minutes of ball updates
+const maxSpectatorBacklog = 10000
+
+type delayedMessage struct {
+	Due     time.Time
+	Message []byte
+}
+
+// messages of a room held back from its spectators, oldest first
+type spectatorFeed struct {
+	RoomId string
+	Queue  []delayedMessage
+}
+
+// ---------------------------------------------------
+// Delayed spectator functions
+
+func (wsh *WebSocketHandler) spectatorDelay() time.Duration {
+	return wsh.Config.Spectators.Delay.Duration
+}
+
+// holds the message back until the spectator delay has passed, only rooms
+// with spectators or event subscribers are buffered so a new spectator
+// starts watching once the delay has passed. expects wsh.Mu to be held
+func (wsh *WebSocketHandler) queueForSpectators(roomId string, message []byte) {
+	feed, exists := wsh.SpectatorFeeds[roomId]
+	if !exists {
+		if wsh.spectatorCount(roomId) == 0 && len(wsh.Subscribers[roomId]) == 0 {
+			return
+		}
+
+		feed = &spectatorFeed{RoomId: roomId}
+		wsh.SpectatorFeeds[roomId] = feed
+		go wsh.runSpectatorFeed(feed)
+	}
+
+	if len(feed.Queue) >= maxSpectatorBacklog {
+		log.Printf("Dropping spectator message, backlog full for room %s", roomId)
+		return
+	}
+
+	feed.Queue = append(feed.Queue, delayedMessage{
+		Due:     wsh.Clock.Now().Add(wsh.spectatorDelay()),
+		Message: message,
+	})
+}
+
+// sends the messages to the room's spectators as they come due, and stops
+// once the queue runs dry
+func (wsh *WebSocketHandler) runSpectatorFeed(feed *spectatorFeed) {
+	for {
+		wsh.Mu.Lock()
+		if len(feed.Queue) == 0 {
+			delete(wsh.SpectatorFeeds, feed.RoomId)
+			wsh.Mu.Unlock()
+			return
+		}
+		next := feed.Queue[0].Due
+		wsh.Mu.Unlock()
+
+		wsh.Clock.Sleep(next.Sub(wsh.Clock.Now()))
+
+		wsh.Mu.Lock()
+		now := wsh.Clock.Now()
+		due := 0
+		for due < len(feed.Queue) && !feed.Queue[due].Due.After(now) {
+			wsh.sendToSpectators(feed.RoomId, feed.Queue[due].Message)
+			wsh.sendToSubscribers(feed.RoomId, feed.Queue[due].Message)
+			due++
+		}
+		feed.Queue = feed.Queue[due:]
+		wsh.Mu.Unlock()
+	}
+}
+
+// expects wsh.Mu to be held
+func (wsh *WebSocketHandler) sendToSpectators(roomId string, message []byte) {
+	for _, client := range wsh.Connections {
+		if client.RoomId != roomId || !client.Spectator {
+			continue
+		}
+
+		select {
+		case client.SendQueue <- message:
+		default:
+			wsh.Metrics.dropped()
+			log.Printf("Dropping message, send queue full for client %s", client.ID)
+		}
+	}
+}
+
+// ---------------------------------------------------
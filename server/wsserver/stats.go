@@ -0,0 +1,216 @@
+package wsserver
+
+import (
+	"github.com/google/uuid"
+	"github.com/mo-shahab/go-pong/client"
+	pb "github.com/mo-shahab/go-pong/proto"
+	"github.com/mo-shahab/go-pong/store"
+	"google.golang.org/protobuf/proto"
+	"log"
+	"math"
+	"sort"
+	"time"
+)
+
+// match history constants
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// statistics collected while a match is played, guarded by wsh.Mu like the
+// rest of the game
+type matchStats struct {
+	Goals        []store.Goal
+	Hits         map[string]int // player id to paddle hits
+	Rally        int
+	LongestRally int
+	speedSum     float64
+	speedSamples int
+}
+
+func newMatchStats() matchStats {
+	return matchStats{
+		Hits: make(map[string]int),
+	}
+}
+
+// ---------------------------------------------------
+// Stat hooks, called from the ball logic with wsh.Mu held
+
+// credits a paddle hit to whoever moved the team's paddle last, or to the
+// whole team if nobody has moved it yet
+func (g *game) recordHit(team string) {
+	g.Stats.Rally++
+	if g.Stats.Rally > g.Stats.LongestRally {
+		g.Stats.LongestRally = g.Stats.Rally
+	}
+
+	lastMover := g.LeftPaddleData.lastMover
+	if team == "right" {
+		lastMover = g.RightPaddleData.lastMover
+	}
+
+	if lastMover != "" {
+		g.Stats.Hits[lastMover]++
+		return
+	}
+
+	for _, client := range g.Clients {
+		if client.Team == team {
+			g.Stats.Hits[client.PlayerId]++
+		}
+	}
+}
+
+// adds the goal to the timeline and ends the current rally, the scores
+// should already include the goal
+func (g *game) recordGoal(team string, scorers []*client.Client, now time.Time) {
+	scorerIds := make([]string, 0, len(scorers))
+	for _, scorer := range scorers {
+		scorerIds = append(scorerIds, scorer.PlayerId)
+	}
+
+	g.Stats.Goals = append(g.Stats.Goals, store.Goal{
+		Team:      team,
+		ScorerIds: scorerIds,
+		Time:      now.Sub(g.StartedAt).Seconds(),
+		Scores:    g.Sim.Scores,
+		Rally:     g.Stats.Rally,
+	})
+
+	g.Stats.Rally = 0
+}
+
+func (g *game) sampleBallSpeed() {
+	perTick := math.Hypot(g.Sim.Ball.Dx, g.Sim.Ball.Dy)
+	g.Stats.speedSum += perTick * float64(time.Second) / float64(BallTickInterval)
+	g.Stats.speedSamples++
+}
+
+// ---------------------------------------------------
+
+// ---------------------------------------------------
+// Match result functions
+
+// builds the result of the finished match, expects wsh.Mu to be held
+func (g *game) matchResult(winner string, now time.Time) store.MatchResult {
+
+	participants := make([]store.Participant, 0, len(g.Clients))
+	for _, client := range g.Clients {
+		participants = append(participants, store.Participant{
+			PlayerId: client.PlayerId,
+			Name:     client.Name,
+			Team:     client.Team,
+			Hits:     g.Stats.Hits[client.PlayerId],
+		})
+	}
+
+	sort.Slice(participants, func(i, j int) bool {
+		if participants[i].Team != participants[j].Team {
+			return participants[i].Team < participants[j].Team
+		}
+		return participants[i].Name < participants[j].Name
+	})
+
+	averageSpeed := 0.0
+	if g.Stats.speedSamples > 0 {
+		averageSpeed = g.Stats.speedSum / float64(g.Stats.speedSamples)
+	}
+
+	return store.MatchResult{
+		ID:               uuid.New().String(),
+		RoomId:           g.RoomId,
+		Winner:           winner,
+		Scores:           g.Sim.Scores,
+		Participants:     participants,
+		Goals:            append([]store.Goal{}, g.Stats.Goals...),
+		Duration:         now.Sub(g.StartedAt).Seconds(),
+		LongestRally:     g.Stats.LongestRally,
+		AverageBallSpeed: averageSpeed,
+		ReplayId:         g.ReplayId,
+		StartedAt:        g.StartedAt,
+		EndedAt:          now,
+	}
+}
+
+func newMatchResultMessage(match store.MatchResult) *pb.MatchResultMessage {
+	participants := make([]*pb.MatchParticipant, 0, len(match.Participants))
+	for _, participant := range match.Participants {
+		participants = append(participants, &pb.MatchParticipant{
+			PlayerId: participant.PlayerId,
+			Name:     participant.Name,
+			Team:     participant.Team,
+			Hits:     int32(participant.Hits),
+		})
+	}
+
+	goals := make([]*pb.GoalEvent, 0, len(match.Goals))
+	for _, goal := range match.Goals {
+		goals = append(goals, &pb.GoalEvent{
+			Team:        goal.Team,
+			ScorerIds:   goal.ScorerIds,
+			TimeSeconds: goal.Time,
+			LeftScore:   goal.Scores.LeftScores,
+			RightScore:  goal.Scores.RightScores,
+			Rally:       int32(goal.Rally),
+		})
+	}
+
+	return &pb.MatchResultMessage{
+		MatchId:          match.ID,
+		RoomId:           match.RoomId,
+		Winner:           match.Winner,
+		LeftScore:        match.Scores.LeftScores,
+		RightScore:       match.Scores.RightScores,
+		Participants:     participants,
+		Goals:            goals,
+		DurationSeconds:  match.Duration,
+		LongestRally:     int32(match.LongestRally),
+		AverageBallSpeed: match.AverageBallSpeed,
+		StartedAt:        match.StartedAt.UnixMilli(),
+		ReplayId:         match.ReplayId,
+	}
+}
+
+func (wsh *WebSocketHandler) sendMatchHistory(client *client.Client, playerId string, limit int) {
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	} else if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	matches, err := wsh.Store.ListPlayerMatches(playerId, limit)
+	if err != nil {
+		log.Println("Failed to load the match history: ", err)
+		wsh.sendError(client, "Failed to load the match history")
+		return
+	}
+
+	matchMessages := make([]*pb.MatchResultMessage, 0, len(matches))
+	for _, match := range matches {
+		matchMessages = append(matchMessages, newMatchResultMessage(match))
+	}
+
+	matchHistoryMessage := &pb.MatchHistoryMessage{
+		PlayerId: playerId,
+		Matches:  matchMessages,
+	}
+
+	wrappedMessage := &pb.Message{
+		Type: pb.MsgType_match_history,
+		MessageType: &pb.Message_MatchHistory{
+			MatchHistory: matchHistoryMessage,
+		},
+	}
+
+	encoded, err := proto.Marshal(wrappedMessage)
+	if err != nil {
+		log.Println("Failed to marshal match history message: ", err)
+		return
+	}
+
+	wsh.sendToClient(client, encoded)
+}
+
+// ---------------------------------------------------
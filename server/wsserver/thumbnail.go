@@ -0,0 +1,133 @@
+package wsserver
+
+import (
+	"bytes"
+	"github.com/mo-shahab/go-pong/canvas"
+	"github.com/mo-shahab/go-pong/paddle"
+	"github.com/mo-shahab/go-pong/render"
+	"github.com/mo-shahab/go-pong/simulation"
+	"log"
+	"net/http"
+	"time"
+)
+
+// thumbnail constants
+const (
+	thumbnailCacheTTL = time.Second
+	thumbnailInterval = time.Second // between states kept for delayed thumbnails
+)
+
+// arena drawn for rooms whose game has not been set up yet
+var lobbyArena = simulation.Arena{
+	Canvas:     canvas.Canvas{Width: 800, Height: 600},
+	Paddle:     paddle.Paddle{Width: 10, Height: 100},
+	BallRadius: simulation.BallRadius,
+}
+
+type thumbnail struct {
+	PNG        []byte
+	RenderedAt time.Time
+}
+
+// a past state of the game, kept so thumbnails can lag behind like
+// everything else spectators see
+type timedState struct {
+	At    time.Time
+	State simulation.State
+}
+
+// ---------------------------------------------------
+// Thumbnail functions
+
+// keeps about one state a second for as long as the spectator delay, the
+// newest state that is old enough is always kept. expects wsh.Mu to be held
+func (wsh *WebSocketHandler) keepThumbnailState(g *game) {
+	delay := wsh.spectatorDelay()
+	if delay == 0 {
+		g.PastStates = nil
+		return
+	}
+
+	now := wsh.Clock.Now()
+	if n := len(g.PastStates); n == 0 || now.Sub(g.PastStates[n-1].At) >= thumbnailInterval {
+		g.PastStates = append(g.PastStates, timedState{At: now, State: g.Sim.State})
+	}
+
+	cutoff := now.Add(-delay)
+	for len(g.PastStates) > 1 && !g.PastStates[1].At.After(cutoff) {
+		g.PastStates = g.PastStates[1:]
+	}
+}
+
+// what spectators of the room would see right now, false before the game
+// has started or, with a spectator delay, before it has been running for
+// that long. expects wsh.Mu to be held
+func (wsh *WebSocketHandler) thumbnailState(roomId string) (simulation.Arena, simulation.State, bool) {
+	g, exists := wsh.Games[roomId]
+	if !exists || g.Sim == nil {
+		return lobbyArena, simulation.State{}, false
+	}
+
+	delay := wsh.spectatorDelay()
+	if delay == 0 {
+		return g.Sim.Arena, g.Sim.State, true
+	}
+
+	if len(g.PastStates) == 0 || g.PastStates[0].At.After(wsh.Clock.Now().Add(-delay)) {
+		return g.Sim.Arena, simulation.State{}, false
+	}
+
+	return g.Sim.Arena, g.PastStates[0].State, true
+}
+
+// GET /rooms/{id}/thumbnail.png, a picture of the room's game for the lobby
+// browser, rendered at most once per cache interval
+func (wsh *WebSocketHandler) ServeRoomThumbnail(w http.ResponseWriter, r *http.Request) {
+	roomId := r.PathValue("id")
+
+	if _, exists := wsh.RoomManager.GetRoom(roomId); !exists {
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	wsh.Mu.Lock()
+
+	now := wsh.Clock.Now()
+	for id, cached := range wsh.Thumbnails {
+		if now.Sub(cached.RenderedAt) >= thumbnailCacheTTL {
+			delete(wsh.Thumbnails, id)
+		}
+	}
+
+	cached, exists := wsh.Thumbnails[roomId]
+	arena, state, playing := wsh.thumbnailState(roomId)
+
+	wsh.Mu.Unlock()
+
+	if !exists {
+		// an empty arena with centered paddles until there is a game to show
+		if !playing {
+			state = simulation.New(arena, 0).State
+			state.Ball.Visible = false
+		}
+
+		var encoded bytes.Buffer
+		if err := render.New(arena).PNG(&encoded, state); err != nil {
+			log.Println("Failed to render the thumbnail: ", err)
+			http.Error(w, "failed to render the thumbnail", http.StatusInternalServerError)
+			return
+		}
+
+		cached = &thumbnail{PNG: encoded.Bytes(), RenderedAt: now}
+
+		wsh.Mu.Lock()
+		wsh.Thumbnails[roomId] = cached
+		wsh.Mu.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "max-age=1")
+	w.Write(cached.PNG)
+}
+
+// ---------------------------------------------------
@@ -1,21 +1,25 @@
 package wsserver
 
 import (
-	"context"
+	"fmt"
 	"github.com/gorilla/websocket"
-	"github.com/mo-shahab/go-pong/ball"
-	"github.com/mo-shahab/go-pong/canvas"
+	"github.com/mo-shahab/go-pong/auth"
 	"github.com/mo-shahab/go-pong/client"
-	"github.com/mo-shahab/go-pong/paddle"
+	"github.com/mo-shahab/go-pong/clock"
+	"github.com/mo-shahab/go-pong/config"
+	"github.com/mo-shahab/go-pong/matchmaking"
 	pb "github.com/mo-shahab/go-pong/proto"
+	"github.com/mo-shahab/go-pong/rating"
+	"github.com/mo-shahab/go-pong/replay"
 	"github.com/mo-shahab/go-pong/room"
-	"github.com/mo-shahab/go-pong/scores"
+	"github.com/mo-shahab/go-pong/simulation"
+	"github.com/mo-shahab/go-pong/store"
 	"google.golang.org/protobuf/proto"
 	"log"
-	"math"
-	"math/rand"
+	"math/rand/v2"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,30 +28,31 @@ type paddleData struct {
 	velocity    float64
 	players     int
 	position    float64
+	lastMover   string // player id, gets credited for the paddle's hits
 }
 
-type paddlePositions struct {
-	leftPaddle  float64
-	rightPaddle float64
-}
+// how often the ball moves and its position is broadcast
+const BallTickInterval = 32 * time.Millisecond
 
 type WebSocketHandler struct {
 	Upgrader        websocket.Upgrader
-	LeftPaddleData  paddleData
-	RightPaddleData paddleData
-	InitLeftPaddle  float64
-	InitRightPaddle float64
-	BallVar         ball.Ball
-	CanvasVar       canvas.Canvas
-	PaddleVar       paddle.Paddle
+	Config          *config.Config
 	Mu              sync.Mutex
 	Connections     map[string]*client.Client
 	ConnToId        map[*websocket.Conn]string
-	BallRunning     bool
-	BallVisible     bool
-	Scores          scores.Scores
+	Games           map[string]*game
 	RoomManager     *room.RoomManager
 	WaitingRooms map[string]*room.WaitingRoomState
+	Matchmaker      *matchmaking.Queue
+	SpectatorFeeds  map[string]*spectatorFeed
+	Subscribers     map[string]map[chan []byte]bool
+	Thumbnails      map[string]*thumbnail
+	Store           store.Store
+	Ratings         *rating.Service
+	Auth            *auth.Service
+	Metrics         *Metrics
+	Clock           clock.Clock
+	ClientIds       atomic.Uint64 // numbers the connections, ids stay unique on a fake clock
 }
 
 // ball constants
@@ -70,16 +75,46 @@ const (
 	WaitingRoomDuration = 90
 )
 
-var globalPaddlePositions = &paddlePositions{}
-
-func NewWebSocketHandler() *WebSocketHandler {
-	return &WebSocketHandler{
+func NewWebSocketHandler(cfg *config.Config, st store.Store, authService *auth.Service) *WebSocketHandler {
+	wsh := &WebSocketHandler{
 		Upgrader:    websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }},
+		Config:      cfg,
 		Connections: make(map[string]*client.Client),
 		ConnToId:    make(map[*websocket.Conn]string),
+		Games:       make(map[string]*game),
 		RoomManager: room.NewRoomManager(),
 		WaitingRooms: make(map[string]*room.WaitingRoomState),
+		Matchmaker:  matchmaking.NewQueue(),
+		SpectatorFeeds: make(map[string]*spectatorFeed),
+		Subscribers: make(map[string]map[chan []byte]bool),
+		Thumbnails:  make(map[string]*thumbnail),
+		Store:       st,
+		Ratings:     rating.NewService(st),
+		Auth:        authService,
+		Metrics:     &Metrics{},
+		Clock:       clock.Real{},
+	}
+
+	wsh.Matchmaker.RatingOf = func(c *client.Client) (float64, bool) {
+		r, found := wsh.Ratings.Lookup(c.PlayerId)
+		return r.Rating, found
 	}
+	wsh.Matchmaker.OnMatch = wsh.createMatchRoom
+	wsh.Matchmaker.OnUpdate = wsh.sendMatchmakingStatus
+	wsh.Matchmaker.Start()
+
+	return wsh
+}
+
+// puts the handler, its waiting rooms and the matchmaking queue on another
+// clock, should be called before the handler serves anything
+func (wsh *WebSocketHandler) SetClock(c clock.Clock) {
+	wsh.Clock = c
+	wsh.RoomManager.Clock = c
+
+	wsh.Matchmaker.Stop()
+	wsh.Matchmaker.Clock = c
+	wsh.Matchmaker.Start()
 }
 
 // --------------------------------------------------
@@ -95,20 +130,16 @@ func (wsh *WebSocketHandler) startWaitingRoom(roomId string) {
 		return
 	}
 	
-	ctx, cancel := context.WithTimeout(
-		context.Background(), WaitingRoomDuration*time.Second,
-	)
-
 	log.Println("Time left is set to ", WaitingRoomDuration)
 	
-	waitingRoom := room.NewWaitingRoomState(roomObj, WaitingRoomDuration, ctx, cancel)
+	waitingRoom := wsh.RoomManager.NewWaitingRoom(roomObj, WaitingRoomDuration*time.Second)
 	wsh.WaitingRooms[roomId] = waitingRoom
 	go wsh.runWaitingRoom(waitingRoom)
 	log.Println("Started waiting room for roomId: ", roomId)
 }
 
 func (wsh *WebSocketHandler) runWaitingRoom(waitingRoom *room.WaitingRoomState) {
-    ticker := time.NewTicker(1000 * time.Millisecond) // For UI updates
+    ticker := wsh.Clock.NewTicker(1000 * time.Millisecond) // For UI updates
     defer ticker.Stop()
     
     for {
@@ -126,7 +157,7 @@ func (wsh *WebSocketHandler) runWaitingRoom(waitingRoom *room.WaitingRoomState)
             }
             return
             
-        case <-ticker.C:
+        case <-ticker.C():
             waitingRoom.Mu.Lock()
             
             if !waitingRoom.IsActive {
@@ -134,11 +165,8 @@ func (wsh *WebSocketHandler) runWaitingRoom(waitingRoom *room.WaitingRoomState)
                 return
             }
             
-            // Calculate remaining time from context deadline
-            deadline, ok := waitingRoom.Ctx.Deadline()
-            if ok {
-                waitingRoom.TimeLeft = int(time.Until(deadline).Seconds())
-            }
+            // Calculate remaining time from the deadline
+            waitingRoom.UpdateTimeLeft()
             
             arePlayersFilled := waitingRoom.CurrentPlayers >= waitingRoom.Room.MaxPlayers
             areMinimumPlayers := waitingRoom.CurrentPlayers >= MinPlayersToStart
@@ -151,11 +179,10 @@ func (wsh *WebSocketHandler) runWaitingRoom(waitingRoom *room.WaitingRoomState)
                 return
             }
             
+            waitingRoom.Mu.Unlock()
+
             // Broadcast timer update to clients here
 			wsh.broadcastWaitingRoomMessage(waitingRoom)
-
-            
-            waitingRoom.Mu.Unlock()
         }
     }
 }
@@ -167,11 +194,16 @@ func (wsh *WebSocketHandler) broadcastWaitingRoomMessage(waitingRoom *room.Waiti
 		MaxPlayers: int32(waitingRoom.Room.MaxPlayers),
 	}
 	
+	wsh.Mu.Lock()
+	spectators := wsh.spectatorCount(waitingRoom.Room.ID)
+	wsh.Mu.Unlock()
+
 	waitingRoomMessage := &pb.WaitingRoomStateMessage {
 		Room: roomMessage,
 		CurrentPlayers: int32(waitingRoom.CurrentPlayers),
 		TimeLeft: int32(waitingRoom.TimeLeft),
 		IsActive: waitingRoom.IsActive,
+		Spectators: int32(spectators),
 	}
 
 	wrappedMessage := &pb.Message {
@@ -188,7 +220,7 @@ func (wsh *WebSocketHandler) broadcastWaitingRoomMessage(waitingRoom *room.Waiti
 		return
 	}
 
-	wsh.broadcastToAll(encoded)
+	wsh.broadcastToRoom(waitingRoom.Room.ID, encoded)
 }
 
 func (wsh *WebSocketHandler) addPlayerToWaitingRoom(roomId string, client *client.Client) bool {
@@ -198,6 +230,7 @@ func (wsh *WebSocketHandler) addPlayerToWaitingRoom(roomId string, client *clien
 	waitingRoom, exists := wsh.WaitingRooms[roomId]
 	if !exists {
 		log.Println("Waiting Room does not exist")
+		return false
 	}
 
 	waitingRoom.Mu.Lock()
@@ -210,8 +243,9 @@ func (wsh *WebSocketHandler) addPlayerToWaitingRoom(roomId string, client *clien
 	waitingRoom.CurrentPlayers++
 
 	client.RoomId = roomId
+	client.Spectator = false
 
-	log.Println("Player %s joined room %s. Current Players: %d/%d", 
+	log.Printf("Player %s joined room %s. Current Players: %d/%d", 
 		client.ID, 
 		roomId, 
 		waitingRoom.CurrentPlayers, 
@@ -248,7 +282,6 @@ func (wsh *WebSocketHandler) removePlayerFromRoom (roomId string, client client.
 
 func (wsh *WebSocketHandler) startGame (roomId string) {
 	wsh.Mu.Lock()
-	defer wsh.Mu.Unlock()
 
 	waitingRoom, exists := wsh.WaitingRooms[roomId]
 	if exists {
@@ -256,8 +289,11 @@ func (wsh *WebSocketHandler) startGame (roomId string) {
 		delete(wsh.WaitingRooms, roomId)
 	}
 
+	// broadcastToRoom takes the lock again
+	wsh.Mu.Unlock()
+
 	gameStartMessage := &pb.GameStartMessage {
-		RoomId: waitingRoom.Room.ID,
+		RoomId: roomId,
 	}
 
 	wrappedMessage := &pb.Message {
@@ -278,12 +314,11 @@ func (wsh *WebSocketHandler) startGame (roomId string) {
 
 func (wsh *WebSocketHandler) closeRoom(roomId string, reason string) {
 	wsh.Mu.Lock()
-	defer wsh.Mu.Unlock()
-	
 	if waitingRoom, exists := wsh.WaitingRooms[roomId]; exists {
 		waitingRoom.Cancel()
 		delete(wsh.WaitingRooms, roomId)
 	}
+	wsh.Mu.Unlock()
 	
 	// Send room closed message
 	roomClosedMessage := &pb.RoomClosedMessage{
@@ -310,66 +345,346 @@ func (wsh *WebSocketHandler) closeRoom(roomId string, reason string) {
 }
 
 
+// joins an existing room and puts the client in its waiting room
+func (wsh *WebSocketHandler) joinRoom(roomId string, client *client.Client) (bool, string) {
+	joined, reason := wsh.RoomManager.JoinRoom(roomId, client)
+	if !joined {
+		return false, reason
+	}
+
+	if !wsh.addPlayerToWaitingRoom(roomId, client) {
+		wsh.RoomManager.RemoveClient(roomId, client.ID)
+		return false, "Room is not accepting players"
+	}
+
+	wsh.broadcastRoomPlayers(roomId)
+
+	return true, ""
+}
+
+// lets the client watch the room without taking a player slot
+func (wsh *WebSocketHandler) spectateRoom(roomId string, client *client.Client) (bool, string) {
+	joined, reason := wsh.RoomManager.Spectate(roomId, client)
+	if !joined {
+		return false, reason
+	}
+
+	wsh.Mu.Lock()
+	client.RoomId = roomId
+	client.Spectator = true
+	client.Team = ""
+	wsh.Mu.Unlock()
+
+	log.Printf("Client %s is spectating room %s", client.ID, roomId)
+
+	wsh.broadcastRoomPlayers(roomId)
+
+	return true, ""
+}
+
+// number of spectators watching the room, expects wsh.Mu to be held
+func (wsh *WebSocketHandler) spectatorCount(roomId string) int {
+	count := 0
+	for _, client := range wsh.Connections {
+		if client.RoomId == roomId && client.Spectator {
+			count++
+		}
+	}
+
+	return count
+}
+
+//---------------------------------------------------
+
+// ---------------------------------------------------
+// Matchmaking Functions
+
+// called by the matchmaking queue with a group of compatible players, the
+// first ticket hosts the room and everyone goes straight into its waiting room
+func (wsh *WebSocketHandler) createMatchRoom(tickets []*matchmaking.Ticket) {
+	wsh.Mu.Lock()
+
+	// players can leave or get into a room by hand between the matchmaking
+	// pass and here, the rest go back in the queue without them
+	available := make([]*matchmaking.Ticket, 0, len(tickets))
+	for _, ticket := range tickets {
+		if wsh.Connections[ticket.Client.ID] == ticket.Client && ticket.Client.RoomId == "" {
+			available = append(available, ticket)
+		}
+	}
+
+	if len(available) < len(tickets) {
+		wsh.Mu.Unlock()
+
+		log.Printf("Match fell through, %d of %d players are still available", len(available), len(tickets))
+		wsh.Matchmaker.Requeue(available)
+		return
+	}
+
+	host := tickets[0]
+
+	roomId := wsh.RoomManager.CreateRoom(host.Client, host.TeamSize*2)
+	host.Client.RoomId = roomId
+	host.Client.Spectator = false
+
+	wsh.Mu.Unlock()
+
+	wsh.startWaitingRoom(roomId)
+
+	for _, ticket := range tickets[1:] {
+		if joined, reason := wsh.joinRoom(roomId, ticket.Client); !joined {
+			log.Printf("Failed to place client %s in room %s: %s", ticket.Client.ID, roomId, reason)
+		}
+	}
+
+	for _, ticket := range tickets {
+		if ticket.Client.RoomId != roomId {
+			continue
+		}
+
+		matchFoundMessage := &pb.MatchFoundMessage{
+			RoomId:   roomId,
+			Mode:     ticket.Mode,
+			TeamSize: int32(ticket.TeamSize),
+		}
+
+		wrappedMessage := &pb.Message{
+			Type: pb.MsgType_match_found,
+			MessageType: &pb.Message_MatchFound{
+				MatchFound: matchFoundMessage,
+			},
+		}
+
+		encoded, err := proto.Marshal(wrappedMessage)
+		if err != nil {
+			log.Println("Failed to marshal match found message: ", err)
+			continue
+		}
+
+		wsh.sendToClient(ticket.Client, encoded)
+	}
+}
+
+// takes the client out of the matchmaking queue, it is told its ticket is
+// cancelled. clients going into a room by hand leave the queue too
+func (wsh *WebSocketHandler) leaveQueue(client *client.Client) {
+	if ticket, cancelled := wsh.Matchmaker.Cancel(client.ID); cancelled {
+		wsh.sendMatchmakingMessage(ticket, wsh.Matchmaker.Queued(ticket.Mode, ticket.TeamSize), 0, true)
+	}
+}
+
+func (wsh *WebSocketHandler) sendMatchmakingStatus(ticket *matchmaking.Ticket, queued int, estimate time.Duration) {
+	wsh.sendMatchmakingMessage(ticket, queued, estimate, false)
+}
+
+func (wsh *WebSocketHandler) sendMatchmakingMessage(ticket *matchmaking.Ticket, queued int, estimate time.Duration, cancelled bool) {
+	statusMessage := &pb.MatchmakingStatusMessage{
+		TicketId:      ticket.ID,
+		Mode:          ticket.Mode,
+		TeamSize:      int32(ticket.TeamSize),
+		QueuedPlayers: int32(queued),
+		EstimatedWait: int32(estimate.Seconds()),
+		TimeInQueue:   int32(wsh.Clock.Since(ticket.EnqueuedAt).Seconds()),
+		Cancelled:     cancelled,
+	}
+
+	wrappedMessage := &pb.Message{
+		Type: pb.MsgType_matchmaking_status,
+		MessageType: &pb.Message_MatchmakingStatus{
+			MatchmakingStatus: statusMessage,
+		},
+	}
+
+	encoded, err := proto.Marshal(wrappedMessage)
+	if err != nil {
+		log.Println("Failed to marshal matchmaking status message: ", err)
+		return
+	}
+
+	wsh.sendToClient(ticket.Client, encoded)
+}
+
 //---------------------------------------------------
 
 // ---------------------------------------------------
 // Broadcast functions
-func (wsh *WebSocketHandler) broadcastToAll(message []byte) {
+
+// sends a message to a single client, safe to call from goroutines other
+// than the client's own read loop
+func (wsh *WebSocketHandler) sendToClient(client *client.Client, message []byte) {
 	wsh.Mu.Lock()
 	defer wsh.Mu.Unlock()
 
-	for _, client := range wsh.Connections {
-		select {
-		case client.SendQueue <- message:
-			// log.Println("Message sent to client:", conn.RemoteAddr())
-		default:
-			log.Println("Dropping message, send queue full for client")
-		}
+	if wsh.Connections[client.ID] != client {
+		return
+	}
+
+	select {
+	case client.SendQueue <- message:
+	default:
+		wsh.Metrics.dropped()
+		log.Printf("Dropping message, send queue full for client %s", client.ID)
+	}
+}
+
+func (wsh *WebSocketHandler) sendError(client *client.Client, reason string) {
+	errorMessage := &pb.ErrorMessage{
+		Error: reason,
+	}
+
+	wrappedError := &pb.Message{
+		Type: pb.MsgType_error,
+		MessageType: &pb.Message_Error{
+			Error: errorMessage,
+		},
+	}
+
+	encoded, err := proto.Marshal(wrappedError)
+	if err != nil {
+		log.Println("Failed to marshal ErrorMessage:", err)
+		return
+	}
+
+	wsh.sendToClient(client, encoded)
+}
+
+// answers a clock sync ping with the server's time
+func (wsh *WebSocketHandler) sendPong(client *client.Client, clientTime int64) {
+	wrappedMessage := &pb.Message{
+		Type: pb.MsgType_pong,
+		MessageType: &pb.Message_Pong{
+			Pong: &pb.PongMessage{
+				ClientTime: clientTime,
+				ServerTime: wsh.Clock.Now().UnixMicro(),
+			},
+		},
+	}
+
+	encoded, err := proto.Marshal(wrappedMessage)
+	if err != nil {
+		log.Println("Failed to marshal pong message: ", err)
+		return
 	}
+
+	wsh.sendToClient(client, encoded)
 }
 
 func (wsh *WebSocketHandler) broadcastToRoom(roomId string, message []byte) {
 	wsh.Mu.Lock()
 	defer wsh.Mu.Unlock()
 
+	delayed := wsh.spectatorDelay() > 0
+	if delayed {
+		wsh.queueForSpectators(roomId, message)
+	} else {
+		wsh.sendToSubscribers(roomId, message)
+	}
+
 	for _, client := range wsh.Connections {
 		if client.RoomId == roomId {
+			if delayed && client.Spectator {
+				continue
+			}
+
 			select {
 			case client.SendQueue <- message:
 			default:
+				wsh.Metrics.dropped()
 				log.Printf("Dropping message, send queue full for client %s", client.ID)
 			}
 		}
 	}
 }
 
+// the paddles after a move, for everyone in the room and its spectators
+func (wsh *WebSocketHandler) broadcastPaddlePositions(roomId string, leftPaddle float64, rightPaddle float64) {
+	wrappedMessage := &pb.Message{
+		Type: pb.MsgType_paddle_positions,
+		MessageType: &pb.Message_PaddlePositions{
+			PaddlePositions: &pb.PaddlePositionsMessage{
+				LeftPaddleData:  leftPaddle,
+				RightPaddleData: rightPaddle,
+			},
+		},
+	}
+
+	encoded, err := proto.Marshal(wrappedMessage)
+	if err != nil {
+		log.Println("Failed to marshal paddle positions message: ", err)
+		return
+	}
+
+	wsh.broadcastToRoom(roomId, encoded)
+}
+
 // ---------------------------------------------------
 
 // ---------------------------------------------------
 // Ball Logic functions
-func (wsh *WebSocketHandler) startBallUpdates() {
 
-	ticker := time.NewTicker(32 * time.Millisecond)
+// records the game and serves the ball, the recorder is attached first so
+// the replay has the game from its first tick. the match is still played
+// if the replay can not be created
+func (wsh *WebSocketHandler) startMatch(g *game) {
+	replayId, w, err := wsh.createReplay()
+	if err != nil {
+		log.Println("Failed to create the replay: ", err)
+	} else {
+		wsh.Mu.Lock()
+		wsh.startRecording(g, replayId, w)
+		wsh.Mu.Unlock()
+	}
+
+	wsh.startBallUpdates(g)
+}
+
+func (wsh *WebSocketHandler) startBallUpdates(g *game) {
+
+	ticker := wsh.Clock.NewTicker(BallTickInterval)
 	defer ticker.Stop()
 
+	// the tick after a goal pause comes from before it, so it is not late
+	paused := false
+
 	for {
-		<-ticker.C
+		tick := <-ticker.C()
+		start := wsh.Clock.Now()
+
+		late := start.Sub(tick)
+		if paused {
+			late = 0
+		}
 
 		wsh.Mu.Lock()
-		if len(wsh.Connections) == 0 {
+		if g.Finished || g.humans() == 0 {
+			g.BallRunning = false
+			if g.humans() == 0 && wsh.Games[g.RoomId] == g {
+				delete(wsh.Games, g.RoomId)
+			}
 			wsh.Mu.Unlock()
-			continue
+
+			// abandoned games keep what was recorded so far
+			wsh.stopRecording(g)
+			return
 		}
+		goals := g.Sim.Scores.LeftScores + g.Sim.Scores.RightScores
 		wsh.Mu.Unlock()
 
-		wsh.updateBallPosition()
+		wsh.updateBallPosition(g)
 
 		wsh.Mu.Lock()
 
+		if g.Finished {
+			wsh.Mu.Unlock()
+			continue
+		}
+
+		paused = g.Sim.Scores.LeftScores+g.Sim.Scores.RightScores != goals
+
 		ballObject := &pb.Ball{
-			X:      wsh.BallVar.X,
-			Y:      wsh.BallVar.Y,
-			Radius: wsh.BallVar.Radius,
+			X:      g.Sim.Ball.X,
+			Y:      g.Sim.Ball.Y,
+			Radius: g.Sim.Ball.Radius,
 		}
 
 		ballPositionMessage := &pb.BallPositionMessage{
@@ -393,117 +708,121 @@ func (wsh *WebSocketHandler) startBallUpdates() {
 
 		wsh.Mu.Unlock()
 
-		wsh.broadcastToAll(message)
+		wsh.broadcastToRoom(g.RoomId, message)
+
+		// ticks during the goal pause do no work, so they are left out of the
+		// tick metrics
+		if !paused {
+			wsh.Metrics.recordTick(late, wsh.Clock.Since(start))
+		}
 	}
 }
 
-func (wsh *WebSocketHandler) resetBall(directionX int) {
-	wsh.BallVar.X = wsh.CanvasVar.Width / 2
-	wsh.BallVar.Y = wsh.CanvasVar.Height / 2
+// hands out the goal the simulation scored this tick, and shows it again
+// while the ball waits for the next serve
+func (wsh *WebSocketHandler) checkBallOutOfBounds(g *game, result simulation.Result) {
+	wsh.Mu.Lock()
 
-	baseSpeed := 10
-	wsh.BallVar.Dx = float64(directionX) * float64(baseSpeed)
-	wsh.BallVar.Dy = (rand.Float64() - 0.5) * 5.0
-}
+	g.sampleBallSpeed()
 
-// checks if the ball is out bounds, which would mean if the player has scored
-// or not
+	if result.Goal == "" {
+		wsh.Mu.Unlock()
+		return
+	}
 
-func (wsh *WebSocketHandler) checkBallOutOfBounds() {
-	timer := time.NewTimer(3 * time.Second)
-	defer timer.Stop()
+	// the score message has always named the team with a capital letter
+	whoScored := "Right"
+	if result.Goal == "left" {
+		whoScored = "Left"
+	}
 
-	wsh.Mu.Lock()
+	log.Println(whoScored, "Player Scored! Score:  ", g.Sim.Scores.RightScores, "-", g.Sim.Scores.LeftScores)
 
-	ballRadius := wsh.BallVar.Radius
-	scored := false
-	scoreMessage := &pb.Message{}
-
-	whoScored := ""
-
-	// ball colliding with the left wall
-	if wsh.BallVar.X-ballRadius <= 0 {
-		// Right players score
-		wsh.Scores.RightScores++
-		log.Println("Right Player Scored! Score:  ", wsh.Scores.RightScores, "-", wsh.Scores.LeftScores)
-		wsh.resetBall(1)
-		scored = true
-		whoScored = "Right"
-	}
-
-	// ball colliding with the left wall
-	if wsh.BallVar.X+ballRadius >= wsh.CanvasVar.Width {
-		// Left players score
-		wsh.Scores.LeftScores++
-		log.Println("Left Player Scored! Score:  ", wsh.Scores.RightScores, "-", wsh.Scores.LeftScores)
-		wsh.resetBall(-1)
-		scored = true
-		whoScored = "Left"
+	winner := ""
+	if g.Sim.Scores.LeftScores >= WinningScore {
+		winner = "left"
+	} else if g.Sim.Scores.RightScores >= WinningScore {
+		winner = "right"
 	}
 
-	if scored {
-		scoreUpdate := &pb.ScoreMessage{
-			LeftScore:  wsh.Scores.LeftScores,
-			RightScore: wsh.Scores.RightScores,
-			Scored:     whoScored,
+	scoringClients := []*client.Client{}
+	scorers := []*pb.PlayerInfo{}
+	for _, client := range g.Clients {
+		if client.Team == result.Goal {
+			scoringClients = append(scoringClients, client)
+			scorers = append(scorers, newPlayerInfo(client))
 		}
+	}
 
-		scoreMessage = &pb.Message{
-			Type: pb.MsgType_score,
-			MessageType: &pb.Message_Score{
-				Score: scoreUpdate,
-			},
-		}
+	g.recordGoal(result.Goal, scoringClients, wsh.Clock.Now())
+
+	scoreUpdate := &pb.ScoreMessage{
+		LeftScore:  g.Sim.Scores.LeftScores,
+		RightScore: g.Sim.Scores.RightScores,
+		Scored:     whoScored,
+		Scorers:    scorers,
 	}
 
+	scoreMessage := &pb.Message{
+		Type: pb.MsgType_score,
+		MessageType: &pb.Message_Score{
+			Score: scoreUpdate,
+		},
+	}
+
+	g.recordEvent(scoreMessage)
+
 	encoded, marshalErr := proto.Marshal(scoreMessage)
 	if marshalErr != nil {
 		log.Println("Failed to marshal ScoreMessage:", marshalErr)
 	}
 
+	// not recorded, replay playback builds it again from the simulation
+	goalReplay, replayErr := proto.Marshal(g.GoalReplay.message(result.Goal))
+	if replayErr != nil {
+		log.Println("Failed to marshal GoalReplayMessage:", replayErr)
+	}
+
 	// Release the lock before broadcasting
 	wsh.Mu.Unlock()
 
-	// Broadcast outside of the lock if we scored
-	if scored {
-		wsh.broadcastToAll(encoded)
-		log.Println("timer started")
-		<-timer.C
-		log.Println("timer stopped")
+	wsh.broadcastToRoom(g.RoomId, encoded)
+
+	if winner != "" {
+		wsh.finishMatch(g, winner)
+		return
 	}
+
+	// the clients show the goal again while the ball waits
+	if replayErr == nil {
+		wsh.broadcastToRoom(g.RoomId, goalReplay)
+	}
+
+	log.Println("timer started")
+	wsh.Clock.Sleep(GoalPause)
+	log.Println("timer stopped")
 }
 
-func (wsh *WebSocketHandler) updateBallPosition() {
+func (wsh *WebSocketHandler) updateBallPosition(g *game) {
 	wsh.Mu.Lock()
 
-	// update ball position
-	wsh.BallVar.X += wsh.BallVar.Dx
-	wsh.BallVar.Y += wsh.BallVar.Dy
+	// what the clients have on screen right now, the tick that scores
+	// serves the ball again so its own position is never shown
+	g.GoalReplay.add(g.Sim.State)
 
-	// maxWidth := wsh.CanvasVar.Width
-	maxHeight := wsh.CanvasVar.Height
-	ballRadius := wsh.BallVar.Radius
+	result := g.Sim.Step()
 
-	// wall collision (top & bottom)
-	if wsh.BallVar.Y-ballRadius <= 0 || wsh.BallVar.Y+ballRadius >= maxHeight {
-		wsh.BallVar.Dy *= -1
+	if result.Hit != "" {
+		g.recordHit(result.Hit)
 	}
 
-	/*
-	   --DEPRECATED-- (now since scoring is there, this dont make sense)
-
-	   if wsh.BallVar.X-ballRadius <= 0 || wsh.BallVar.X+ballRadius >= maxWidth {
-	   wsh.BallVar.Dx *= -1
-	   }
-
-	*/
+	g.recordKeyframe()
+	wsh.keepThumbnailState(g)
 
-	// paddle collision logic
-	wsh.handlePaddleCollision()
 	wsh.Mu.Unlock()
 
 	// check if there is any scoring
-	wsh.checkBallOutOfBounds()
+	wsh.checkBallOutOfBounds(g, result)
 }
 
 // ---------------------------------------------------
@@ -511,11 +830,7 @@ func (wsh *WebSocketHandler) updateBallPosition() {
 // ---------------------------------------------------
 // Paddle Logic functions
 
-func randomVariation() float64 {
-	return (rand.Float64() - 0.5) * 2
-}
-
-func (wsh *WebSocketHandler) updatePaddlePositions(client *client.Client, direction string) {
+func (wsh *WebSocketHandler) updatePaddlePositions(g *game, client *client.Client, direction string) {
 	wsh.Mu.Lock()
 	defer wsh.Mu.Unlock()
 
@@ -523,13 +838,15 @@ func (wsh *WebSocketHandler) updatePaddlePositions(client *client.Client, direct
 	var globalPosition *float64
 
 	if client.Team == "left" {
-		paddle = &wsh.LeftPaddleData
-		globalPosition = &globalPaddlePositions.leftPaddle
+		paddle = &g.LeftPaddleData
+		globalPosition = &g.Sim.LeftPaddle
 	} else {
-		paddle = &wsh.RightPaddleData
-		globalPosition = &globalPaddlePositions.rightPaddle
+		paddle = &g.RightPaddleData
+		globalPosition = &g.Sim.RightPaddle
 	}
 
+	paddle.lastMover = client.PlayerId
+
 	if direction == "up" {
 		paddle.velocity -= acceleration
 	} else if direction == "down" {
@@ -549,8 +866,8 @@ func (wsh *WebSocketHandler) updatePaddlePositions(client *client.Client, direct
 	if newPosition < 0 {
 		newPosition = 0
 		paddle.velocity = 0
-	} else if newPosition+wsh.PaddleVar.Height > wsh.CanvasVar.Height {
-		newPosition = wsh.CanvasVar.Height - wsh.PaddleVar.Height
+	} else if newPosition+g.Sim.Arena.Paddle.Height > g.Sim.Arena.Canvas.Height {
+		newPosition = g.Sim.Arena.Canvas.Height - g.Sim.Arena.Paddle.Height
 		paddle.velocity = 0
 	}
 
@@ -563,56 +880,93 @@ func (wsh *WebSocketHandler) updatePaddlePositions(client *client.Client, direct
 		paddle.position = 0
 		paddle.movementSum = 0
 	}
+}
 
-	// Prepare game state with current paddle positions
-	// gameState := map[string]float64{
-	// 	"leftPaddleData":  globalPaddlePositions.leftPaddle,
-	// 	"rightPaddleData": globalPaddlePositions.rightPaddle,
-	// }
+// moves the client's paddle, the same for players and bots
+func (wsh *WebSocketHandler) handleMovement(client *client.Client, direction string) {
+	var movement float64
 
-	// wsh.broadcastToAll(gameState)
-	// wsh.broadcastPaddlePositions()
-}
+	if direction == "up" {
+		movement = -30
+	} else if direction == "down" {
+		movement = 30
+	}
 
-func (wsh *WebSocketHandler) handlePaddleCollision() {
-	ballRadius := wsh.BallVar.Radius
+	wsh.Mu.Lock()
 
-	leftPaddleRight := wsh.PaddleVar.Width
-	leftPaddleTop := float64(globalPaddlePositions.leftPaddle)
-	leftPaddleBottom := leftPaddleTop + float64(wsh.PaddleVar.Height)
+	if client.Spectator {
+		wsh.Mu.Unlock()
+		wsh.sendError(client, "Spectators can not move the paddles")
+		return
+	}
 
-	rightPaddleLeft := wsh.CanvasVar.Width - wsh.PaddleVar.Width
-	rightPaddleTop := float64(globalPaddlePositions.rightPaddle)
-	rightPaddleBottom := rightPaddleTop + float64(wsh.PaddleVar.Height)
+	g, playing := wsh.gameOf(client)
+	if !playing {
+		wsh.Mu.Unlock()
+		return
+	}
 
-	ballSpeed := math.Hypot(wsh.BallVar.Dx, wsh.BallVar.Dy)
-	maxBounceAngle := math.Pi / 3 // 60 degrees max
+	g.Sim.MovePaddle(client.Team, direction)
+	g.recordInput(client, direction)
 
-	if wsh.BallVar.X-ballRadius <= leftPaddleRight &&
-		wsh.BallVar.Y >= leftPaddleTop &&
-		wsh.BallVar.Y <= leftPaddleBottom {
-		//log.Println("collision with the left paddle detected, paddle height top and bottom", leftPaddleTop, leftPaddleBottom)
+	if client.Team == "left" {
+		g.LeftPaddleData.lastMover = client.PlayerId
 
-		relativePosition := (wsh.BallVar.Y - (leftPaddleTop + float64(wsh.PaddleVar.Height)/2)) / (float64(wsh.PaddleVar.Height) / 2)
-		bounceAngle := relativePosition * maxBounceAngle
-		wsh.BallVar.Dx = math.Abs(ballSpeed * math.Cos(bounceAngle))
-		wsh.BallVar.Dy = ballSpeed * math.Sin(bounceAngle)
-		wsh.BallVar.Dy += randomVariation()
-		wsh.BallVar.X = leftPaddleRight + ballRadius
+		g.LeftPaddleData.movementSum += movement
+		if g.LeftPaddleData.players > 0 {
+			g.LeftPaddleData.position = g.LeftPaddleData.movementSum / float64(g.LeftPaddleData.players)
+			g.RightPaddleData.position = 0
+			g.LeftPaddleData.movementSum = 0
+		} else {
+			g.LeftPaddleData.position = 0
+			g.LeftPaddleData.movementSum = 0
+		}
+	} else {
+		g.RightPaddleData.lastMover = client.PlayerId
+
+		g.RightPaddleData.movementSum += movement
+		if g.RightPaddleData.players > 0 {
+			g.RightPaddleData.position = g.RightPaddleData.movementSum / float64(g.RightPaddleData.players)
+			g.LeftPaddleData.position = 0
+			g.RightPaddleData.movementSum = 0
+		} else {
+			g.RightPaddleData.position = 0
+			g.RightPaddleData.movementSum = 0
+		}
+	}
+
+	leftPaddle := g.Sim.LeftPaddle
+	rightPaddle := g.Sim.RightPaddle
+	clients := int32(g.players())
+	team := client.Team
+	roomId := client.RoomId
+
+	wsh.Mu.Unlock()
+
+	// optional fields should be sent as the address, because proto makes them pointers
+	gameState := &pb.GameStateMessage{
+		LeftPaddleData:  &leftPaddle,
+		RightPaddleData: &rightPaddle,
+		YourTeam:        &team,
+		Clients:         &clients,
 	}
 
-	if wsh.BallVar.X+ballRadius >= rightPaddleLeft &&
-		wsh.BallVar.Y >= rightPaddleTop &&
-		wsh.BallVar.Y <= rightPaddleBottom {
-		//log.Println("collision with the right paddle detected, paddle height top and bottom", rightPaddleTop, rightPaddleBottom)
+	wrappedGameState := &pb.Message{
+		Type: pb.MsgType_game_state,
+		MessageType: &pb.Message_GameState{
+			GameState: gameState,
+		},
+	}
 
-		relativePosition := (wsh.BallVar.Y - (rightPaddleTop + float64(wsh.PaddleVar.Height)/2)) / (float64(wsh.PaddleVar.Height) / 2)
-		bounceAngle := relativePosition * maxBounceAngle
-		wsh.BallVar.Dx = -math.Abs(ballSpeed * math.Cos(bounceAngle))
-		wsh.BallVar.Dy = ballSpeed * math.Sin(bounceAngle)
-		wsh.BallVar.Dy += randomVariation()
-		wsh.BallVar.X = rightPaddleLeft - ballRadius
+	encoded, marshalErr := proto.Marshal(wrappedGameState)
+	if marshalErr != nil {
+		log.Println("Failed to marshal Game State Message:", marshalErr)
+		return
 	}
+
+	client.SendQueue <- encoded
+
+	wsh.broadcastPaddlePositions(roomId, leftPaddle, rightPaddle)
 }
 
 // ---------------------------------------------------
@@ -622,19 +976,25 @@ func (wsh *WebSocketHandler) handlePaddleCollision() {
 
 func (wsh *WebSocketHandler) disconnectPlayer(conn *websocket.Conn) {
 	wsh.Mu.Lock()
-	defer wsh.Mu.Unlock()
 
 	clientId, exists := wsh.ConnToId[conn]
 	if !exists {
+		wsh.Mu.Unlock()
 		return
 	}
 
 	client, exists := wsh.Connections[clientId]
 
-	if client.Team == "left" {
-		wsh.LeftPaddleData.players--
-	} else {
-		wsh.RightPaddleData.players--
+	wsh.Matchmaker.Cancel(clientId)
+
+	g, playing := wsh.gameOf(client)
+	wsh.leaveGame(client)
+	if playing {
+		wsh.backfillPlayer(g, client)
+	}
+
+	if client.Spectator {
+		wsh.RoomManager.RemoveClient(client.RoomId, clientId)
 	}
 
 	close(client.SendQueue)
@@ -642,23 +1002,46 @@ func (wsh *WebSocketHandler) disconnectPlayer(conn *websocket.Conn) {
 	delete(wsh.ConnToId, conn)
 
 	conn.Close()
+	wsh.Mu.Unlock()
+
+	wsh.broadcastRoomPlayers(client.RoomId)
 }
 
 // ---------------------------------------------------
 
-var initialized bool
-var gameRunning bool
-
 // ---------------------------------------------------
 // Main Game Loop
+
+func (wsh *WebSocketHandler) newClientId(conn *websocket.Conn) string {
+	return fmt.Sprintf("%s_%s_%d", conn.RemoteAddr(), wsh.Clock.Now().Format(time.RFC3339Nano), wsh.ClientIds.Add(1))
+}
+
 func (wsh *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the session token is checked before the upgrade so a bad one gets a
+	// plain http error
+	claims, err := wsh.Auth.Authenticate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if claims == nil && !wsh.Config.Auth.AllowGuests {
+		http.Error(w, "an account is required to play", http.StatusUnauthorized)
+		return
+	}
+
+	if replayId := r.URL.Query().Get("replay"); replayId != "" {
+		wsh.serveReplay(w, r, replayId)
+		return
+	}
+
 	conn, err := wsh.Upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Error %s when connecting to the socket", err)
 		return
 	}
 
-	clientId := conn.RemoteAddr().String() + "_" + time.Now().String()
+	clientId := wsh.newClientId(conn)
 
 	client := &client.Client{
 		Conn:      conn,
@@ -666,29 +1049,8 @@ func (wsh *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ID:        clientId,
 	}
 
-	if len(wsh.Connections) < 2 {
-		log.Println("Total number of connections: ", len(wsh.Connections))
-		log.Println("team assigned")
-		if len(wsh.Connections)%2 == 0 {
-			client.Team = "left"
-			wsh.LeftPaddleData.players++
-		} else {
-			client.Team = "right"
-			wsh.RightPaddleData.players++
-		}
-	} else {
-		log.Println("Total number of connections: ", len(wsh.Connections))
-		log.Println("more than 2 players")
-		randomNumber := rand.Intn(100)
-		log.Println("this is the randomNumber", randomNumber)
-		if randomNumber%2 == 0 {
-			client.Team = "left"
-		} else {
-			client.Team = "right"
-		}
-	}
-
-	log.Println("this is the client", client.ID, client.Team)
+	// the team is assigned when the client joins the game of its room
+	log.Println("this is the client", client.ID)
 
 	// a message queue, that sends the data to the client
 	go func() {
@@ -710,6 +1072,8 @@ func (wsh *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	wsh.Mu.Unlock()
 
+	wsh.identify(client, r, claims)
+
 	// Handle incoming messages
 	for {
 		_, p, err := conn.ReadMessage()
@@ -750,15 +1114,18 @@ func (wsh *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		switch message.Type {
 		case pb.MsgType_room_create_request:
 			room_create_req := message.GetRoomCreateRequest()
-			log.Println("Recieved a room create request: %+v", room_create_req)
+			log.Printf("Recieved a room create request: %+v", room_create_req)
 			log.Println("Max Players, ", room_create_req.MaxPlayers)
 
+			wsh.leaveQueue(client)
+
 			roomId := wsh.RoomManager.CreateRoom(client, int(room_create_req.MaxPlayers))
 			log.Println("Generated Room Id: ", roomId)
 
 			// start waiting room
 			wsh.startWaitingRoom(roomId);
 			client.RoomId = roomId;
+			client.Spectator = false
 
 			responseMessage := &pb.RoomCreateResponse{
 				RoomId: roomId,
@@ -778,66 +1145,159 @@ func (wsh *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			}
 
 			client.SendQueue <- encoded
+
+			wsh.broadcastRoomPlayers(roomId)
 			break
 
 		case pb.MsgType_room_join_request:
 			room_join_req := message.GetRoomJoinRequest()
 			
-			log.Println("Receieved a room join request: %v", room_join_req)
+			log.Printf("Receieved a room join request: %v", room_join_req)
+
+			wsh.leaveQueue(client)
+
+			joined, reason := false, ""
+			spectating := room_join_req.Spectate
+
+			// a player coming back to a match a bot took over for them, the
+			// bot's leaving updates the player list
+			if !spectating && wsh.reclaimPaddle(room_join_req.RoomId, client) {
+				joined = true
+			} else if !spectating {
+				joined, reason = wsh.joinRoom(room_join_req.RoomId, client)
+
+				// rooms that are full or already playing can still be watched
+				if _, exists := wsh.RoomManager.GetRoom(room_join_req.RoomId); !joined && exists {
+					spectating = true
+				}
+			}
+
+			if spectating {
+				joined, reason = wsh.spectateRoom(room_join_req.RoomId, client)
+			}
+
+			wsh.Mu.Lock()
+			clients := int32(len(wsh.Connections))
+			team := client.Team
+			if client.Spectator {
+				team = spectatorTeam
+			}
+			wsh.Mu.Unlock()
+
+			responseMessage := &pb.RoomJoinResponse{
+				Success:   joined,
+				Error:     reason,
+				YourTeam:  team,
+				Clients:   clients,
+				Spectator: joined && spectating,
+			}
+
+			wrappedMessage := &pb.Message{
+				Type: pb.MsgType_room_join_response,
+				MessageType: &pb.Message_RoomJoinResponse{
+					RoomJoinResponse: responseMessage,
+				},
+			}
+
+			encoded, marshalErr := proto.Marshal(wrappedMessage)
+			if marshalErr != nil {
+				log.Println("Failed to marshal RoomJoinResponse:", marshalErr)
+				continue
+			}
+
+			client.SendQueue <- encoded
 			break
 
+		case pb.MsgType_add_bot_request:
+			add_bot_req := message.GetAddBotRequest()
+			log.Printf("Received an add bot request: %+v", add_bot_req)
+
+			if added, reason := wsh.addBot(client, add_bot_req.Difficulty); !added {
+				wsh.sendError(client, reason)
+			}
+
+		case pb.MsgType_matchmaking_enqueue:
+			enqueue_req := message.GetMatchmakingEnqueue()
+			log.Printf("Received a matchmaking request: %+v", enqueue_req)
+
+			ticket, err := wsh.Matchmaker.Enqueue(client, enqueue_req.Mode, int(enqueue_req.TeamSize))
+			if err != nil {
+				wsh.sendError(client, err.Error())
+				continue
+			}
+
+			wsh.sendMatchmakingStatus(
+				ticket,
+				wsh.Matchmaker.Queued(ticket.Mode, ticket.TeamSize),
+				wsh.Matchmaker.EstimatedWait(ticket),
+			)
+
+		case pb.MsgType_matchmaking_cancel:
+			wsh.leaveQueue(client)
+
 		case pb.MsgType_init:
 			init := message.GetInit()
-			log.Println("Init Message: %+v", init)
+			log.Printf("Init Message: %+v", init)
 
-			if !initialized && init.Width > 0 && init.Height > 0 {
+			if init.Width > 0 && init.Height > 0 {
 				wsh.Mu.Lock()
 
-				wsh.BallVar = ball.Ball{
-					X:       init.Width / 2,
-					Y:       init.Height / 2,
-					Dx:      -10,
-					Dy:      0,
-					Radius:  ballRadius,
-					Visible: true,
-				}
+				if client.Spectator {
+					initialGameState := wsh.spectatorGameState(client)
+					wsh.Mu.Unlock()
 
-				//log.Println("global paddle positions", globalPaddlePositions)
+					wrappedInitialGameState := &pb.Message{
+						Type: pb.MsgType_initial_game_state,
+						MessageType: &pb.Message_InitialGameState{
+							InitialGameState: initialGameState,
+						},
+					}
 
-				wsh.CanvasVar.Width = init.Width
-				wsh.PaddleVar.Width = init.PaddleWidth
-				wsh.PaddleVar.Height = init.PaddleHeight
-				wsh.CanvasVar.Height = init.Height
+					encoded, marshalInitErr := proto.Marshal(wrappedInitialGameState)
+					if marshalInitErr != nil {
+						log.Println("Failed to marshal Initial Game State Message:", marshalInitErr)
+						continue
+					}
 
-				globalPaddlePositions.leftPaddle = wsh.LeftPaddleData.position
-				globalPaddlePositions.rightPaddle = wsh.RightPaddleData.position
-
-				if len(wsh.Connections) == 1 {
-					wsh.LeftPaddleData.position = (init.Height / 2) - (init.PaddleHeight / 2)
-					wsh.RightPaddleData.position = (init.Height / 2) - (init.PaddleHeight / 2)
-					wsh.BallRunning = false
-					wsh.BallVisible = false
+					client.SendQueue <- encoded
+					continue
 				}
 
-				if !wsh.BallRunning && len(wsh.Connections) > 1 {
-					wsh.BallRunning = true
-					go wsh.startBallUpdates()
+				arena, arenaErr := newArena(init)
+				if arenaErr != nil {
+					wsh.Mu.Unlock()
+					log.Printf("Refusing the arena of client %s: %v", client.ID, arenaErr)
+					wsh.sendError(client, arenaErr.Error())
+					continue
 				}
 
-				wsh.Mu.Unlock()
+				g := wsh.joinGame(client)
+				wsh.joinBots(g)
 
-				if len(wsh.Connections) == 2 {
-					initialized = true
-					gameRunning = true
+				// the first client to initialize sets up the arena for the room
+				if !g.Initialized {
+					g.Sim = simulation.New(arena, rand.Int64())
+					g.Initialized = true
+				}
+
+				if !g.BallRunning && !g.Finished && g.players() > 1 {
+					g.BallRunning = true
+					g.StartedAt = wsh.Clock.Now()
+					go wsh.startMatch(g)
 				}
 
 				initialGameState := &pb.InitialGameStateMessage{
-					LeftPaddleData:  wsh.LeftPaddleData.position,
-					RightPaddleData: wsh.RightPaddleData.position,
+					LeftPaddleData:  g.Sim.LeftPaddle,
+					RightPaddleData: g.Sim.RightPaddle,
 					YourTeam:        client.Team,
-					Clients:         int32(len(wsh.Connections)),
+					Clients:         int32(g.players()),
+					Arena:           replay.NewArena(g.Sim.Arena),
 				}
 
+				wsh.Mu.Unlock()
+
+				wsh.broadcastRoomPlayers(client.RoomId)
+
 				wrappedInitialGameState := &pb.Message{
 					Type: pb.MsgType_initial_game_state,
 					MessageType: &pb.Message_InitialGameState{
@@ -851,7 +1311,6 @@ func (wsh *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					continue
 				}
 
-				log.Println("even after the game is initialized it still enters this block", initialized)
 				client.SendQueue <- encoded
 
 				continue
@@ -860,84 +1319,36 @@ func (wsh *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		case pb.MsgType_movement:
 			move := message.GetMovement()
-			log.Println("Movement Message: %+v", move)
-
-			var movement float64
-
-			if move.Direction == "up" {
-				movement = -30
-			} else if move.Direction == "down" {
-				movement = 30
-			}
+			log.Printf("Movement Message: %+v", move)
 
-			wsh.Mu.Lock()
-			//log.Println("updates of global positions, left paddle and right paddle  ",
-			//globalPaddlePositions, wsh.LeftPaddleData.position, wsh.RightPaddleData.position)
-
-			if client.Team == "left" {
-				newLeftPaddlePos := globalPaddlePositions.leftPaddle + movement
-
-				if newLeftPaddlePos >= 0 && newLeftPaddlePos+wsh.PaddleVar.Height <= wsh.CanvasVar.Height {
-					globalPaddlePositions.leftPaddle = newLeftPaddlePos
-				}
-
-				wsh.LeftPaddleData.movementSum += movement
-				if wsh.LeftPaddleData.players > 0 {
-					wsh.LeftPaddleData.position = wsh.LeftPaddleData.movementSum / float64(wsh.LeftPaddleData.players)
-					wsh.RightPaddleData.position = 0
-					wsh.LeftPaddleData.movementSum = 0
-				} else {
-					wsh.LeftPaddleData.position = 0
-					wsh.LeftPaddleData.movementSum = 0
-				}
-			} else {
-				newRightPaddlePos := globalPaddlePositions.rightPaddle + movement
+			wsh.handleMovement(client, move.Direction)
+			continue
 
-				if newRightPaddlePos >= 0 && newRightPaddlePos+wsh.PaddleVar.Height <= wsh.CanvasVar.Height {
-					globalPaddlePositions.rightPaddle = newRightPaddlePos
-				}
+		case pb.MsgType_rating_request:
+			rating_req := message.GetRatingRequest()
 
-				wsh.RightPaddleData.movementSum += movement
-				if wsh.RightPaddleData.players > 0 {
-					wsh.RightPaddleData.position = wsh.RightPaddleData.movementSum / float64(wsh.RightPaddleData.players)
-					wsh.LeftPaddleData.position = 0
-					wsh.RightPaddleData.movementSum = 0
-				} else {
-					wsh.RightPaddleData.position = 0
-					wsh.RightPaddleData.movementSum = 0
-				}
+			playerId := rating_req.PlayerId
+			if playerId == "" {
+				playerId = client.PlayerId
 			}
-			wsh.Mu.Unlock()
 
-			clients := int32(len(wsh.Connections))
+			wsh.sendRating(client, playerId)
 
-			// optional fields should be sent as the address, because proto makes them pointers
-			gameState := &pb.GameStateMessage{
-				LeftPaddleData:  &globalPaddlePositions.leftPaddle,
-				RightPaddleData: &globalPaddlePositions.rightPaddle,
-				YourTeam:        &client.Team,
-				Clients:         &clients,
-			}
+		case pb.MsgType_chat:
+			wsh.handleChat(client, message.GetChat().Text)
 
-			wrappedGameState := &pb.Message{
-				Type: pb.MsgType_game_state,
-				MessageType: &pb.Message_GameState{
-					GameState: gameState,
-				},
-			}
+		case pb.MsgType_ping:
+			wsh.sendPong(client, message.GetPing().ClientTime)
 
-			encoded, marshalErr := proto.Marshal(wrappedGameState)
-			if marshalErr != nil {
-				log.Println("Failed to marshal Game State Message:", marshalErr)
-				continue
-			}
+		case pb.MsgType_match_history_request:
+			history_req := message.GetMatchHistoryRequest()
 
-			client.SendQueue <- encoded
-			continue
-		}
+			playerId := history_req.PlayerId
+			if playerId == "" {
+				playerId = client.PlayerId
+			}
 
-		if gameRunning && initialized {
-			log.Println("game is running")
+			wsh.sendMatchHistory(client, playerId, int(history_req.Limit))
 		}
 	}
 }
@@ -0,0 +1,546 @@
+package wsserver
+
+import (
+	"github.com/mo-shahab/go-pong/config"
+	"github.com/mo-shahab/go-pong/gopongclient"
+	"github.com/mo-shahab/go-pong/matchmaking"
+	pb "github.com/mo-shahab/go-pong/proto"
+	"github.com/mo-shahab/go-pong/rating"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+// most ticks a match is played for before a test gives up on it
+const maxTestTicks = 50000
+
+func TestRoomJoin(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxPlayers int
+		players    int // already in the room, the host included
+		roomId     string
+		spectate   bool
+
+		wantSuccess   bool
+		wantSpectator bool
+		wantError     string
+	}{
+		{name: "joins as a player", maxPlayers: 2, players: 1, wantSuccess: true},
+		{name: "full room is watched", maxPlayers: 2, players: 2, wantSuccess: true, wantSpectator: true},
+		{name: "spectates when asked", maxPlayers: 4, players: 1, spectate: true, wantSuccess: true, wantSpectator: true},
+		{name: "unknown room", maxPlayers: 2, players: 1, roomId: "nope", wantError: "Room id is invalid"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := newHarness(t)
+
+			players := []*testClient{}
+			for range test.players {
+				players = append(players, h.connect())
+			}
+			roomId := h.room(test.maxPlayers, players...)
+
+			if test.roomId != "" {
+				roomId = test.roomId
+			}
+
+			joining := h.connect()
+			response, err := joining.JoinRoom(h.context(), roomId, test.spectate)
+
+			if response.Success != test.wantSuccess || response.Spectator != test.wantSpectator {
+				t.Fatalf("got success %v spectator %v, want %v and %v", response.Success, response.Spectator, test.wantSuccess, test.wantSpectator)
+			}
+
+			if test.wantError != "" {
+				if err == nil || err.Error() != test.wantError {
+					t.Fatalf("got error %v, want %q", err, test.wantError)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			// everyone in the room hears about the newcomer
+			host := players[0]
+			wantPlayers := test.players
+			if !test.wantSpectator {
+				wantPlayers++
+			}
+
+			wantSpectators := int32(0)
+			if test.wantSpectator {
+				wantSpectators = 1
+			}
+
+			host.expectPlayers(func(list *pb.RoomPlayersMessage) bool {
+				return len(list.Players) == wantPlayers && list.Spectators == wantSpectators
+			})
+		})
+	}
+}
+
+func TestWaitingRoom(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxPlayers int
+		players    int
+		advance    time.Duration
+
+		want pb.MsgType
+	}{
+		{name: "full room starts right away", maxPlayers: 2, players: 2, advance: time.Second, want: pb.MsgType_game_start},
+		{name: "enough players start at the timeout", maxPlayers: 4, players: 2, advance: WaitingRoomDuration * time.Second, want: pb.MsgType_game_start},
+		{name: "a lone host is closed at the timeout", maxPlayers: 2, players: 1, advance: WaitingRoomDuration * time.Second, want: pb.MsgType_room_closed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := newHarness(t)
+
+			players := []*testClient{}
+			for range test.players {
+				players = append(players, h.connect())
+			}
+			roomId := h.room(test.maxPlayers, players...)
+
+			h.Clock.Advance(test.advance)
+
+			for _, player := range players {
+				message := player.expect(pb.MsgType_game_start, pb.MsgType_room_closed)
+				if message.Type != test.want {
+					t.Fatalf("got %s, want %s", message.Type, test.want)
+				}
+			}
+
+			h.blockUntil(0)
+			h.inspect(func(wsh *WebSocketHandler) {
+				if _, waiting := wsh.WaitingRooms[roomId]; waiting {
+					t.Fatalf("room %s is still waiting", roomId)
+				}
+			})
+		})
+	}
+}
+
+func TestWaitingRoomCountdown(t *testing.T) {
+	h := newHarness(t)
+
+	host := h.connect()
+	h.room(4, host, h.connect())
+
+	h.Clock.Advance(30 * time.Second)
+
+	// a tick fires once however far the clock jumps, like a late ticker
+	state := host.expect(pb.MsgType_waiting_room_state).GetWaitingRoomState()
+	if state.TimeLeft != WaitingRoomDuration-30 || state.CurrentPlayers != 2 || !state.IsActive {
+		t.Fatalf("got %d seconds left for %d players, active %v", state.TimeLeft, state.CurrentPlayers, state.IsActive)
+	}
+}
+
+func TestScoring(t *testing.T) {
+	tests := []struct {
+		name  string
+		goals int
+	}{
+		{name: "first goal", goals: 1},
+		{name: "match point", goals: 2*WinningScore - 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := newHarness(t)
+
+			left, right := h.connect(), h.connect()
+			h.play(left, right)
+
+			// out of the ball's way so the rallies end quickly
+			left.move(gopongclient.Up, 40)
+			right.move(gopongclient.Up, 40)
+
+			scores := []*pb.ScoreMessage{}
+			var end *pb.MatchEndMessage
+
+			for tick := 0; end == nil && len(scores) < test.goals; tick++ {
+				if tick == maxTestTicks {
+					t.Fatalf("%d goals after %d ticks", len(scores), tick)
+				}
+
+				message := h.tick(left)
+				if score := message.GetScore(); score != nil {
+					scores = append(scores, score)
+				}
+				if message.Type == pb.MsgType_match_end {
+					end = message.GetMatchEnd()
+				}
+			}
+
+			for i, score := range scores {
+				if score.LeftScore+score.RightScore != int32(i+1) {
+					t.Fatalf("goal %d left the score at %d-%d", i+1, score.LeftScore, score.RightScore)
+				}
+			}
+
+			last := scores[len(scores)-1]
+			if max(last.LeftScore, last.RightScore) < WinningScore {
+				return
+			}
+
+			// the winning goal ends the match
+			if end == nil {
+				end = left.expect(pb.MsgType_match_end).GetMatchEnd()
+			}
+
+			winner := "left"
+			if last.RightScore > last.LeftScore {
+				winner = "right"
+			}
+
+			if end.Winner != winner || end.LeftScore != last.LeftScore || end.RightScore != last.RightScore {
+				t.Fatalf("got %s winning %d-%d, want %s winning %d-%d", end.Winner, end.LeftScore, end.RightScore, winner, last.LeftScore, last.RightScore)
+			}
+		})
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	tests := []struct {
+		name     string
+		playing  bool // the game has started
+		backfill bool
+
+		wantPlayers int
+		wantBot     bool
+	}{
+		{name: "leaves the lobby", wantPlayers: 1},
+		{name: "leaves the match", playing: true, wantPlayers: 1},
+		{name: "a bot takes over", playing: true, backfill: true, wantPlayers: 2, wantBot: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := newHarness(t, func(cfg *config.Config) {
+				cfg.Bots.Backfill = test.backfill
+			})
+
+			stays, leaves := h.connect(), h.connect()
+			if test.playing {
+				h.play(stays, leaves)
+			} else {
+				h.room(4, stays, leaves)
+			}
+
+			leaves.Close()
+
+			list := stays.expectPlayers(func(list *pb.RoomPlayersMessage) bool {
+				for _, player := range list.Players {
+					if player.PlayerId == leaves.PlayerId {
+						return false
+					}
+				}
+				return true
+			})
+
+			bots := 0
+			for _, player := range list.Players {
+				if player.Bot {
+					bots++
+				}
+			}
+
+			if len(list.Players) != test.wantPlayers || (bots > 0) != test.wantBot {
+				t.Fatalf("got %d players with %d bots, want %d and a bot %v", len(list.Players), bots, test.wantPlayers, test.wantBot)
+			}
+
+			// the match goes on for whoever is left
+			if test.playing {
+				h.tick(stays)
+			}
+		})
+	}
+}
+
+func TestReconnectGrace(t *testing.T) {
+	grace := config.Default().Bots.ReconnectGrace.Duration
+
+	tests := []struct {
+		name  string
+		after time.Duration // away for this long
+
+		wantPaddle bool
+	}{
+		{name: "takes the paddle back", after: grace - time.Second, wantPaddle: true},
+		{name: "too late to take it back", after: grace + time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := newHarness(t, func(cfg *config.Config) {
+				cfg.Bots.Backfill = true
+			})
+
+			stays, leaves := h.connect(), h.connect()
+			roomId := h.play(stays, leaves)
+
+			leaves.Close()
+			stays.expectPlayers(func(list *pb.RoomPlayersMessage) bool {
+				return !slices.ContainsFunc(list.Players, func(player *pb.PlayerInfo) bool {
+					return player.PlayerId == leaves.PlayerId
+				})
+			})
+
+			h.Clock.Advance(test.after)
+
+			back := h.connect(func(options *gopongclient.Options) {
+				options.Token = leaves.Token
+			})
+			if back.PlayerId != leaves.PlayerId {
+				t.Fatalf("came back as %s, want %s", back.PlayerId, leaves.PlayerId)
+			}
+
+			response, err := back.JoinRoom(h.context(), roomId, false)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if response.Spectator == test.wantPaddle {
+				t.Fatalf("got spectator %v, want the paddle %v", response.Spectator, test.wantPaddle)
+			}
+
+			if !test.wantPaddle {
+				return
+			}
+
+			// the bot notices on its next tick and leaves
+			h.Clock.Advance(BallTickInterval)
+			stays.expectPlayers(func(list *pb.RoomPlayersMessage) bool {
+				return len(list.Players) == 2 && !slices.ContainsFunc(list.Players, func(player *pb.PlayerInfo) bool {
+					return player.Bot
+				})
+			})
+		})
+	}
+}
+
+func TestPaddleMoves(t *testing.T) {
+	h := newHarness(t)
+
+	left, right := h.connect(), h.connect()
+	roomId := h.play(left, right)
+
+	spectator := h.connect()
+	if response, err := spectator.JoinRoom(h.context(), roomId, true); err != nil || !response.Spectator {
+		t.Fatalf("Failed to spectate: %v", err)
+	}
+
+	if err := left.Move(gopongclient.Up); err != nil {
+		t.Fatalf("Failed to move: %v", err)
+	}
+	moved := left.expect(pb.MsgType_game_state).GetGameState()
+
+	// the opponent and the spectator see the same paddles as the mover
+	for _, observer := range []*testClient{right, spectator} {
+		paddles := observer.expect(pb.MsgType_paddle_positions).GetPaddlePositions()
+		if paddles.LeftPaddleData != moved.GetLeftPaddleData() || paddles.RightPaddleData != moved.GetRightPaddleData() {
+			t.Fatalf("got paddles at %v and %v, want %v and %v", paddles.LeftPaddleData, paddles.RightPaddleData, moved.GetLeftPaddleData(), moved.GetRightPaddleData())
+		}
+	}
+}
+
+func TestArenaBounds(t *testing.T) {
+	h := newHarness(t)
+
+	left, right := h.connect(), h.connect()
+	h.room(2, left, right)
+
+	h.Clock.Advance(time.Second)
+	left.expect(pb.MsgType_game_start)
+
+	tests := []struct {
+		name  string
+		arena gopongclient.Arena
+	}{
+		{name: "too small", arena: gopongclient.Arena{Width: 50, Height: 600, PaddleWidth: 10, PaddleHeight: 100}},
+		{name: "too tall", arena: gopongclient.Arena{Width: 800, Height: 100000, PaddleWidth: 10, PaddleHeight: 100}},
+		{name: "wide paddle", arena: gopongclient.Arena{Width: 800, Height: 600, PaddleWidth: 400, PaddleHeight: 100}},
+		{name: "no paddle", arena: gopongclient.Arena{Width: 800, Height: 600, PaddleWidth: 10}},
+		{name: "paddle as tall as the arena", arena: gopongclient.Arena{Width: 800, Height: 600, PaddleWidth: 10, PaddleHeight: 600}},
+		{name: "not a number", arena: gopongclient.Arena{Width: math.NaN(), Height: 600, PaddleWidth: 10, PaddleHeight: 100}},
+	}
+
+	for _, test := range tests {
+		if _, err := left.Ready(h.context(), test.arena); err == nil {
+			t.Fatalf("%s: the arena %+v was accepted", test.name, test.arena)
+		}
+	}
+
+	// refused arenas leave the room to the next one
+	initial, err := left.Ready(h.context(), gopongclient.DefaultArena)
+	if err != nil {
+		t.Fatalf("Failed to get ready: %v", err)
+	}
+	if arena := initial.GetArena(); arena.GetWidth() != gopongclient.DefaultArena.Width || arena.GetHeight() != gopongclient.DefaultArena.Height {
+		t.Fatalf("got arena %+v, want %+v", arena, gopongclient.DefaultArena)
+	}
+}
+
+func TestLastPlayerLeavesGame(t *testing.T) {
+	h := newHarness(t)
+
+	left, right := h.connect(), h.connect()
+	roomId := h.play(left, right)
+
+	left.Close()
+	right.Close()
+
+	h.eventually("the players to be gone", func(wsh *WebSocketHandler) bool {
+		return len(wsh.Connections) == 0
+	})
+
+	// the next tick finds nobody and stops the ball
+	h.Clock.Advance(BallTickInterval)
+	h.blockUntil(0)
+
+	h.inspect(func(wsh *WebSocketHandler) {
+		if _, exists := wsh.Games[roomId]; exists {
+			t.Fatalf("the game of room %s is still running", roomId)
+		}
+	})
+}
+
+func TestMatchmakingByHand(t *testing.T) {
+	h := newHarness(t)
+
+	queued, other := h.connect(), h.connect()
+	if _, err := queued.Enqueue(h.context(), matchmaking.ModeCasual, 1); err != nil {
+		t.Fatalf("Failed to queue: %v", err)
+	}
+
+	// a room made by hand takes the player out of the queue
+	h.room(2, queued)
+
+	// the status answering the enqueue, then the one for leaving the queue
+	queued.expect(pb.MsgType_matchmaking_status)
+	if !queued.expect(pb.MsgType_matchmaking_status).GetMatchmakingStatus().Cancelled {
+		t.Fatal("the player is still queued after making a room")
+	}
+
+	// a match found before that falls through, the others are queued again
+	ticket := &matchmaking.Ticket{ID: "late", Client: h.serverClient(queued), Mode: matchmaking.ModeCasual, TeamSize: 1}
+	waiting := &matchmaking.Ticket{ID: "waiting", Client: h.serverClient(other), Mode: matchmaking.ModeCasual, TeamSize: 1}
+	h.Handler.createMatchRoom([]*matchmaking.Ticket{waiting, ticket})
+
+	h.inspect(func(wsh *WebSocketHandler) {
+		wsh.Matchmaker.Mu.Lock()
+		defer wsh.Matchmaker.Mu.Unlock()
+
+		if len(wsh.Matchmaker.Tickets) != 1 || wsh.Matchmaker.Tickets[waiting.Client.ID] != waiting {
+			t.Fatalf("got %d tickets queued, want the other player's", len(wsh.Matchmaker.Tickets))
+		}
+		if waiting.Client.RoomId != "" {
+			t.Fatalf("the other player was put in room %s", waiting.Client.RoomId)
+		}
+	})
+}
+
+func TestMatchmakingSkillWindow(t *testing.T) {
+	h := newHarness(t)
+
+	// 300 points apart, the window starts at 100 and grows 10 a second
+	weaker, stronger := h.connect(), h.connect()
+	for player, points := range map[*testClient]float64{weaker: 1500, stronger: 1800} {
+		if err := h.Handler.Store.PutRating(rating.Rating{PlayerId: player.PlayerId, Rating: points}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, player := range []*testClient{weaker, stronger} {
+		if _, err := player.Enqueue(h.context(), matchmaking.ModeCasual, 1); err != nil {
+			t.Fatalf("Failed to queue: %v", err)
+		}
+		player.expect(pb.MsgType_matchmaking_status)
+	}
+
+	// a matchmaking pass every second, the statuses count the wait on the
+	// handler's clock
+	for second := int32(1); second < 20; second++ {
+		h.Clock.Advance(time.Second)
+
+		status := weaker.expect(pb.MsgType_matchmaking_status, pb.MsgType_match_found).GetMatchmakingStatus()
+		if status == nil {
+			t.Fatalf("matched after %d seconds, the window is too narrow until 20", second)
+		}
+		if status.TimeInQueue != second {
+			t.Fatalf("got %d seconds in the queue, want %d", status.TimeInQueue, second)
+		}
+	}
+
+	h.Clock.Advance(time.Second)
+	weaker.expect(pb.MsgType_match_found)
+	stronger.expect(pb.MsgType_match_found)
+}
+
+func TestReplaySpeed(t *testing.T) {
+	h := newHarness(t)
+
+	viewer := h.watch("../replay/testdata/two-players.replay")
+	viewer.expect(pb.MsgType_replay_state)
+
+	tests := []struct {
+		name  string
+		speed float64
+		want  pb.MsgType
+	}{
+		{name: "not a number", speed: math.NaN(), want: pb.MsgType_error},
+		{name: "too fast", speed: 8, want: pb.MsgType_error},
+		{name: "too slow", speed: 0, want: pb.MsgType_error},
+		{name: "double", speed: 2, want: pb.MsgType_replay_state},
+	}
+
+	for _, test := range tests {
+		if err := viewer.ReplayControl("speed", 0, test.speed); err != nil {
+			t.Fatalf("Failed to send the speed: %v", err)
+		}
+
+		message := viewer.expect(pb.MsgType_error, pb.MsgType_replay_state)
+		if message.Type != test.want {
+			t.Fatalf("%s: got %s, want %s", test.name, message.Type, test.want)
+		}
+
+		// the refused speeds were never taken
+		if state := message.GetReplayState(); state != nil && state.Speed != test.speed {
+			t.Fatalf("%s: playing at %gx, want %gx", test.name, state.Speed, test.speed)
+		}
+	}
+}
+
+func TestReplayPaddles(t *testing.T) {
+	h := newHarness(t)
+
+	viewer := h.watch("../replay/testdata/two-players.replay")
+	viewer.expect(pb.MsgType_game_state)
+
+	// the playback timer and the goal pauses run on the clock, the recorded
+	// moves come out like they did for live spectators
+	for range maxTestTicks {
+		h.Clock.Advance(BallTickInterval)
+		h.blockUntil(1)
+
+		select {
+		case message := <-viewer.Messages:
+			switch message.Type {
+			case pb.MsgType_paddle_positions:
+				return
+			case pb.MsgType_game_state:
+				t.Fatal("got a game state outside of a seek")
+			}
+		default:
+		}
+	}
+
+	t.Fatal("no paddle moves were played back")
+}